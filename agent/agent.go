@@ -3,6 +3,11 @@ package agent
 import (
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/superfly/flyctl/flyctl"
 )
 
 // TODO: deprecate
@@ -15,7 +20,61 @@ func PathToSocket() string {
 	return filepath.Join(dir, ".fly", "fly-agent.sock")
 }
 
+// SharedSocket returns the path of the socket of an agent run as a service,
+// which is set via the agent_socket setting or FLY_AGENT_SOCKET. It's empty
+// when none is.
+func SharedSocket() string {
+	return viper.GetString(flyctl.ConfigAgentSocket)
+}
+
 type Instances struct {
 	Labels    []string
 	Addresses []string
 }
+
+// Status is what the agent reports about itself and its tunnels.
+type Status struct {
+	PingResponse
+
+	Tunnels []TunnelStatus
+
+	// SSH lists the SSH connections the agent shares.
+	SSH []SSHStatus
+}
+
+// TunnelStatus describes the tunnel of an organization.
+type TunnelStatus struct {
+	Org           string
+	PeerIP        string
+	Endpoint      string
+	BytesIn       uint64
+	BytesOut      uint64
+	LastHandshake time.Time
+	DNSQueries    uint64
+	Sessions      []SessionStatus
+	LastUsed      time.Time
+	Pinned        bool
+
+	// Transport is the transport the tunnel carries WireGuard over, udp or
+	// websockets, and WebsocketReconnects counts the times the websocket of
+	// the latter was replaced.
+	Transport           string
+	WebsocketReconnects uint64
+}
+
+// SSHStatus describes an SSH connection the agent shares.
+type SSHStatus struct {
+	Org      string
+	Addr     string
+	User     string
+	Channels int
+	LastUsed time.Time
+}
+
+// SessionStatus describes a connection the agent proxies through a tunnel.
+type SessionStatus struct {
+	ID      string
+	Network string
+	Target  string
+	Since   time.Time
+}
@@ -1,10 +1,8 @@
 package agent
 
 import (
-	"bytes"
 	"context"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -40,6 +39,10 @@ func Establish(ctx context.Context, apiClient *api.Client) (*Client, error) {
 		return nil, err
 	}
 
+	if c := sharedClient(ctx); c != nil {
+		return c, nil
+	}
+
 	c := newClient("unix", PathToSocket())
 
 	res, err := c.Ping(ctx)
@@ -90,6 +93,35 @@ func Establish(ctx context.Context, apiClient *api.Client) (*Client, error) {
 	return StartDaemon(ctx)
 }
 
+// sharedClient returns a client to the agent run as a service, if one is
+// configured and reachable. Services manage their agent's lifecycle, so it's
+// used even when its version differs.
+func sharedClient(ctx context.Context) *Client {
+	socket := SharedSocket()
+	if socket == "" {
+		return nil
+	}
+
+	logger := logger.MaybeFromContext(ctx)
+
+	c := newClient("unix", socket)
+
+	res, err := c.Ping(ctx)
+	if err != nil {
+		if logger != nil {
+			logger.Debugf("shared agent at %s unreachable, falling back to own agent: %v", socket, err)
+		}
+
+		return nil
+	}
+
+	if !buildinfo.Version().EQ(res.Version) && logger != nil {
+		logger.Debugf("shared agent at %s runs v%s", socket, res.Version)
+	}
+
+	return c
+}
+
 func newClient(network, addr string) *Client {
 	return &Client{
 		network: network,
@@ -115,7 +147,13 @@ func Dial(ctx context.Context, network, addr string) (*Client, error) {
 	return client, nil
 }
 
+// DefaultClient returns a client to the agent run as a service, if one is
+// configured and reachable, or to the agent of the user otherwise.
 func DefaultClient(ctx context.Context) (*Client, error) {
+	if c := sharedClient(ctx); c != nil {
+		return c, nil
+	}
+
 	return Dial(ctx, "unix", PathToSocket())
 }
 
@@ -127,16 +165,47 @@ type Client struct {
 	network string
 	address string
 	dialer  net.Dialer
+
+	// version caches the protocol version the agent speaks; it's zero until
+	// it has been negotiated.
+	version atomic.Int32
 }
 
-func (c *Client) dialContext(ctx context.Context) (conn net.Conn, err error) {
-	return c.dialer.DialContext(ctx, c.network, c.address)
+// dialContext connects to the agent and negotiates the protocol version of
+// the connection. Agents which predate versioning drop the connection after
+// rejecting the negotiation, so they're dialed anew and remembered.
+func (c *Client) dialContext(ctx context.Context) (*conn, error) {
+	for {
+		nc, err := c.dialer.DialContext(ctx, c.network, c.address)
+		if err != nil {
+			return nil, err
+		}
+
+		if v := c.version.Load(); v == 1 {
+			return &conn{Conn: nc, version: 1}, nil
+		}
+
+		switch v, err := negotiate(ctx, nc); {
+		case err == nil:
+			c.version.Store(int32(v))
+
+			return &conn{Conn: nc, version: v}, nil
+		case errors.Is(err, errLegacyAgent):
+			_ = nc.Close()
+
+			c.version.Store(1)
+		default:
+			_ = nc.Close()
+
+			return nil, err
+		}
+	}
 }
 
 var errDone = errors.New("done")
 
-func (c *Client) do(parent context.Context, fn func(net.Conn) error) (err error) {
-	var conn net.Conn
+func (c *Client) do(parent context.Context, fn func(*conn) error) (err error) {
+	var conn *conn
 	if conn, err = c.dialContext(parent); err != nil {
 		return err
 	}
@@ -169,8 +238,8 @@ func (c *Client) do(parent context.Context, fn func(net.Conn) error) (err error)
 }
 
 func (c *Client) Kill(ctx context.Context) error {
-	return c.do(ctx, func(conn net.Conn) error {
-		return proto.Write(conn, "kill")
+	return c.do(ctx, func(conn *conn) error {
+		return conn.send("kill")
 	})
 }
 
@@ -180,27 +249,11 @@ type PingResponse struct {
 	Background bool
 }
 
-type errInvalidResponse []byte
-
-func (err errInvalidResponse) Error() string {
-	return fmt.Sprintf("invalid server response: %q", string(err))
-}
-
 func (c *Client) Ping(ctx context.Context) (res PingResponse, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "ping"); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if isOK(data) {
-			err = unmarshal(&res, data)
-		} else {
-			err = errInvalidResponse(data)
+	err = c.do(ctx, func(conn *conn) (err error) {
+		var reply *proto.Response
+		if reply, err = conn.call("ping"); err == nil {
+			err = reply.Decode(&res)
 		}
 
 		return
@@ -209,30 +262,18 @@ func (c *Client) Ping(ctx context.Context) (res PingResponse, err error) {
 	return
 }
 
-const okPrefix = "ok "
-
-func isOK(data []byte) bool {
-	return isPrefixedWith(data, okPrefix)
-}
-
-func extractOK(data []byte) []byte {
-	return data[len(okPrefix):]
-}
-
-const errorPrefix = "err "
-
-func isError(data []byte) bool {
-	return isPrefixedWith(data, errorPrefix)
-}
-
-func extractError(data []byte) error {
-	msg := data[len(errorPrefix):]
+// Status returns the status of the agent and its tunnels.
+func (c *Client) Status(ctx context.Context) (res Status, err error) {
+	err = c.do(ctx, func(conn *conn) (err error) {
+		var reply *proto.Response
+		if reply, err = conn.call("status"); err == nil {
+			err = reply.Decode(&res)
+		}
 
-	return errors.New(string(msg))
-}
+		return
+	})
 
-func isPrefixedWith(data []byte, prefix string) bool {
-	return strings.HasPrefix(string(data), prefix)
+	return
 }
 
 type EstablishResponse struct {
@@ -241,32 +282,21 @@ type EstablishResponse struct {
 }
 
 func (c *Client) doEstablish(ctx context.Context, slug string, recycle bool) (res *EstablishResponse, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
+	err = c.do(ctx, func(conn *conn) (err error) {
 		verb := "establish"
 		if recycle {
 			verb = "reestablish"
 		}
 
-		if err = proto.Write(conn, verb, slug); err != nil {
-			return
-		}
-
 		// this goes out to the API; don't time it out aggressively
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
+		var reply *proto.Response
+		if reply, err = conn.call(verb, slug); err != nil {
 			return
 		}
 
-		switch {
-		default:
-			err = errInvalidResponse(data)
-		case isOK(data):
-			res = &EstablishResponse{}
-			if err = unmarshal(res, data); err != nil {
-				res = nil
-			}
-		case isError(data):
-			err = extractError(data)
+		res = &EstablishResponse{}
+		if err = reply.Decode(res); err != nil {
+			res = nil
 		}
 
 		return
@@ -284,49 +314,32 @@ func (c *Client) Reestablish(ctx context.Context, slug string) (res *EstablishRe
 }
 
 func (c *Client) Probe(ctx context.Context, slug string) error {
-	return c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "probe", slug); err != nil {
-			return
-		}
+	return c.do(ctx, func(conn *conn) (err error) {
+		_, err = conn.call("probe", slug)
 
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
+		return
+	})
+}
 
-		switch {
-		default:
-			err = errInvalidResponse(data)
-		case string(data) == "ok":
-			return // up and running
-		case isError(data):
-			err = extractError(data)
-		}
+// Disconnect closes the tunnel of the organization.
+func (c *Client) Disconnect(ctx context.Context, slug string) error {
+	return c.do(ctx, func(conn *conn) (err error) {
+		_, err = conn.call("disconnect", slug)
 
 		return
 	})
 }
 
 func (c *Client) Resolve(ctx context.Context, slug, host string) (addr string, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "resolve", slug, host); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		switch {
-		default:
-			err = errInvalidResponse(data)
-		case string(data) == "ok":
+	err = c.do(ctx, func(conn *conn) (err error) {
+		var res *proto.Response
+		switch res, err = conn.call("resolve", slug, host); {
+		case err != nil:
+			break
+		case len(res.Args) == 0:
 			err = ErrNoSuchHost
-		case isOK(data):
-			addr = string(extractOK(data))
-		case isError(data):
-			err = extractError(data)
+		default:
+			addr = res.Args[0]
 		}
 
 		return
@@ -389,24 +402,11 @@ func (c *Client) Instances(ctx context.Context, org, app string) (instances Inst
 	gqlChan := make(chan instancesResult)
 	var agentInstances Instances
 	go func() {
-		agentChan <- c.do(ctx, func(conn net.Conn) (err error) {
-			if err = proto.Write(conn, "instances", org, app); err != nil {
-				return
-			}
-
+		agentChan <- c.do(ctx, func(conn *conn) (err error) {
 			// this goes out to the network; don't time it out aggressively
-			var data []byte
-			if data, err = proto.Read(conn); err != nil {
-				return
-			}
-
-			switch {
-			default:
-				err = errInvalidResponse(data)
-			case isOK(data):
-				err = unmarshal(&agentInstances, data)
-			case isError(data):
-				err = extractError(data)
+			var res *proto.Response
+			if res, err = conn.call("instances", org, app); err == nil {
+				err = res.Decode(&agentInstances)
 			}
 
 			return
@@ -543,17 +543,6 @@ func gqlGetInstances(ctx context.Context, orgSlug, appName string) instancesResu
 	return instancesResult{result, nil}
 }
 
-func unmarshal(dst interface{}, data []byte) (err error) {
-	src := bytes.NewReader(extractOK(data))
-
-	dec := json.NewDecoder(src)
-	if err = dec.Decode(dst); err != nil {
-		err = fmt.Errorf("failed decoding response: %w", err)
-	}
-
-	return
-}
-
 // Dialer establishes a connection to the wireguard agent and return a dialier
 // for use in subsequent actions, such as running ssh commands or opening proxies
 func (c *Client) Dialer(ctx context.Context, slug string) (d Dialer, err error) {
@@ -612,35 +601,48 @@ func (d *dialer) Config() *wg.Config {
 	return d.config
 }
 
-func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
-	if conn, err = d.client.dialContext(ctx); err != nil {
-		return
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.client.dialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	verb := "connect"
+	if strings.HasPrefix(network, "udp") {
+		verb = "connectudp"
 	}
-	defer func() {
-		if err != nil {
-			_ = conn.Close()
-		}
-	}()
 
 	timeout := strconv.FormatInt(int64(d.timeout), 10)
-	if err = proto.Write(conn, "connect", d.slug, addr, timeout); err != nil {
-		return
+	if _, err = conn.call(verb, d.slug, addr, timeout); err != nil {
+		_ = conn.Close()
+
+		return nil, err
 	}
 
-	var data []byte
-	if data, err = proto.Read(conn); err != nil {
-		return
+	// the connection now carries the proxied stream
+	if verb == "connectudp" {
+		return &datagramConn{Conn: conn}, nil
 	}
 
-	switch {
-	default:
-		err = errInvalidResponse(data)
-	case string(data) == "ok":
-	case isError(data):
-		err = extractError(data)
+	return conn, nil
+}
+
+// datagramConn carries the datagrams of a connectudp session over the agent
+// connection, keeping their boundaries.
+type datagramConn struct {
+	net.Conn
+}
+
+func (c *datagramConn) Read(p []byte) (int, error) {
+	return proto.ReadDatagram(c.Conn, p)
+}
+
+func (c *datagramConn) Write(p []byte) (int, error) {
+	if err := proto.WriteDatagram(c.Conn, p); err != nil {
+		return 0, err
 	}
 
-	return
+	return len(p), nil
 }
 
 // Pinger wraps a connection to the flyctl agent over which ICMP
@@ -668,7 +670,9 @@ func (c *Client) Pinger(ctx context.Context, slug string) (p *Pinger, err error)
 		return nil, fmt.Errorf("pinger: %w", err)
 	}
 
-	if err = proto.Write(conn, "ping6", slug); err != nil {
+	if err = conn.send("ping6", slug); err != nil {
+		_ = conn.Close()
+
 		return nil, fmt.Errorf("pinger: %w", err)
 	}
 
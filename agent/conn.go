@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/superfly/flyctl/agent/internal/proto"
+)
+
+// conn is a connection to the agent, speaking the protocol version negotiated
+// over it.
+type conn struct {
+	net.Conn
+
+	version int
+	lastID  uint64
+}
+
+// errLegacyAgent is returned by negotiate when the agent predates protocol
+// versioning.
+var errLegacyAgent = errors.New("agent predates protocol versioning")
+
+// negotiate agrees on the protocol version of the connection with the agent.
+func negotiate(ctx context.Context, nc net.Conn) (version int, err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+		defer nc.SetDeadline(time.Time{})
+	}
+
+	if err = proto.Write(nc, proto.Hello, strconv.Itoa(proto.Version)); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = proto.Read(nc); err != nil {
+		return
+	}
+
+	var res *proto.Response
+	switch res, err = proto.ParseLegacyResponse(data); {
+	case err != nil:
+		return
+	case res.Error != "":
+		err = errLegacyAgent
+	case len(res.Args) != 1:
+		err = fmt.Errorf("invalid hello response: %q", string(data))
+	default:
+		if version, err = strconv.Atoi(res.Args[0]); err == nil && (version < 1 || version > proto.Version) {
+			err = fmt.Errorf("agent negotiated unsupported protocol version %d", version)
+		}
+	}
+
+	return
+}
+
+// send writes the request.
+func (c *conn) send(verb string, args ...string) error {
+	if c.version < 2 {
+		return proto.Write(c.Conn, verb, args...)
+	}
+
+	c.lastID++
+
+	return proto.WriteMessage(c.Conn, proto.Request{
+		ID:   c.lastID,
+		Verb: verb,
+		Args: args,
+	})
+}
+
+// receive reads the response to the latest request.
+func (c *conn) receive() (*proto.Response, error) {
+	if c.version < 2 {
+		data, err := proto.Read(c.Conn)
+		if err != nil {
+			return nil, err
+		}
+
+		return proto.ParseLegacyResponse(data)
+	}
+
+	var res proto.Response
+	if err := proto.ReadMessage(c.Conn, &res); err != nil {
+		return nil, err
+	}
+
+	if res.ID != c.lastID {
+		return nil, fmt.Errorf("response %d doesn't match request %d", res.ID, c.lastID)
+	}
+
+	return &res, nil
+}
+
+// call sends the request and returns its response. Errors the agent replies
+// with are returned as such.
+func (c *conn) call(verb string, args ...string) (*proto.Response, error) {
+	if err := c.send(verb, args...); err != nil {
+		return nil, err
+	}
+
+	res, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := res.Err(); err != nil {
+		return nil, agentError(err)
+	}
+
+	return res, nil
+}
+
+// agentError maps the errors the agent replies with onto the errors this
+// package exports, so that callers may match them with errors.Is.
+func agentError(err error) error {
+	for _, known := range []error{ErrTunnelUnavailable, ErrNoSuchHost, ErrUnsupportedCommand, ErrSSHNotShared} {
+		if err.Error() == known.Error() {
+			return known
+		}
+	}
+
+	return err
+}
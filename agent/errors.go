@@ -5,4 +5,12 @@ import "errors"
 var (
 	ErrNoSuchHost        = errors.New("host was not found in DNS")
 	ErrTunnelUnavailable = errors.New("tunnel unavailable")
+
+	// ErrUnsupportedCommand is returned by agents which don't support the
+	// command, such as ones older than the client.
+	ErrUnsupportedCommand = errors.New("unsupported command")
+
+	// ErrSSHNotShared is returned by agents which refuse to share SSH
+	// connections since users other than theirs may connect to them.
+	ErrSSHNotShared = errors.New("ssh connections aren't shared over this socket")
 )
@@ -0,0 +1,155 @@
+package proto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Version is the latest version of the protocol. Version 1 is the legacy
+// protocol of space separated verbs and arguments Read and Write frame.
+// Version 2 exchanges Request and Response envelopes WriteMessage and
+// ReadMessage frame.
+//
+// Connections start in version 1. Clients wishing to use a later version send
+// the Hello verb along with the latest version they support and, when the
+// reply is ok, switch to the version it carries. Agents which predate
+// versioning reply with an error, in which case clients keep to version 1.
+const Version = 2
+
+// Hello is the verb which negotiates the version of a connection.
+const Hello = "hello"
+
+// MaxMessageSize caps the size of the messages WriteMessage and ReadMessage
+// frame.
+const MaxMessageSize = 64 << 20
+
+// Request is a request of version 2 of the protocol.
+type Request struct {
+	ID   uint64   `json:"id"`
+	Verb string   `json:"verb"`
+	Args []string `json:"args,omitempty"`
+}
+
+// Response is the response to the Request of the same ID. Responses carry an
+// error, plain arguments or structured data.
+type Response struct {
+	ID    uint64          `json:"id"`
+	Error string          `json:"error,omitempty"`
+	Args  []string        `json:"args,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Err returns the error the response carries, if any.
+func (r *Response) Err() error {
+	if r.Error == "" {
+		return nil
+	}
+
+	return errors.New(r.Error)
+}
+
+// Decode decodes the data the response carries into v. Since version 1
+// responses carry data as their single argument, it's decoded in their case.
+func (r *Response) Decode(v interface{}) (err error) {
+	data := r.Data
+	if data == nil && len(r.Args) == 1 {
+		data = []byte(r.Args[0])
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		err = fmt.Errorf("failed decoding response: %w", err)
+	}
+
+	return
+}
+
+// ParseLegacyResponse parses a version 1 reply into a Response.
+func ParseLegacyResponse(data []byte) (*Response, error) {
+	verb, arg, hasArg := strings.Cut(string(data), " ")
+
+	var res Response
+	switch {
+	case verb == "ok" && hasArg:
+		res.Args = []string{arg}
+	case verb == "ok":
+		break
+	case verb == "err" && hasArg:
+		res.Error = arg
+	default:
+		return nil, fmt.Errorf("invalid server response: %q", string(data))
+	}
+
+	return &res, nil
+}
+
+// NegotiatedVersion returns the version both ends support, given the one the
+// Hello verb carries.
+func NegotiatedVersion(requested string) (int, error) {
+	v, err := strconv.Atoi(requested)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid protocol version %q", requested)
+	}
+
+	if v > Version {
+		v = Version
+	}
+
+	return v, nil
+}
+
+var errMessageTooLarge = errors.New("message too large")
+
+// WriteMessage writes v, encoded as JSON, prefixed with its length.
+func WriteMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > MaxMessageSize {
+		return errMessageTooLarge
+	}
+
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+
+	_, err = w.Write(buf)
+
+	return err
+}
+
+// ReadMessage reads a message WriteMessage wrote and decodes it into v.
+func ReadMessage(r io.Reader, v interface{}) error {
+	data, err := ReadMessageBytes(r)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// ReadMessageBytes reads the raw contents of a message WriteMessage wrote.
+func ReadMessageBytes(r io.Reader) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+
+	l := binary.BigEndian.Uint32(b[:])
+	if l > MaxMessageSize {
+		return nil, errMessageTooLarge
+	}
+
+	data := make([]byte, l)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
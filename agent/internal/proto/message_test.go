@@ -0,0 +1,59 @@
+package proto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	// arguments may hold spaces and exceed the legacy frame size
+	arg := "with spaces " + strings.Repeat("x", 1<<17)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMessage(&buf, Request{ID: 7, Verb: "resolve", Args: []string{"personal", arg}}))
+
+	var req Request
+	require.NoError(t, ReadMessage(&buf, &req))
+	assert.Equal(t, Request{ID: 7, Verb: "resolve", Args: []string{"personal", arg}}, req)
+
+	assert.ErrorIs(t, Write(&buf, "ok", arg), ErrFrameTooLarge)
+	assert.Zero(t, buf.Len())
+}
+
+func TestParseLegacyResponse(t *testing.T) {
+	res, err := ParseLegacyResponse([]byte("ok"))
+	require.NoError(t, err)
+	assert.NoError(t, res.Err())
+	assert.Empty(t, res.Args)
+
+	res, err = ParseLegacyResponse([]byte(`ok {"PID":1}`))
+	require.NoError(t, err)
+
+	var v struct{ PID int }
+	require.NoError(t, res.Decode(&v))
+	assert.Equal(t, 1, v.PID)
+
+	res, err = ParseLegacyResponse([]byte("err tunnel unavailable"))
+	require.NoError(t, err)
+	assert.EqualError(t, res.Err(), "tunnel unavailable")
+
+	_, err = ParseLegacyResponse([]byte("what"))
+	assert.Error(t, err)
+}
+
+func TestNegotiatedVersion(t *testing.T) {
+	v, err := NegotiatedVersion("1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	v, err = NegotiatedVersion("99")
+	require.NoError(t, err)
+	assert.Equal(t, Version, v)
+
+	_, err = NegotiatedVersion("0")
+	assert.Error(t, err)
+}
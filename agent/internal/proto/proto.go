@@ -3,7 +3,9 @@ package proto
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
+	"math"
 )
 
 func Read(r io.Reader) (data []byte, err error) {
@@ -18,12 +20,20 @@ func Read(r io.Reader) (data []byte, err error) {
 	return
 }
 
+// ErrFrameTooLarge is returned by Write for frames which don't fit their 2 byte
+// length; nothing is written in its case.
+var ErrFrameTooLarge = errors.New("frame too large; use a later protocol version")
+
 func Write(w io.Writer, verb string, args ...string) (err error) {
 	size := len(verb) + len(args)
 	for _, arg := range args {
 		size += len(arg)
 	}
 
+	if size > math.MaxUint16 {
+		return ErrFrameTooLarge
+	}
+
 	var b [2]byte
 	binary.LittleEndian.PutUint16(b[:], uint16(size))
 
@@ -46,3 +56,45 @@ func Write(w io.Writer, verb string, args ...string) (err error) {
 
 	return
 }
+
+// WriteDatagram writes p prefixed with its length, so that datagrams keep
+// their boundaries over stream connections. p is written in a single call.
+func WriteDatagram(w io.Writer, p []byte) error {
+	if len(p) > math.MaxUint16 {
+		return errDatagramTooLarge
+	}
+
+	buf := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(buf, uint16(len(p)))
+	copy(buf[2:], p)
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// ReadDatagram reads a datagram WriteDatagram wrote into p and returns its
+// length. Datagrams larger than p are truncated, as they would be by UDP.
+func ReadDatagram(r io.Reader, p []byte) (n int, err error) {
+	var b [2]byte
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return
+	}
+
+	l := int(binary.BigEndian.Uint16(b[:]))
+	if n = l; n > len(p) {
+		n = len(p)
+	}
+
+	if _, err = io.ReadFull(r, p[:n]); err != nil {
+		return 0, err
+	}
+
+	if l > n {
+		_, err = io.CopyN(io.Discard, r, int64(l-n))
+	}
+
+	return
+}
+
+var errDatagramTooLarge = errors.New("datagram too large")
@@ -13,15 +13,13 @@ import (
 	"time"
 
 	"github.com/azazeal/pause"
-	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/superfly/flyctl/agent"
-	"github.com/superfly/flyctl/flyctl"
 	"github.com/superfly/flyctl/wg"
 
 	"github.com/superfly/flyctl/api"
-	"github.com/superfly/flyctl/internal/env"
 	"github.com/superfly/flyctl/internal/sentry"
 	"github.com/superfly/flyctl/internal/wireguard"
 )
@@ -32,6 +30,23 @@ type Options struct {
 	Client     *api.Client
 	Background bool
 	ConfigFile string
+
+	// MetricsAddr, when set, is the local address tunnel metrics are served
+	// on in the Prometheus text format. Addresses prefixed with unix: name a
+	// unix socket.
+	MetricsAddr string
+
+	// TunnelIdleTimeout, when positive, is how long tunnels which carry no
+	// connections stay up after they were last used.
+	TunnelIdleTimeout time.Duration
+
+	// MaxTunnels, when positive, caps the number of open tunnels. The least
+	// recently used idle tunnel is closed to make room for new ones.
+	MaxTunnels int
+
+	// PinnedOrgs are the slugs of the organizations whose tunnels are never
+	// reaped nor closed to make room.
+	PinnedOrgs []string
 }
 
 func Run(ctx context.Context, opt Options) (err error) {
@@ -52,11 +67,27 @@ func Run(ctx context.Context, opt Options) (err error) {
 		return
 	}
 
+	var metrics net.Listener
+	if opt.MetricsAddr != "" {
+		if metrics, err = listenMetrics(opt.MetricsAddr); err != nil {
+			_ = l.Close()
+
+			err = fmt.Errorf("failed binding metrics endpoint: %w", err)
+			opt.Logger.Print(err)
+
+			return
+		}
+	}
+
 	err = (&server{
 		Options:       opt,
 		listener:      l,
+		metrics:       metrics,
 		currentChange: latestChangeAt,
 		tunnels:       make(map[string]*wg.Tunnel),
+		lastUsed:      make(map[string]time.Time),
+		connects:      make(map[id]*connectSession),
+		privateSocket: socketPrivate(l),
 	}).serve(ctx, l)
 
 	return
@@ -73,6 +104,15 @@ func bind(socket string) (l net.Listener, err error) {
 		}
 	}()
 
+	switch l, err = activatedListener(); {
+	case err != nil:
+		err = fmt.Errorf("failed using activated socket: %w", err)
+
+		return
+	case l != nil:
+		return // the service manager owns the socket
+	}
+
 	if err = removeSocket(socket); err != nil {
 		err = fmt.Errorf("failed removing existing socket: %w", err)
 
@@ -102,10 +142,27 @@ type server struct {
 	Options
 
 	listener net.Listener
+	metrics  net.Listener
 
 	mu            sync.Mutex
 	currentChange time.Time
 	tunnels       map[string]*wg.Tunnel
+	lastUsed      map[string]time.Time
+
+	// reaped holds the organizations whose tunnels were closed for idleness
+	// or to make room, which are rebuilt when next asked for.
+	reaped map[string]bool
+
+	connectsMu sync.Mutex
+	connects   map[id]*connectSession
+
+	sshMu      sync.Mutex
+	sshConns   map[sshKey]*sshConn
+	sshHostKey ssh.Signer
+
+	// privateSocket is set when only the agent's user may connect, which
+	// sharing SSH connections requires.
+	privateSocket bool
 }
 
 type terminateError struct{ error }
@@ -133,6 +190,31 @@ func (s *server) serve(parent context.Context, l net.Listener) (err error) {
 		return nil
 	})
 
+	if s.TunnelIdleTimeout > 0 {
+		eg.Go(func() error {
+			s.reapIdleTunnels(ctx)
+
+			return nil
+		})
+	}
+
+	eg.Go(func() error {
+		s.reapIdleSSH(ctx)
+
+		return nil
+	})
+
+	if s.metrics != nil {
+		eg.Go(func() error {
+			// the agent remains useful without its metrics
+			if err := s.serveMetrics(ctx, s.metrics); err != nil {
+				s.print(err)
+			}
+
+			return nil
+		})
+	}
+
 	eg.Go(func() (err error) {
 		s.printf("OK %d", os.Getpid())
 		defer s.print("QUIT")
@@ -210,16 +292,29 @@ func (s *server) buildTunnel(org *api.Organization, recycle bool) (tunnel *wg.Tu
 
 	if tunnel = s.tunnels[org.Slug]; tunnel != nil && !recycle {
 		// tunnel already exists
+		s.lastUsed[org.Slug] = time.Now()
+
 		return
 	}
 
+	if tunnel == nil {
+		if err = s.makeRoomUnlocked(); err != nil {
+			return
+		}
+	}
+
 	var state *wg.WireGuardState
 	if state, err = wireguard.StateForOrg(s.Client, org, "", "", recycle); err != nil {
 		return
 	}
 
-	// WIP: can't stay this way, need something more clever than this
-	if env.IsCI() || os.Getenv("WSWG") != "" || viper.GetBool(flyctl.ConfigWireGuardWebsockets) {
+	// recycling rotates the keys of the peer, which leaves the existing
+	// tunnel useless
+	s.closeTunnelUnlocked(org.Slug)
+
+	if reason := websocketsReason(); reason != "" {
+		s.printf("connecting tunnel to %s over websockets: %s", org.Slug, reason)
+
 		if tunnel, err = wg.ConnectWS(context.Background(), state); err != nil {
 			return
 		}
@@ -230,6 +325,8 @@ func (s *server) buildTunnel(org *api.Organization, recycle bool) (tunnel *wg.Tu
 	}
 
 	s.tunnels[org.Slug] = tunnel
+	s.lastUsed[org.Slug] = time.Now()
+	delete(s.reaped, org.Slug)
 
 	return
 }
@@ -282,7 +379,12 @@ func (s *server) tunnelFor(slug string) *wg.Tunnel {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.tunnels[slug]
+	tunnel := s.tunnels[slug]
+	if tunnel != nil {
+		s.lastUsed[slug] = time.Now()
+	}
+
+	return tunnel
 }
 
 func (s *server) probeTunnel(ctx context.Context, slug string) (err error) {
@@ -324,16 +426,11 @@ func (s *server) validateTunnelsUnlocked() error {
 		return err
 	}
 
-	for slug, tunnel := range s.tunnels {
+	for slug := range s.tunnels {
 		if peers[slug] == nil {
-			delete(s.tunnels, slug)
-
 			s.printf("no peer for %s in config - closing tunnel ...", slug)
 
-			if err := tunnel.Close(); err != nil {
-				s.printf("failed closing tunnel: %v", err)
-			}
-
+			s.closeTunnelUnlocked(slug)
 		}
 	}
 
@@ -5,8 +5,12 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
+	"net"
 	"os"
+	"strconv"
+	"syscall"
 )
 
 func removeSocket(path string) (err error) {
@@ -26,3 +30,52 @@ func removeSocket(path string) (err error) {
 
 	return
 }
+
+// listenFDsStart is the first file descriptor systemd passes sockets in.
+const listenFDsStart = 3
+
+// activatedListener returns the socket systemd passed the agent when it was
+// socket activated, if it was.
+func activatedListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	defer func() {
+		// keep the agent's children from mistaking the sockets for theirs
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	switch n, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); {
+	case err != nil:
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %w", err)
+	case n != 1:
+		return nil, fmt.Errorf("expected a single activated socket, got %d", n)
+	}
+
+	syscall.CloseOnExec(listenFDsStart)
+
+	f := os.NewFile(listenFDsStart, "fly-agent.sock")
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// socketPrivate reports whether only the agent's user may connect to the
+// socket the listener listens on. Connecting to unix sockets takes write
+// permission, which group and other must lack.
+func socketPrivate(l net.Listener) bool {
+	addr, ok := l.Addr().(*net.UnixAddr)
+	if !ok || addr.Name == "" {
+		return false
+	}
+
+	info, err := os.Stat(addr.Name)
+	if err != nil {
+		return false
+	}
+
+	return info.Mode().Perm()&0o022 == 0
+}
@@ -6,6 +6,7 @@ package server
 import (
 	"errors"
 	"io/fs"
+	"net"
 	"os"
 )
 
@@ -23,3 +24,15 @@ func removeSocket(path string) (err error) {
 
 	return
 }
+
+// activatedListener returns nil since there's no socket activation on
+// Windows.
+func activatedListener() (net.Listener, error) {
+	return nil, nil
+}
+
+// socketPrivate reports true since, lacking socket activation, the agent binds
+// its socket in the user's profile on Windows, which other users can't access.
+func socketPrivate(net.Listener) bool {
+	return true
+}
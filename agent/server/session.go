@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"os"
 	"regexp"
@@ -38,9 +39,14 @@ type session struct {
 	conn   net.Conn
 	logger *log.Logger
 	id     id
+
+	// version is the protocol version negotiated over the connection and
+	// reqID the ID of the request being served, as of version 2.
+	version int
+	reqID   uint64
 }
 
-var errUnsupportedCommand = errors.New("unsupported command")
+var errUnsupportedCommand = agent.ErrUnsupportedCommand
 
 func runSession(ctx context.Context, srv *server, conn net.Conn, id id) {
 	var wg sync.WaitGroup
@@ -68,10 +74,11 @@ func runSession(ctx context.Context, srv *server, conn net.Conn, id id) {
 	}()
 
 	s := &session{
-		srv:    srv,
-		conn:   conn,
-		logger: logger,
-		id:     id,
+		srv:     srv,
+		conn:    conn,
+		logger:  logger,
+		id:      id,
+		version: 1,
 	}
 
 	if err := s.srv.checkForConfigChange(); err != nil {
@@ -80,7 +87,44 @@ func runSession(ctx context.Context, srv *server, conn net.Conn, id id) {
 		return
 	}
 
-	buf, err := proto.Read(s.conn)
+	args, ok := s.read()
+	if !ok {
+		return
+	}
+
+	if args[0] == proto.Hello {
+		if !s.hello(args[1:]...) {
+			return
+		}
+
+		if args, ok = s.read(); !ok {
+			return
+		}
+	}
+
+	fn := handlers[args[0]]
+	if fn == nil {
+		s.error(errUnsupportedCommand)
+
+		return
+	}
+
+	fn(s, ctx, args[1:]...)
+}
+
+// read reads a request and returns its verb followed by its arguments.
+func (s *session) read() (args []string, ok bool) {
+	var (
+		buf []byte
+		err error
+	)
+
+	if s.version < 2 {
+		buf, err = proto.Read(s.conn)
+	} else {
+		buf, err = proto.ReadMessageBytes(s.conn)
+	}
+
 	if len(buf) > 0 {
 		s.logger.Printf("<- (% 5d) %q", len(buf), redact(buf))
 	}
@@ -93,16 +137,43 @@ func runSession(ctx context.Context, srv *server, conn net.Conn, id id) {
 		return
 	}
 
-	args := strings.Split(string(buf), " ")
+	if s.version < 2 {
+		return strings.Split(string(buf), " "), true
+	}
 
-	fn := handlers[args[0]]
-	if fn == nil {
-		s.error(errUnsupportedCommand)
+	var req proto.Request
+	if err = json.Unmarshal(buf, &req); err != nil {
+		s.error(fmt.Errorf("malformed request: %w", err))
 
 		return
 	}
+	s.reqID = req.ID
 
-	fn(s, ctx, args[1:]...)
+	return append([]string{req.Verb}, req.Args...), true
+}
+
+var errMalformedHello = errors.New("malformed hello command")
+
+// hello negotiates the protocol version of the session. The reply is written
+// in version 1, after which the session switches to the negotiated version.
+func (s *session) hello(args ...string) bool {
+	if !s.exactArgs(1, args, errMalformedHello) {
+		return false
+	}
+
+	version, err := proto.NegotiatedVersion(args[0])
+	if err != nil {
+		s.error(err)
+
+		return false
+	}
+
+	if !s.ok(strconv.Itoa(version)) {
+		return false
+	}
+	s.version = version
+
+	return true
 }
 
 type handlerFunc func(*session, context.Context, ...string)
@@ -110,13 +181,17 @@ type handlerFunc func(*session, context.Context, ...string)
 var handlers = map[string]handlerFunc{
 	"kill":        (*session).kill,
 	"ping":        (*session).ping,
+	"status":      (*session).status,
 	"establish":   (*session).establish,
 	"reestablish": (*session).reestablish,
 	"connect":     (*session).connect,
+	"connectudp":  (*session).connectUDP,
 	"probe":       (*session).probe,
+	"disconnect":  (*session).disconnect,
 	"instances":   (*session).instances,
 	"resolve":     (*session).resolve,
 	"ping6":       (*session).ping6,
+	"ssh":         (*session).ssh,
 }
 
 var errMalformedKill = errors.New("malformed kill command")
@@ -145,6 +220,16 @@ func (s *session) ping(_ context.Context, args ...string) {
 	})
 }
 
+var errMalformedStatus = errors.New("malformed status command")
+
+func (s *session) status(_ context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedStatus) {
+		return
+	}
+
+	_ = s.marshal(s.srv.status())
+}
+
 var errMalformedEstablish = errors.New("malformed establish command")
 
 func (s *session) doEstablish(ctx context.Context, recycle bool, args ...string) {
@@ -198,6 +283,28 @@ func (s *session) fetchOrg(ctx context.Context, slug string) (*api.Organization,
 	return nil, errNoSuchOrg
 }
 
+// liveTunnel returns the tunnel of the organization. Tunnels the agent closed
+// for idleness or to make room are rebuilt, since long-lived clients such as
+// fly proxy and fly agent dns only establish them when they start.
+func (s *session) liveTunnel(ctx context.Context, slug string) (*wg.Tunnel, error) {
+	if tunnel := s.srv.tunnelFor(slug); tunnel != nil {
+		return tunnel, nil
+	}
+
+	if !s.srv.wasReaped(slug) {
+		return nil, agent.ErrTunnelUnavailable
+	}
+
+	org, err := s.fetchOrg(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	s.srv.printf("rebuilding the tunnel of %q ...", slug)
+
+	return s.srv.buildTunnel(org, false)
+}
+
 var errMalformedProbe = errors.New("malformed probe command")
 
 func (s *session) probe(ctx context.Context, args ...string) {
@@ -214,6 +321,22 @@ func (s *session) probe(ctx context.Context, args ...string) {
 	_ = s.ok()
 }
 
+var errMalformedDisconnect = errors.New("malformed disconnect command")
+
+func (s *session) disconnect(_ context.Context, args ...string) {
+	if !s.exactArgs(1, args, errMalformedDisconnect) {
+		return
+	}
+
+	if err := s.srv.disconnect(args[0]); err != nil {
+		s.error(err)
+
+		return
+	}
+
+	_ = s.ok()
+}
+
 var errMalformedInstances = errors.New("malformed instances command")
 
 func (s *session) instances(ctx context.Context, args ...string) {
@@ -221,9 +344,9 @@ func (s *session) instances(ctx context.Context, args ...string) {
 		return
 	}
 
-	tunnel := s.srv.tunnelFor(args[0])
-	if tunnel == nil {
-		s.error(agent.ErrTunnelUnavailable)
+	tunnel, err := s.liveTunnel(ctx, args[0])
+	if err != nil {
+		s.error(err)
 
 		return
 	}
@@ -255,9 +378,9 @@ func (s *session) resolve(ctx context.Context, args ...string) {
 		return
 	}
 
-	tunnel := s.srv.tunnelFor(args[0])
-	if tunnel == nil {
-		s.error(agent.ErrTunnelUnavailable)
+	tunnel, err := s.liveTunnel(ctx, args[0])
+	if err != nil {
+		s.error(err)
 
 		return
 	}
@@ -313,22 +436,71 @@ var (
 )
 
 func (s *session) connect(ctx context.Context, args ...string) {
-	if !s.exactArgs(3, args, errMalformedConnect) {
+	outconn := s.dialTunnel(ctx, "tcp", errMalformedConnect, args...)
+	if outconn == nil {
 		return
 	}
+	defer s.srv.trackConnect(s.id, args[0], "tcp", args[1])()
+	defer func() {
+		if err := outconn.Close(); err != nil && !isClosed(err) {
+			s.logger.Printf("failed closing outconn: %v", err)
+		}
+	}()
+
+	if !s.ok() {
+		return
+	}
+
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		_ = s.conn.Close()
+		_ = outconn.Close()
+
+		return errDone
+	})
+
+	eg.Go(func() (err error) {
+		if _, err = io.Copy(s.conn, outconn); err == nil {
+			err = io.EOF
+		}
+
+		return
+	})
+
+	eg.Go(func() (err error) {
+		if _, err = io.Copy(outconn, s.conn); err == nil {
+			err = io.EOF
+		}
+
+		return
+	})
+
+	_ = eg.Wait()
+}
+
+// dialTunnel dials the address args name through the tunnel of the
+// organization they name, with the timeout they carry. It replies with the
+// error and returns nil in case of failure.
+func (s *session) dialTunnel(ctx context.Context, network string, errMalformed error, args ...string) net.Conn {
+	if !s.exactArgs(3, args, errMalformed) {
+		return nil
+	}
 
 	timeout, err := strconv.ParseUint(args[2], 10, 32)
 	if err != nil {
 		s.error(err)
 
-		return
+		return nil
 	}
 
-	tunnel := s.srv.tunnelFor(args[0])
-	if tunnel == nil {
-		s.error(agent.ErrTunnelUnavailable)
+	tunnel, err := s.liveTunnel(ctx, args[0])
+	if err != nil {
+		s.error(err)
 
-		return
+		return nil
 	}
 
 	var dialContext context.Context
@@ -340,12 +512,26 @@ func (s *session) connect(ctx context.Context, args ...string) {
 	}
 	defer cancel()
 
-	outconn, err := tunnel.DialContext(dialContext, "tcp", args[1])
+	outconn, err := tunnel.DialContext(dialContext, network, args[1])
 	if err != nil {
 		s.error(err)
 
+		return nil
+	}
+
+	return outconn
+}
+
+var errMalformedConnectUDP = errors.New("malformed connectudp command")
+
+// connectUDP is the UDP counterpart of connect. Since the agent connection is
+// a stream, datagrams are relayed over it framed by their length.
+func (s *session) connectUDP(ctx context.Context, args ...string) {
+	outconn := s.dialTunnel(ctx, "udp", errMalformedConnectUDP, args...)
+	if outconn == nil {
 		return
 	}
+	defer s.srv.trackConnect(s.id, args[0], "udp", args[1])()
 	defer func() {
 		if err := outconn.Close(); err != nil && !isClosed(err) {
 			s.logger.Printf("failed closing outconn: %v", err)
@@ -367,25 +553,85 @@ func (s *session) connect(ctx context.Context, args ...string) {
 		return errDone
 	})
 
-	eg.Go(func() (err error) {
-		if _, err = io.Copy(s.conn, outconn); err == nil {
-			err = io.EOF
-		}
+	eg.Go(func() error {
+		buf := make([]byte, math.MaxUint16)
 
-		return
-	})
+		for {
+			n, err := outconn.Read(buf)
+			if err != nil {
+				return err
+			}
 
-	eg.Go(func() (err error) {
-		if _, err = io.Copy(outconn, s.conn); err == nil {
-			err = io.EOF
+			if err := proto.WriteDatagram(s.conn, buf[:n]); err != nil {
+				return err
+			}
 		}
+	})
 
-		return
+	eg.Go(func() error {
+		buf := make([]byte, math.MaxUint16)
+
+		for {
+			n, err := proto.ReadDatagram(s.conn, buf)
+			if err != nil {
+				return err
+			}
+
+			if _, err := outconn.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
 	})
 
 	_ = eg.Wait()
 }
 
+var errMalformedSSH = errors.New("malformed ssh command")
+
+// ssh serves SSH over the connection, relaying the channels the client opens
+// over the SSH connection the agent shares. The arguments name the
+// organization, the address of the server and the user, followed by the
+// certificate and private key the client is authorized with, which the agent
+// connects with when it holds no connection yet.
+func (s *session) ssh(ctx context.Context, args ...string) {
+	if len(args) != 5 {
+		s.error(errMalformedSSH)
+
+		return
+	}
+
+	if !s.srv.privateSocket {
+		s.error(agent.ErrSSHNotShared)
+
+		return
+	}
+
+	tunnel, err := s.liveTunnel(ctx, args[0])
+	if err != nil {
+		s.error(err)
+
+		return
+	}
+
+	key := sshKey{org: args[0], addr: args[1], user: args[2]}
+
+	c, err := s.srv.sshConnFor(ctx, tunnel, key, args[3], args[4])
+	if err != nil {
+		s.error(err)
+
+		return
+	}
+	defer s.srv.trackConnect(s.id, key.org, "ssh", key.addr)()
+
+	if !s.ok() {
+		return
+	}
+
+	if err := s.srv.serveSSH(s.conn, c); err != nil {
+		s.logger.Print(err)
+	}
+}
+
 func (s *session) ping6(ctx context.Context, args ...string) {
 	// As with "dial", "ping6" handles an agent command and then
 	// repurposes the agent connection as a transport.
@@ -395,11 +641,12 @@ func (s *session) ping6(ctx context.Context, args ...string) {
 		return
 	}
 
-	tunnel := s.srv.tunnelFor(args[0])
-	if tunnel == nil {
-		s.error(agent.ErrTunnelUnavailable)
+	tunnel, err := s.liveTunnel(ctx, args[0])
+	if err != nil {
+		s.error(err)
 		return
 	}
+	defer s.srv.trackConnect(s.id, args[0], "icmp6", "ping")()
 
 	// YOG-SOTHOTH IS THE GATE
 	sock, err := tunnel.ListenPing()
@@ -507,6 +754,26 @@ func (s *session) ok(args ...string) bool {
 }
 
 func (s *session) reply(verb string, args ...string) bool {
+	if s.version >= 2 {
+		res := proto.Response{ID: s.reqID}
+		if verb == "err" {
+			res.Error = strings.Join(args, " ")
+		} else {
+			res.Args = args
+		}
+
+		return s.write(res)
+	}
+
+	err := s.writeFrame(verb, args...)
+	if errors.Is(err, proto.ErrFrameTooLarge) {
+		return s.error(err)
+	}
+
+	return s.checkWrite(err)
+}
+
+func (s *session) writeFrame(verb string, args ...string) error {
 	var b bytes.Buffer
 	out := io.MultiWriter(
 		&b,
@@ -518,6 +785,26 @@ func (s *session) reply(verb string, args ...string) bool {
 		s.logger.Printf("-> (% 5d) %q", l, redact(b.Bytes()))
 	}
 
+	return err
+}
+
+// write writes the response of a version 2 session.
+func (s *session) write(res proto.Response) bool {
+	var b bytes.Buffer
+	out := io.MultiWriter(
+		&b,
+		s.conn,
+	)
+
+	err := proto.WriteMessage(out, res)
+	if l := b.Len(); l > 0 {
+		s.logger.Printf("-> (% 5d) %q", l, redact(b.Bytes()))
+	}
+
+	return s.checkWrite(err)
+}
+
+func (s *session) checkWrite(err error) bool {
 	if err != nil {
 		if !isClosed(err) {
 			s.logger.Printf("failed writing: %v", err)
@@ -553,15 +840,18 @@ func (s *session) marshal(v interface{}) (ok bool) {
 	var sb strings.Builder
 
 	enc := json.NewEncoder(&sb)
-	switch err := enc.Encode(v); err {
-	default:
+	switch err := enc.Encode(v); {
+	case err != nil:
 		err = fmt.Errorf("failed marshaling response: %w", err)
 
 		s.error(err)
-	case nil:
-		ok = true
-
-		s.ok(sb.String())
+	case s.version >= 2:
+		ok = s.write(proto.Response{
+			ID:   s.reqID,
+			Data: json.RawMessage(sb.String()),
+		})
+	default:
+		ok = s.ok(sb.String())
 	}
 
 	return
@@ -571,8 +861,13 @@ func isClosed(err error) bool {
 	return errors.Is(err, net.ErrClosed)
 }
 
-var redactRx = regexp.MustCompile(`(PrivateKey|private)":".*?"`)
+var (
+	redactRx    = regexp.MustCompile(`(PrivateKey|private)":".*?"`)
+	redactPEMRx = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+)
 
 func redact(buf []byte) []byte {
-	return redactRx.ReplaceAll(buf, []byte(`PrivateKey":"[redacted]"`))
+	buf = redactRx.ReplaceAll(buf, []byte(`PrivateKey":"[redacted]"`))
+
+	return redactPEMRx.ReplaceAll(buf, []byte(`[redacted]`))
 }
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/agent/internal/proto"
+	"github.com/superfly/flyctl/wg"
+)
+
+// startSession serves a session over a pipe and returns the client end.
+func startSession(t *testing.T) net.Conn {
+	t.Helper()
+
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(configFile, nil, 0o600))
+
+	srv := &server{
+		Options: Options{
+			Logger:     log.New(io.Discard, "", 0),
+			ConfigFile: configFile,
+		},
+		currentChange: time.Now(),
+		tunnels:       make(map[string]*wg.Tunnel),
+		connects:      make(map[id]*connectSession),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, conn := net.Pipe()
+	t.Cleanup(func() {
+		cancel()
+		client.Close()
+	})
+
+	go runSession(ctx, srv, conn, 1)
+
+	return client
+}
+
+func TestSessionLegacy(t *testing.T) {
+	conn := startSession(t)
+
+	require.NoError(t, proto.Write(conn, "ping"))
+
+	data, err := proto.Read(conn)
+	require.NoError(t, err)
+
+	res, err := proto.ParseLegacyResponse(data)
+	require.NoError(t, err)
+
+	var pong agent.PingResponse
+	require.NoError(t, res.Decode(&pong))
+	assert.Equal(t, os.Getpid(), pong.PID)
+}
+
+func TestSessionVersion2(t *testing.T) {
+	conn := startSession(t)
+
+	require.NoError(t, proto.Write(conn, proto.Hello, "99"))
+
+	data, err := proto.Read(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "ok "+strconv.Itoa(proto.Version), string(data))
+
+	require.NoError(t, proto.WriteMessage(conn, proto.Request{
+		ID:   42,
+		Verb: "resolve",
+		Args: []string{"no such org", "host with spaces"},
+	}))
+
+	var res proto.Response
+	require.NoError(t, proto.ReadMessage(conn, &res))
+	assert.Equal(t, uint64(42), res.ID)
+	assert.EqualError(t, res.Err(), agent.ErrTunnelUnavailable.Error())
+}
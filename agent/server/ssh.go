@@ -0,0 +1,488 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/azazeal/pause"
+	"github.com/samber/lo"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/superfly/flyctl/agent"
+	flyssh "github.com/superfly/flyctl/ssh"
+	"github.com/superfly/flyctl/wg"
+)
+
+const (
+	// sshIdleTimeout is how long SSH connections without channels are kept
+	// open for.
+	sshIdleTimeout = 10 * time.Minute
+
+	// sshKeepaliveTimeout is how long SSH connections are given to answer
+	// keepalives before they're considered dead.
+	sshKeepaliveTimeout = 5 * time.Second
+)
+
+// sshKey identifies the SSH connections the agent shares.
+type sshKey struct {
+	org  string
+	addr string
+	user string
+}
+
+// sshConn is an SSH connection the agent keeps open and shares among the
+// clients asking for it, in the fashion of OpenSSH's control masters.
+type sshConn struct {
+	sshKey
+
+	client *ssh.Client
+	done   chan struct{}
+
+	// authority is the key which signed the certificate the connection was
+	// made with. Clients present certificates it signed to share it.
+	authority []byte
+
+	// expires is when the certificate the connection was made with expires,
+	// after which the connection is closed.
+	expires time.Time
+
+	mu       sync.Mutex
+	channels int
+	lastUsed time.Time
+}
+
+// use accounts for channels opening, when delta is positive, or closing.
+func (c *sshConn) use(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.channels += delta
+	c.lastUsed = time.Now()
+}
+
+func (c *sshConn) status() agent.SSHStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return agent.SSHStatus{
+		Org:      c.org,
+		Addr:     c.addr,
+		User:     c.user,
+		Channels: c.channels,
+		LastUsed: c.lastUsed,
+	}
+}
+
+// idle reports whether the connection has had no channels since before the
+// given time.
+func (c *sshConn) idle(before time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.channels == 0 && c.lastUsed.Before(before)
+}
+
+// alive reports whether the server still answers over the connection.
+func (c *sshConn) alive() bool {
+	res := make(chan error, 1)
+	go func() {
+		_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+		res <- err
+	}()
+
+	select {
+	case err := <-res:
+		return err == nil
+	case <-time.After(sshKeepaliveTimeout):
+		return false
+	}
+}
+
+// certExpiry returns when the certificate expires, or the zero time if it
+// never does.
+func certExpiry(cert *ssh.Certificate) time.Time {
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(cert.ValidBefore), 0)
+}
+
+var errInvalidSSHCredentials = errors.New("invalid ssh credentials")
+
+// parseSSHCredentials parses the certificate and private key and checks the
+// certificate is a signed user certificate valid at the given time, which
+// certifies the private key.
+func parseSSHCredentials(cert, privateKey string, now time.Time) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cert))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSSHCredentials, err)
+	}
+
+	c, ok := pub.(*ssh.Certificate)
+	if !ok || c.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%w: not a user certificate", errInvalidSSHCredentials)
+	}
+
+	// principals and critical options are for the server to judge; only the
+	// signature and the validity period are checked here
+	var principal string
+	if len(c.ValidPrincipals) > 0 {
+		principal = c.ValidPrincipals[0]
+	}
+
+	checker := &ssh.CertChecker{
+		SupportedCriticalOptions: lo.Keys(c.CriticalOptions),
+		Clock:                    func() time.Time { return now },
+	}
+	if err := checker.CheckCert(principal, c); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSSHCredentials, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSSHCredentials, err)
+	}
+
+	if !bytes.Equal(signer.PublicKey().Marshal(), c.Key.Marshal()) {
+		return nil, fmt.Errorf("%w: the private key isn't the certified one", errInvalidSSHCredentials)
+	}
+
+	return c, nil
+}
+
+// expired reports whether the certificate the connection was made with has
+// expired by the given time.
+func (c *sshConn) expired(now time.Time) bool {
+	return !c.expires.IsZero() && !now.Before(c.expires)
+}
+
+// authorizes reports whether clients presenting the certificate may share
+// the connection, which they may when it's signed by the same authority.
+func (c *sshConn) authorizes(cert *ssh.Certificate) bool {
+	return bytes.Equal(c.authority, cert.SignatureKey.Marshal())
+}
+
+var errSSHAuthority = errors.New("ssh certificate isn't signed by the authority of the shared connection")
+
+// sshConnFor returns the connection the agent keeps for the key, provided
+// the credentials are valid for it. When there's none, or it expired, it
+// connects through the tunnel using the credentials.
+func (s *server) sshConnFor(ctx context.Context, tunnel *wg.Tunnel, key sshKey, cert, privateKey string) (*sshConn, error) {
+	presented, err := parseSSHCredentials(cert, privateKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.sshMu.Lock()
+	c := s.sshConns[key]
+	s.sshMu.Unlock()
+
+	if c != nil {
+		switch {
+		case c.expired(time.Now()):
+			s.printf("dropping ssh connection to %s: certificate expired", key.addr)
+		case !c.authorizes(presented):
+			return nil, errSSHAuthority
+		case c.alive():
+			return c, nil
+		default:
+			s.printf("dropping unresponsive ssh connection to %s ...", key.addr)
+		}
+
+		s.dropSSH(c)
+	}
+
+	client := &flyssh.Client{
+		Addr:        key.addr,
+		User:        key.user,
+		Dial:        tunnel.DialContext,
+		Certificate: cert,
+		PrivateKey:  privateKey,
+	}
+
+	if err := client.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed connecting to %s: %w", key.addr, err)
+	}
+
+	c = &sshConn{
+		sshKey:    key,
+		client:    client.Client,
+		done:      make(chan struct{}),
+		authority: presented.SignatureKey.Marshal(),
+		expires:   certExpiry(presented),
+		lastUsed:  time.Now(),
+	}
+
+	s.sshMu.Lock()
+	existing := s.sshConns[key]
+	if existing == nil {
+		if s.sshConns == nil {
+			s.sshConns = make(map[sshKey]*sshConn)
+		}
+		s.sshConns[key] = c
+	}
+	s.sshMu.Unlock()
+
+	if existing != nil {
+		// another session connected meanwhile
+		_ = c.client.Close()
+
+		if !existing.authorizes(presented) {
+			return nil, errSSHAuthority
+		}
+
+		return existing, nil
+	}
+
+	s.printf("opened ssh connection to %s as %s through %q", key.addr, key.user, key.org)
+
+	var expiry *time.Timer
+	if !c.expires.IsZero() {
+		expiry = time.AfterFunc(time.Until(c.expires), func() {
+			s.printf("closing ssh connection to %s: certificate expired", key.addr)
+
+			s.dropSSH(c)
+		})
+	}
+
+	go func() {
+		err := c.client.Wait()
+		close(c.done)
+
+		if expiry != nil {
+			expiry.Stop()
+		}
+
+		s.dropSSH(c)
+		s.printf("closed ssh connection to %s: %v", key.addr, err)
+	}()
+
+	return c, nil
+}
+
+// dropSSH closes the connection and forgets it.
+func (s *server) dropSSH(c *sshConn) {
+	s.sshMu.Lock()
+	if s.sshConns[c.sshKey] == c {
+		delete(s.sshConns, c.sshKey)
+	}
+	s.sshMu.Unlock()
+
+	_ = c.client.Close()
+}
+
+// dropSSHOf closes the connections made through the tunnel of the
+// organization.
+func (s *server) dropSSHOf(slug string) {
+	for _, c := range s.sshConnsWhere(func(c *sshConn) bool { return c.org == slug }) {
+		s.dropSSH(c)
+	}
+}
+
+// closeIdleSSH closes the connections which have had no channels since
+// before the given time.
+func (s *server) closeIdleSSH(before time.Time) {
+	for _, c := range s.sshConnsWhere(func(c *sshConn) bool { return c.idle(before) }) {
+		s.printf("closing idle ssh connection to %s ...", c.addr)
+
+		s.dropSSH(c)
+	}
+}
+
+func (s *server) sshConnsWhere(fn func(*sshConn) bool) (conns []*sshConn) {
+	s.sshMu.Lock()
+	defer s.sshMu.Unlock()
+
+	for _, c := range s.sshConns {
+		if fn(c) {
+			conns = append(conns, c)
+		}
+	}
+
+	return
+}
+
+// reapIdleSSH closes the connections which have had no channels for longer
+// than sshIdleTimeout until ctx is done.
+func (s *server) reapIdleSSH(ctx context.Context) {
+	for {
+		if pause.For(ctx, idleCheckInterval); ctx.Err() != nil {
+			break
+		}
+
+		s.closeIdleSSH(time.Now().Add(-sshIdleTimeout))
+	}
+}
+
+// sshStatus reports on the connections, ordered by organization and address.
+func (s *server) sshStatus() (st []agent.SSHStatus) {
+	for _, c := range s.sshConnsWhere(func(*sshConn) bool { return true }) {
+		st = append(st, c.status())
+	}
+
+	sort.Slice(st, func(i, j int) bool {
+		if st[i].Org != st[j].Org {
+			return st[i].Org < st[j].Org
+		}
+
+		return st[i].Addr < st[j].Addr
+	})
+
+	return
+}
+
+// sshServerConfig returns the configuration clients of the agent are served
+// SSH with. Since the permissions of the agent's socket already restrict who
+// may connect, they aren't authenticated.
+func (s *server) sshServerConfig() (*ssh.ServerConfig, error) {
+	s.sshMu.Lock()
+	defer s.sshMu.Unlock()
+
+	if s.sshHostKey == nil {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.sshHostKey, err = ssh.NewSignerFromKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(s.sshHostKey)
+
+	return config, nil
+}
+
+// serveSSH serves SSH over the agent connection, relaying the channels the
+// client opens over the shared connection, until either is closed.
+func (s *server) serveSSH(nc net.Conn, c *sshConn) error {
+	config, err := s.sshServerConfig()
+	if err != nil {
+		return err
+	}
+
+	sc, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		return fmt.Errorf("failed ssh handshake: %w", err)
+	}
+	defer sc.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-c.done:
+			_ = sc.Close()
+		case <-stop:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for nch := range chans {
+		wg.Add(1)
+
+		go func(nch ssh.NewChannel) {
+			defer wg.Done()
+
+			relayChannel(c, nch)
+		}(nch)
+	}
+
+	return nil
+}
+
+// relayChannel opens a channel like the one the client asks for over the
+// shared connection and relays one to the other.
+func relayChannel(c *sshConn, nch ssh.NewChannel) {
+	remote, remoteReqs, err := c.client.OpenChannel(nch.ChannelType(), nch.ExtraData())
+	if err != nil {
+		var oce *ssh.OpenChannelError
+		if errors.As(err, &oce) {
+			_ = nch.Reject(oce.Reason, oce.Message)
+		} else {
+			_ = nch.Reject(ssh.ConnectionFailed, err.Error())
+		}
+
+		return
+	}
+
+	local, localReqs, err := nch.Accept()
+	if err != nil {
+		_ = remote.Close()
+
+		return
+	}
+
+	c.use(1)
+	defer c.use(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		relayHalf(remote, local, localReqs)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		relayHalf(local, remote, remoteReqs)
+	}()
+
+	wg.Wait()
+}
+
+// relayHalf relays the data, extended data and requests src carries to dst
+// and closes dst once src is closed.
+func relayHalf(dst, src ssh.Channel, reqs <-chan *ssh.Request) {
+	var copies sync.WaitGroup
+	copies.Add(2)
+
+	go func() {
+		defer copies.Done()
+
+		_, _ = io.Copy(dst, src)
+	}()
+
+	go func() {
+		defer copies.Done()
+
+		_, _ = io.Copy(dst.Stderr(), src.Stderr())
+	}()
+
+	go func() {
+		copies.Wait()
+
+		_ = dst.CloseWrite()
+	}()
+
+	for req := range reqs {
+		ok, err := dst.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			_ = req.Reply(ok && err == nil, nil)
+		}
+	}
+
+	copies.Wait()
+
+	_ = dst.Close()
+}
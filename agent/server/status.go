@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/internal/buildinfo"
+	"github.com/superfly/flyctl/wg"
+)
+
+// connectSession is a connection a session proxies through the tunnel of an
+// organization.
+type connectSession struct {
+	org string
+	agent.SessionStatus
+}
+
+// trackConnect records that the session proxies a connection to the target
+// through the tunnel of the organization. Call the returned func once it's
+// over.
+func (s *server) trackConnect(sessionID id, org, network, target string) (untrack func()) {
+	s.connectsMu.Lock()
+	defer s.connectsMu.Unlock()
+
+	s.connects[sessionID] = &connectSession{
+		org: org,
+		SessionStatus: agent.SessionStatus{
+			ID:      sessionID.String(),
+			Network: network,
+			Target:  target,
+			Since:   time.Now(),
+		},
+	}
+
+	return func() {
+		s.connectsMu.Lock()
+		defer s.connectsMu.Unlock()
+
+		delete(s.connects, sessionID)
+	}
+}
+
+// connectsByOrg returns the proxied connections, oldest first, by
+// organization.
+func (s *server) connectsByOrg() map[string][]agent.SessionStatus {
+	s.connectsMu.Lock()
+	defer s.connectsMu.Unlock()
+
+	ret := make(map[string][]agent.SessionStatus)
+	for _, cs := range s.connects {
+		ret[cs.org] = append(ret[cs.org], cs.SessionStatus)
+	}
+
+	for _, sessions := range ret {
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].Since.Before(sessions[j].Since)
+		})
+	}
+
+	return ret
+}
+
+// status reports on the agent and its tunnels, ordered by organization.
+func (s *server) status() agent.Status {
+	connects := s.connectsByOrg()
+	ssh := s.sshStatus()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := agent.Status{
+		PingResponse: agent.PingResponse{
+			Version:    buildinfo.Version(),
+			PID:        os.Getpid(),
+			Background: s.Options.Background,
+		},
+		SSH: ssh,
+	}
+
+	for slug, tunnel := range s.tunnels {
+		st.Tunnels = append(st.Tunnels, s.tunnelStatus(slug, tunnel, connects[slug]))
+	}
+
+	sort.Slice(st.Tunnels, func(i, j int) bool {
+		return st.Tunnels[i].Org < st.Tunnels[j].Org
+	})
+
+	return st
+}
+
+// tunnelStatus reports on the tunnel. The caller must hold s.mu, which keeps
+// the tunnel from being closed meanwhile.
+func (s *server) tunnelStatus(slug string, tunnel *wg.Tunnel, sessions []agent.SessionStatus) agent.TunnelStatus {
+	ts := agent.TunnelStatus{
+		Org:       slug,
+		Sessions:  sessions,
+		LastUsed:  s.lastUsed[slug],
+		Pinned:    s.isPinned(slug),
+		Transport: tunnel.Transport(),
+	}
+
+	if peer := tunnel.State; peer != nil {
+		ts.PeerIP = peer.Peer.Peerip
+		ts.Endpoint = peer.Peer.Endpointip
+	}
+
+	stats, err := tunnel.Stats()
+	if err != nil {
+		s.printf("failed reading stats of %q: %v", slug, err)
+
+		return ts
+	}
+
+	if stats.Endpoint != "" {
+		ts.Endpoint = stats.Endpoint
+	}
+	ts.BytesIn = stats.BytesIn
+	ts.BytesOut = stats.BytesOut
+	ts.LastHandshake = stats.LastHandshake
+	ts.DNSQueries = stats.DNSQueries
+	ts.WebsocketReconnects = stats.WebsocketReconnects
+
+	return ts
+}
+
+// writeMetrics writes the status in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, st agent.Status) error {
+	var b strings.Builder
+
+	metric := func(name, typ, help string, value func(agent.TunnelStatus) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+
+		for _, ts := range st.Tunnels {
+			fmt.Fprintf(&b, "%s{org=\"%s\"} %g\n", name, labelEscaper.Replace(ts.Org), value(ts))
+		}
+	}
+
+	fmt.Fprintf(&b, "# HELP fly_agent_tunnels Number of open tunnels.\n# TYPE fly_agent_tunnels gauge\nfly_agent_tunnels %d\n",
+		len(st.Tunnels))
+
+	metric("fly_agent_tunnel_received_bytes_total", "counter", "Bytes received from the peer of the tunnel.",
+		func(ts agent.TunnelStatus) float64 { return float64(ts.BytesIn) })
+	metric("fly_agent_tunnel_sent_bytes_total", "counter", "Bytes sent to the peer of the tunnel.",
+		func(ts agent.TunnelStatus) float64 { return float64(ts.BytesOut) })
+	metric("fly_agent_tunnel_last_handshake_timestamp_seconds", "gauge", "Time of the latest handshake with the peer of the tunnel.",
+		func(ts agent.TunnelStatus) float64 {
+			if ts.LastHandshake.IsZero() {
+				return 0
+			}
+
+			return float64(ts.LastHandshake.UnixNano()) / 1e9
+		})
+	metric("fly_agent_tunnel_dns_queries_total", "counter", "DNS queries sent through the tunnel.",
+		func(ts agent.TunnelStatus) float64 { return float64(ts.DNSQueries) })
+	metric("fly_agent_tunnel_websocket_reconnects_total", "counter", "Reconnects of the websocket of tunnels carried over websockets.",
+		func(ts agent.TunnelStatus) float64 { return float64(ts.WebsocketReconnects) })
+	metric("fly_agent_tunnel_sessions", "gauge", "Connections proxied through the tunnel.",
+		func(ts agent.TunnelStatus) float64 { return float64(len(ts.Sessions)) })
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var errMetricsAddrNotLocal = errors.New("metrics address must be a unix socket or a loopback address")
+
+// listenMetrics binds the metrics endpoint. Addresses prefixed with unix: name
+// a unix socket; others must be loopback TCP addresses.
+func listenMetrics(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		if err := removeSocket(path); err != nil {
+			return nil, fmt.Errorf("failed removing existing metrics socket: %w", err)
+		}
+
+		return net.Listen("unix", path)
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, errMetricsAddrNotLocal
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// serveMetrics serves the metrics endpoint on l until ctx is done.
+func (s *server) serveMetrics(ctx context.Context, l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		if err := writeMetrics(w, s.status()); err != nil {
+			s.printf("failed writing metrics: %v", err)
+		}
+	})
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		_ = srv.Close()
+	}()
+
+	s.printf("serving metrics on %s", l.Addr())
+
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed serving metrics: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/azazeal/pause"
+	"github.com/spf13/viper"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/internal/env"
+)
+
+// idleCheckInterval is how often tunnels are checked for idleness.
+const idleCheckInterval = 30 * time.Second
+
+var errTooManyTunnels = errors.New("too many tunnels are open and none of them is idle; disconnect one first")
+
+// closeTunnelUnlocked closes the tunnel of the organization and forgets it.
+// The caller must hold s.mu.
+func (s *server) closeTunnelUnlocked(slug string) {
+	tunnel := s.tunnels[slug]
+	if tunnel == nil {
+		return
+	}
+
+	delete(s.tunnels, slug)
+	delete(s.lastUsed, slug)
+	delete(s.reaped, slug)
+
+	s.dropSSHOf(slug)
+
+	if err := tunnel.Close(); err != nil {
+		s.printf("failed closing tunnel: %v", err)
+	}
+}
+
+// disconnect closes the tunnel of the organization.
+func (s *server) disconnect(slug string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tunnels[slug] == nil {
+		if s.reaped[slug] {
+			// keep it from being rebuilt
+			delete(s.reaped, slug)
+
+			return nil
+		}
+
+		return agent.ErrTunnelUnavailable
+	}
+
+	s.printf("disconnecting %q ...", slug)
+	s.closeTunnelUnlocked(slug)
+
+	return nil
+}
+
+func (s *server) isPinned(slug string) bool {
+	for _, pinned := range s.PinnedOrgs {
+		if pinned == slug {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reapable returns whether the tunnel of the organization may be closed
+// without interrupting anyone, given the connections proxied by organization.
+func (s *server) reapable(slug string, connects map[string][]agent.SessionStatus) bool {
+	return !s.isPinned(slug) && len(connects[slug]) == 0
+}
+
+// makeRoomUnlocked closes the least recently used reapable tunnel when the
+// number of open tunnels is capped and the cap has been reached. The caller
+// must hold s.mu.
+func (s *server) makeRoomUnlocked() error {
+	if s.MaxTunnels <= 0 || len(s.tunnels) < s.MaxTunnels {
+		return nil
+	}
+
+	connects := s.connectsByOrg()
+
+	var (
+		lru  string
+		used time.Time
+	)
+
+	for slug := range s.tunnels {
+		if !s.reapable(slug, connects) {
+			continue
+		}
+
+		if at := s.lastUsed[slug]; lru == "" || at.Before(used) {
+			lru, used = slug, at
+		}
+	}
+
+	if lru == "" {
+		return errTooManyTunnels
+	}
+
+	s.printf("closing tunnel of %q to make room ...", lru)
+	s.closeTunnelUnlocked(lru)
+	s.markReapedUnlocked(lru)
+
+	return nil
+}
+
+// reapIdleTunnels closes the tunnels which have been idle for longer than the
+// idle timeout until ctx is done.
+func (s *server) reapIdleTunnels(ctx context.Context) {
+	for {
+		if pause.For(ctx, idleCheckInterval); ctx.Err() != nil {
+			break
+		}
+
+		s.reapIdle(time.Now().Add(-s.TunnelIdleTimeout))
+	}
+}
+
+// reapIdle closes the reapable tunnels last used before the given time.
+func (s *server) reapIdle(before time.Time) {
+	connects := s.connectsByOrg()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for slug := range s.tunnels {
+		if s.reapable(slug, connects) && s.lastUsed[slug].Before(before) {
+			s.printf("closing idle tunnel of %q ...", slug)
+
+			s.closeTunnelUnlocked(slug)
+			s.markReapedUnlocked(slug)
+		}
+	}
+}
+
+// markReapedUnlocked records the tunnel of the organization was closed by the
+// agent rather than disconnected, so that it's rebuilt when next asked for.
+// The caller must hold s.mu.
+func (s *server) markReapedUnlocked(slug string) {
+	if s.reaped == nil {
+		s.reaped = make(map[string]bool)
+	}
+
+	s.reaped[slug] = true
+}
+
+// wasReaped reports whether the tunnel of the organization was closed by the
+// agent and hasn't been rebuilt since.
+func (s *server) wasReaped(slug string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reaped[slug]
+}
+
+// websocketsReason returns why tunnels carry WireGuard over websockets rather
+// than UDP, which networks blocking UDP require, or nothing when they don't.
+func websocketsReason() string {
+	switch {
+	case viper.GetBool(flyctl.ConfigWireGuardWebsockets):
+		return "forced by the " + flyctl.ConfigWireGuardWebsockets + " setting or FLY_WIREGUARD_WEBSOCKETS"
+	case os.Getenv("WSWG") != "":
+		return "forced by WSWG"
+	case env.IsCI():
+		return "running in CI"
+	default:
+		return ""
+	}
+}
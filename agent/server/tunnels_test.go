@@ -0,0 +1,91 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/wg"
+)
+
+func newTestServer(opt Options, lastUsed map[string]time.Time) *server {
+	opt.Logger = log.New(io.Discard, "", 0)
+
+	s := &server{
+		Options:  opt,
+		tunnels:  make(map[string]*wg.Tunnel),
+		lastUsed: lastUsed,
+		connects: make(map[id]*connectSession),
+	}
+
+	for slug := range lastUsed {
+		s.tunnels[slug] = &wg.Tunnel{}
+	}
+
+	return s
+}
+
+func TestReapIdle(t *testing.T) {
+	now := time.Now()
+
+	s := newTestServer(Options{PinnedOrgs: []string{"pinned"}}, map[string]time.Time{
+		"idle":   now.Add(-time.Hour),
+		"busy":   now.Add(-time.Hour),
+		"pinned": now.Add(-time.Hour),
+		"recent": now,
+	})
+	defer s.trackConnect(1, "busy", "tcp", "[fdaa::3]:22")()
+
+	s.reapIdle(now.Add(-time.Minute))
+
+	assert.Nil(t, s.tunnels["idle"])
+	assert.NotNil(t, s.tunnels["busy"])
+	assert.NotNil(t, s.tunnels["pinned"])
+	assert.NotNil(t, s.tunnels["recent"])
+
+	// reaped tunnels are rebuilt when next asked for
+	assert.True(t, s.wasReaped("idle"))
+	assert.False(t, s.wasReaped("recent"))
+}
+
+func TestMakeRoom(t *testing.T) {
+	now := time.Now()
+
+	s := newTestServer(Options{MaxTunnels: 3, PinnedOrgs: []string{"oldest"}}, map[string]time.Time{
+		"oldest": now.Add(-3 * time.Hour),
+		"older":  now.Add(-2 * time.Hour),
+		"old":    now.Add(-time.Hour),
+	})
+
+	require.NoError(t, s.makeRoomUnlocked())
+	assert.Len(t, s.tunnels, 2)
+	assert.Nil(t, s.tunnels["older"])
+
+	// below the cap, nothing is closed
+	require.NoError(t, s.makeRoomUnlocked())
+	assert.Len(t, s.tunnels, 2)
+
+	s.MaxTunnels = 2
+	defer s.trackConnect(1, "old", "tcp", "[fdaa::3]:22")()
+
+	assert.ErrorIs(t, s.makeRoomUnlocked(), errTooManyTunnels)
+	assert.NoError(t, s.disconnect("old"))
+	assert.Len(t, s.tunnels, 1)
+}
+
+func TestWebsocketsReason(t *testing.T) {
+	t.Cleanup(func() { viper.Set(flyctl.ConfigWireGuardWebsockets, nil) })
+
+	viper.Set(flyctl.ConfigWireGuardWebsockets, true)
+	assert.Contains(t, websocketsReason(), flyctl.ConfigWireGuardWebsockets)
+
+	viper.Set(flyctl.ConfigWireGuardWebsockets, false)
+	t.Setenv("WSWG", "1")
+	assert.Equal(t, "forced by WSWG", websocketsReason())
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHCredentialsFunc returns the certificate and private key to connect to SSH
+// servers with.
+type SSHCredentialsFunc func(ctx context.Context) (cert, privateKey string, err error)
+
+// SSHMultiplexer is implemented by the Dialers of agents which keep the SSH
+// connections they're asked for open and share them among their clients.
+type SSHMultiplexer interface {
+	// DialSSH returns a client of the SSH server at addr, which shares the
+	// connection the agent keeps to it as user. The agent checks the
+	// credentials are valid for the connection before sharing it.
+	DialSSH(ctx context.Context, addr, user string, credentials SSHCredentialsFunc) (*ssh.Client, error)
+}
+
+func (d *dialer) DialSSH(ctx context.Context, addr, user string, credentials SSHCredentialsFunc) (*ssh.Client, error) {
+	return d.client.SSH(ctx, d.slug, addr, user, credentials)
+}
+
+// SSH returns a client of the SSH server at addr, reached through the tunnel
+// of the organization, which shares the connection the agent keeps to it as
+// user. Agents which don't share SSH connections return ErrUnsupportedCommand
+// or ErrSSHNotShared.
+func (c *Client) SSH(ctx context.Context, slug, addr, user string, credentials SSHCredentialsFunc) (*ssh.Client, error) {
+	conn, err := c.dialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.version < 2 {
+		// version 1 can't carry credentials, which contain spaces
+		_ = conn.Close()
+
+		return nil, ErrUnsupportedCommand
+	}
+
+	cert, privateKey, err := credentials(ctx)
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	if _, err = conn.call("ssh", slug, addr, user, cert, privateKey); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	// the agent serves SSH over the connection
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	sc, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // the agent's socket is trusted
+		Timeout:         10 * time.Second,
+	})
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("failed ssh handshake with agent: %w", err)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sc, chans, reqs), nil
+}
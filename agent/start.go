@@ -155,7 +155,7 @@ func waitForClient(ctx context.Context) (*Client, error) {
 	for ctx.Err() == nil {
 		pause.For(ctx, 50*time.Millisecond)
 
-		if c, err := DefaultClient(ctx); err == nil {
+		if c, err := Dial(ctx, "unix", PathToSocket()); err == nil {
 			return c, nil
 		}
 	}
@@ -166,6 +166,10 @@ func (c *Client) GetVolume(ctx context.Context, volID string) (Volume *Volume, e
 				host {
 					id
 				}
+				attachedMachine {
+					id
+					name
+				}
 			}
 		}
 	}`
@@ -212,3 +216,76 @@ func (c *Client) GetVolumeSnapshots(ctx context.Context, volID string) ([]Snapsh
 
 	return data.Volume.Snapshots.Nodes, nil
 }
+
+func (c *Client) GetVolumeSnapshot(ctx context.Context, snapshotID string) (*Snapshot, error) {
+	query := `
+	query($id: ID!) {
+		snapshot: node(id: $id) {
+			... on VolumeSnapshot {
+				id
+				size
+				digest
+				createdAt
+				volume {
+					id
+					sizeGb
+				}
+			}
+		}
+	}`
+
+	req := c.NewRequest(query)
+
+	req.Var("id", snapshotID)
+
+	data, err := c.RunWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Snapshot, nil
+}
+
+func (c *Client) CreateVolumeSnapshot(ctx context.Context, volID string) error {
+	query := `
+		mutation($input: CreateVolumeSnapshotInput!) {
+			createVolumeSnapshot(input: $input) {
+				volume {
+					id
+				}
+			}
+		}
+	`
+
+	input := CreateVolumeSnapshotInput{VolumeID: volID}
+
+	req := c.NewRequest(query)
+
+	req.Var("input", input)
+
+	_, err := c.RunWithContext(ctx, req)
+
+	return err
+}
+
+func (c *Client) DeleteVolumeSnapshot(ctx context.Context, snapshotID string) error {
+	query := `
+		mutation($input: DeleteVolumeSnapshotInput!) {
+			deleteVolumeSnapshot(input: $input) {
+				volume {
+					id
+				}
+			}
+		}
+	`
+
+	input := DeleteVolumeSnapshotInput{SnapshotID: snapshotID}
+
+	req := c.NewRequest(query)
+
+	req.Var("input", input)
+
+	_, err := c.RunWithContext(ctx, req)
+
+	return err
+}
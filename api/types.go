@@ -39,6 +39,7 @@ type Query struct {
 	OrganizationDetails OrganizationDetails
 	Build               Build
 	Volume              Volume
+	Snapshot            Snapshot
 	Domain              *Domain
 
 	Node  interface{}
@@ -368,6 +369,7 @@ type Snapshot struct {
 	Digest    string
 	Size      string
 	CreatedAt time.Time
+	Volume    *Volume `json:",omitempty"`
 }
 
 type Volume struct {
@@ -439,6 +441,14 @@ type DeleteVolumePayload struct {
 	App App
 }
 
+type CreateVolumeSnapshotInput struct {
+	VolumeID string `json:"volumeId"`
+}
+
+type DeleteVolumeSnapshotInput struct {
+	SnapshotID string `json:"snapshotId"`
+}
+
 type AppCertsCompact struct {
 	Certificates struct {
 		Nodes []AppCertificateCompact
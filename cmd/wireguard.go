@@ -6,15 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/dustin/go-humanize"
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
+	"github.com/skip2/go-qrcode"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/superfly/flyctl/agent"
@@ -25,6 +27,7 @@ import (
 	"github.com/superfly/flyctl/flyctl"
 	"github.com/superfly/flyctl/internal/wireguard"
 	"github.com/superfly/flyctl/terminal"
+	"github.com/superfly/flyctl/wg"
 )
 
 func newWireGuardCommand(client *client.Client) *Command {
@@ -36,10 +39,40 @@ func newWireGuardCommand(client *client.Client) *Command {
 	}
 
 	child(cmd, runWireGuardList, "wireguard.list").Args = cobra.MaximumNArgs(1)
-	child(cmd, runWireGuardCreate, "wireguard.create").Args = cobra.MaximumNArgs(4)
+	create := child(cmd, runWireGuardCreate, "wireguard.create")
+	create.Args = cobra.MaximumNArgs(4)
+	create.AddStringFlag(StringFlagOpts{
+		Name:        "format",
+		Default:     wg.FormatWgQuick,
+		Description: "Config format: wg-quick, networkmanager, systemd-networkd or qr",
+	})
+	create.AddStringFlag(StringFlagOpts{
+		Name:        "dns-only",
+		Description: "Only print a split DNS snippet for .internal names, for resolved or dnsmasq, without creating a peer",
+	})
 	child(cmd, runWireGuardRemove, "wireguard.remove").Args = cobra.MaximumNArgs(2)
 	child(cmd, runWireGuardStat, "wireguard.status").Args = cobra.MaximumNArgs(2)
 	child(cmd, runWireGuardResetPeer, "wireguard.reset").Args = cobra.MaximumNArgs(1)
+	prune := child(cmd, runWireGuardPrune, "wireguard.prune")
+	prune.Args = cobra.MaximumNArgs(1)
+	prune.AddStringFlag(StringFlagOpts{
+		Name:        "older-than",
+		Default:     "30d",
+		Description: "Prune peers inactive for longer than this, in days (30d) or as a duration (12h)",
+	})
+	prune.AddBoolFlag(BoolFlagOpts{
+		Name:        "agent-only",
+		Description: "Only prune peers created by flyctl agents",
+	})
+	prune.AddBoolFlag(BoolFlagOpts{
+		Name:        "local",
+		Description: "Only prune peers created on this machine",
+	})
+	prune.AddBoolFlag(BoolFlagOpts{
+		Name:        "yes",
+		Shorthand:   "y",
+		Description: "Prune without confirmation",
+	})
 	child(cmd, runWireGuardWebSockets, "wireguard.websockets").Args = cobra.ExactArgs(1)
 
 	tokens := child(cmd, nil, "wireguard.token")
@@ -129,46 +162,87 @@ func runWireGuardList(cmdCtx *cmdctx.CmdContext) error {
 }
 
 func generateWgConf(peer *api.CreatedWireGuardPeer, privkey string, w io.Writer) {
-	templateStr := `
-[Interface]
-PrivateKey = {{.Meta.Privkey}}
-Address = {{.Peer.Peerip}}/120
-DNS = {{.Meta.DNS}}
-
-[Peer]
-PublicKey = {{.Peer.Pubkey}}
-AllowedIPs = {{.Meta.AllowedIPs}}
-Endpoint = {{.Peer.Endpointip}}:51820
-PersistentKeepalive = 15
-
-`
-	data := struct {
-		Peer *api.CreatedWireGuardPeer
-		Meta struct {
-			Privkey    string
-			AllowedIPs string
-			DNS        string
-		}
-	}{
-		Peer: peer,
+	state := &wg.WireGuardState{
+		LocalPrivate: privkey,
+		Peer:         *peer,
 	}
 
-	addr := net.ParseIP(peer.Peerip).To16()
-	for i := 6; i < 16; i++ {
-		addr[i] = 0
+	state.Export(w, wg.FormatWgQuick)
+}
+
+// formatQR denotes the QR code format, which encodes the wg-quick config for
+// mobile clients to scan.
+const formatQR = "qr"
+
+func validateWgFormat(format string) error {
+	switch format {
+	case wg.FormatWgQuick, wg.FormatNetworkManager, wg.FormatNetworkd, formatQR:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q; expected one of %s, %s, %s or %s",
+			format, wg.FormatWgQuick, wg.FormatNetworkManager, wg.FormatNetworkd, formatQR)
 	}
+}
 
-	// BUG(tqbf): can't stay this way
-	data.Meta.AllowedIPs = fmt.Sprintf("%s/48", addr)
+// writeWgConf writes the peer's config in the given format. QR codes are
+// written as PNG images to files and drawn on terminals otherwise.
+// systemd-networkd configs written to files are split into a .netdev and a
+// .network next to each other.
+func writeWgConf(state *wg.WireGuardState, format string, w io.Writer, filename string) error {
+	switch format {
+	case formatQR:
+		var conf bytes.Buffer
+		if err := state.Export(&conf, wg.FormatWgQuick); err != nil {
+			return err
+		}
 
-	addr[15] = 3
+		qr, err := qrcode.New(conf.String(), qrcode.Medium)
+		if err != nil {
+			return fmt.Errorf("failed generating QR code: %w", err)
+		}
 
-	data.Meta.DNS = addr.String()
-	data.Meta.Privkey = privkey
+		if filename == "" {
+			_, err = io.WriteString(w, qr.ToSmallString(false))
 
-	tmpl := template.Must(template.New("name").Parse(templateStr))
+			return err
+		}
+
+		png, err := qr.PNG(512)
+		if err != nil {
+			return fmt.Errorf("failed generating QR code: %w", err)
+		}
+
+		_, err = w.Write(png)
+
+		return err
+	case wg.FormatNetworkd:
+		if filename == "" {
+			return state.Export(w, format)
+		}
 
-	tmpl.Execute(w, &data)
+		netdev, network, err := state.NetworkdConfig()
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, netdev); err != nil {
+			return err
+		}
+
+		base := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+		f, err := os.OpenFile(base+".network", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.WriteString(f, network)
+
+		return err
+	default:
+		return state.Export(w, format)
+	}
 }
 
 func resolveOutputWriter(ctx *cmdctx.CmdContext, idx int, prompt string) (w io.WriteCloser, mustClose bool, err error) {
@@ -254,16 +328,160 @@ func runWireGuardResetPeer(ctx *cmdctx.CmdContext) error {
 		return err
 	}
 
-	fmt.Printf("New WireGuard peer for organization '%s': '%s'\n", org.Slug, conf.WireGuardState.Name)
+	fmt.Printf("Rotated the keys of WireGuard peer '%s' for organization '%s'\n", conf.WireGuardState.Name, org.Slug)
 	return nil
 }
 
+// stalePeer is a peer runWireGuardPrune removes.
+type stalePeer struct {
+	*api.WireGuardPeer
+	LastActive time.Time
+}
+
+func runWireGuardPrune(cmdCtx *cmdctx.CmdContext) error {
+	ctx := cmdCtx.Command.Context()
+	client := cmdCtx.Client.API()
+
+	age, err := wireguard.ParseAge(cmdCtx.Config.GetString("older-than"))
+	if err != nil {
+		return err
+	}
+
+	org, err := orgByArg(cmdCtx)
+	if err != nil {
+		return err
+	}
+
+	peers, err := client.GetWireGuardPeers(ctx, org.Slug)
+	if err != nil {
+		return err
+	}
+
+	registered, err := wireguard.RegisteredPeers()
+	if err != nil {
+		return err
+	}
+
+	createdAt := map[string]time.Time{}
+	for _, peer := range registered {
+		if peer.Org == org.Slug {
+			createdAt[peer.Name] = peer.CreatedAt
+		}
+	}
+
+	// the peer this machine's agent uses is reset rather than pruned
+	var current string
+	if states, err := wireguard.GetWireGuardState(); err == nil && states[org.Slug] != nil {
+		current = states[org.Slug].Name
+	}
+
+	var (
+		now     = time.Now()
+		cutoff  = now.Add(-age)
+		stale   []stalePeer
+		unknown []string
+	)
+
+	for _, peer := range peers {
+		if peer.Name == current {
+			continue
+		}
+		if cmdCtx.Config.GetBool("agent-only") && !wireguard.IsAgentPeer(peer.Name) {
+			continue
+		}
+
+		created, local := createdAt[peer.Name]
+		if cmdCtx.Config.GetBool("local") && !local {
+			continue
+		}
+
+		// a peer whose status can't be fetched may well be in use, so it's
+		// kept rather than judged by its age alone
+		status, err := client.GetWireGuardPeerStatus(ctx, org.Slug, peer.Name)
+		if err != nil {
+			terminal.Debugf("failed fetching status of peer %s: %v\n", peer.Name, err)
+			unknown = append(unknown, peer.Name)
+
+			continue
+		}
+
+		last, ok := wireguard.LastActive(status, now)
+		if !ok {
+			if last, ok = created, local; !ok {
+				last, ok = wireguard.NameCreatedAt(peer.Name)
+			}
+		}
+
+		if !ok {
+			terminal.Debugf("can't tell when peer %s was last active; keeping it\n", peer.Name)
+			continue
+		}
+
+		if last.Before(cutoff) {
+			stale = append(stale, stalePeer{WireGuardPeer: peer, LastActive: last})
+		}
+	}
+
+	if len(unknown) > 0 {
+		fmt.Fprintf(cmdCtx.IO.ErrOut, "Keeping %d peers whose status couldn't be fetched: %s\n",
+			len(unknown), strings.Join(unknown, ", "))
+	}
+
+	if len(stale) == 0 {
+		fmt.Fprintf(cmdCtx.Out, "No WireGuard peers of organization %s are stale\n", org.Slug)
+		return nil
+	}
+
+	table := tablewriter.NewWriter(cmdCtx.Out)
+	table.SetHeader([]string{"Name", "Region", "Peer IP", "Last Active"})
+	for _, peer := range stale {
+		table.Append([]string{peer.Name, peer.Region, peer.Peerip, humanize.Time(peer.LastActive)})
+	}
+	table.Render()
+
+	if !cmdCtx.Config.GetBool("yes") && !confirm(fmt.Sprintf("Remove these %d peers?", len(stale))) {
+		return nil
+	}
+
+	var removed int
+	for _, peer := range stale {
+		if err := client.RemoveWireGuardPeer(ctx, org, peer.Name); err != nil {
+			fmt.Fprintf(cmdCtx.IO.ErrOut, "failed removing peer %s: %v\n", peer.Name, err)
+			continue
+		}
+		removed++
+
+		if _, ok := createdAt[peer.Name]; ok {
+			if err := wireguard.ForgetPeer(org.Slug, peer.Name); err != nil {
+				terminal.Debugf("failed forgetting peer %s: %v\n", peer.Name, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(cmdCtx.Out, "Removed %d of %d stale peers\n", removed, len(stale))
+
+	if removed < len(stale) {
+		return fmt.Errorf("failed removing %d peers", len(stale)-removed)
+	}
+
+	return wireguard.PruneInvalidPeers(ctx, client)
+}
+
 func runWireGuardCreate(ctx *cmdctx.CmdContext) error {
+	format := ctx.Config.GetString("format")
+	if err := validateWgFormat(format); err != nil {
+		return err
+	}
+
 	org, err := orgByArg(ctx)
 	if err != nil {
 		return err
 	}
 
+	if resolver := ctx.Config.GetString("dns-only"); resolver != "" {
+		return runWireGuardSplitDNS(ctx, org, resolver)
+	}
+
 	var region string
 	var name string
 
@@ -280,14 +498,16 @@ func runWireGuardCreate(ctx *cmdctx.CmdContext) error {
 		return err
 	}
 
-	data := &state.Peer
-
 	fmt.Printf(`
 !!!! WARNING: Output includes private key. Private keys cannot be recovered !!!!
 !!!! after creating the peer; if you lose the key, you'll need to remove    !!!!
 !!!! and re-add the peering connection.                                     !!!!
 `)
 
+	if format == wg.FormatNetworkd && len(ctx.Args) < 4 {
+		fmt.Println("For systemd-networkd, a filename such as fly.netdev also writes fly.network next to it.")
+	}
+
 	w, shouldClose, err := resolveOutputWriter(ctx, 3, "Filename to store WireGuard configuration in, or 'stdout': ")
 	if err != nil {
 		return err
@@ -296,16 +516,42 @@ func runWireGuardCreate(ctx *cmdctx.CmdContext) error {
 		defer w.Close()
 	}
 
-	generateWgConf(data, state.LocalPrivate, w)
+	var filename string
+	if shouldClose {
+		filename = w.(*os.File).Name()
+	}
+
+	if err := writeWgConf(state, format, w, filename); err != nil {
+		return err
+	}
 
 	if shouldClose {
-		filename := w.(*os.File).Name()
 		fmt.Printf("Wrote WireGuard configuration to %s; load in your WireGuard client\n", filename)
 	}
 
 	return nil
 }
 
+// runWireGuardSplitDNS prints a snippet which sends queries for .internal
+// names to the organization's DNS server, which is derived from the address
+// of any of its peers.
+func runWireGuardSplitDNS(cmdCtx *cmdctx.CmdContext, org *api.Organization, resolver string) error {
+	ctx := cmdCtx.Command.Context()
+
+	peers, err := cmdCtx.Client.API().GetWireGuardPeers(ctx, org.Slug)
+	if err != nil {
+		return err
+	}
+
+	if len(peers) == 0 {
+		return fmt.Errorf("organization %s has no WireGuard peers; create one first", org.Slug)
+	}
+
+	_, dns := wg.OrgNetwork(peers[0].Peerip)
+
+	return wg.ExportSplitDNS(cmdCtx.Out, resolver, org.Slug, dns)
+}
+
 func runWireGuardRemove(cmdCtx *cmdctx.CmdContext) error {
 	ctx := cmdCtx.Command.Context()
 
@@ -808,19 +808,37 @@ number to operate. This can be found through the volumes list command`,
 		}
 	case "wireguard.create":
 		return KeyStrings{"create [org] [region] [name]", "Add a WireGuard peer connection",
-			`Add a WireGuard peer connection to an organization`,
+			`Add a WireGuard peer connection to an organization
+
+The config is written in wg-quick format by default. --format networkmanager
+writes a NetworkManager keyfile, --format systemd-networkd a .netdev and a
+.network, and --format qr a QR code of the wg-quick config for mobile clients,
+drawn on the terminal or saved as a PNG image.
+
+--dns-only resolved or --dns-only dnsmasq prints a snippet which sends queries
+for .internal names to the organization's DNS server, without creating a peer.`,
 		}
 	case "wireguard.list":
 		return KeyStrings{"list [<org>]", "List all WireGuard peer connections",
 			`List all WireGuard peer connections`,
 		}
+	case "wireguard.prune":
+		return KeyStrings{"prune [org]", "Remove stale WireGuard peers",
+			`Remove the WireGuard peers of an organization which haven't been active
+for longer than --older-than, judging by their latest handshake or, lacking one,
+their creation time. Peers whose status can't be fetched are kept and reported.
+The peer this machine's agent uses is never pruned; reset it instead.
+--agent-only restricts pruning to peers flyctl agents created, and --local to
+those created on this machine.`,
+		}
 	case "wireguard.remove":
 		return KeyStrings{"remove [org] [name]", "Remove a WireGuard peer connection",
 			`Remove a WireGuard peer connection from an organization`,
 		}
 	case "wireguard.reset":
 		return KeyStrings{"reset [org]", "Reset WireGuard peer connection for an organization",
-			`Reset WireGuard peer connection for an organization`,
+			`Reset WireGuard peer connection for an organization, rotating the keys
+of its peer, which keeps its name and region`,
 		}
 	case "wireguard.status":
 		return KeyStrings{"status [org] [name]", "Get status a WireGuard peer connection",
@@ -852,7 +870,8 @@ number to operate. This can be found through the volumes list command`,
 		}
 	case "wireguard.websockets":
 		return KeyStrings{"websockets [enable/disable]", "Enable or disable WireGuard tunneling over WebSockets",
-			`Enable or disable WireGuard tunneling over WebSockets`,
+			`Enable or disable WireGuard tunneling over WebSockets, for networks
+which block UDP. Setting FLY_WIREGUARD_WEBSOCKETS=1 enables it as well.`,
 		}
 	}
 	panic("unknown command key " + key)
@@ -18,6 +18,11 @@ const (
 	ConfigWireGuardState      = "wire_guard_state"
 	ConfigWireGuardWebsockets = "wire_guard_websockets"
 
+	ConfigAgentIdleTimeout = "agent_idle_timeout"
+	ConfigAgentMaxTunnels  = "agent_max_tunnels"
+	ConfigAgentPinnedOrgs  = "agent_pinned_orgs"
+	ConfigAgentSocket      = "agent_socket"
+
 	ConfigRegistryHost = "registry_host"
 )
 
@@ -65,6 +65,7 @@ func initViper() {
 
 	viper.BindEnv(ConfigVerboseOutput, "VERBOSE")
 	viper.BindEnv(ConfigGQLErrorLogging, "GQLErrorLogging")
+	viper.BindEnv(ConfigWireGuardWebsockets, "FLY_WIREGUARD_WEBSOCKETS", "FLY_WIRE_GUARD_WEBSOCKETS")
 
 	viper.SetEnvPrefix("FLY")
 	viper.AutomaticEnv()
@@ -121,7 +122,7 @@ func GetAPIToken() string {
 	return viperAuth
 }
 
-var writeableConfigKeys = []string{ConfigAPIToken, ConfigInstaller, ConfigWireGuardState, ConfigWireGuardWebsockets, BuildKitNodeID}
+var writeableConfigKeys = []string{ConfigAPIToken, ConfigInstaller, ConfigWireGuardState, ConfigWireGuardWebsockets, BuildKitNodeID, ConfigAgentSocket}
 
 func SaveConfig() error {
 	out := map[string]interface{}{}
@@ -46,6 +46,7 @@ require (
 	github.com/pkg/sftp v1.13.5
 	github.com/samber/lo v1.27.0
 	github.com/segmentio/textio v1.2.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/pflag v1.0.5
@@ -50,6 +50,10 @@ func Run(ctx context.Context, io *iostreams.IOStreams, args ...string) int {
 	default:
 		printError(io.ErrOut, cs, err)
 
+		if code := flyerr.GetErrorExitCode(err); code != 0 {
+			return code
+		}
+
 		return 1
 	}
 }
@@ -29,6 +29,10 @@ func New() (cmd *cobra.Command) {
 	cmd.AddCommand(
 		newRun(),
 		newPing(),
+		newStatus(),
+		newDisconnect(),
+		newInstallService(),
+		newDNS(),
 		newStart(),
 		newStop(),
 		newRestart(),
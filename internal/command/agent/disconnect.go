@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func newDisconnect() (cmd *cobra.Command) {
+	const (
+		short = "Close the tunnel of an organization"
+		long  = short + `, interrupting the connections it carries. Unlike
+'fly agent stop', the agent and the tunnels of other organizations stay up.
+`
+		usage = "disconnect <org>"
+	)
+
+	cmd = command.New(usage, short, long, runDisconnect)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	return
+}
+
+func runDisconnect(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	slug := flag.FirstArg(ctx)
+	if err = client.Disconnect(ctx, slug); err != nil {
+		return fmt.Errorf("failed disconnecting %s: %w", slug, err)
+	}
+
+	fmt.Fprintf(iostreams.FromContext(ctx).Out, "Disconnected %s\n", slug)
+
+	return
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/app"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/dnsforward"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func newDNS() (cmd *cobra.Command) {
+	const (
+		short = "Run a local DNS server which resolves .internal and .flycast names"
+		long  = `Run a local DNS server which resolves the .internal and .flycast names of an
+organization through its WireGuard tunnel and other names upstream, caching
+responses. Point tools such as psql, curl and browsers to it to reach private
+hosts while 'fly proxy --socks5' or a WireGuard peer is up.
+
+The organization is that of the current app unless one is set with --org.
+`
+	)
+
+	cmd = command.New("dns", short, long, runDNS,
+		command.RequireSession,
+		command.LoadAppNameIfPresent,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Org(),
+		flag.String{
+			Name:        "listen",
+			Default:     "127.0.0.1:5353",
+			Description: "Address to serve DNS on, over both UDP and TCP",
+		},
+		flag.String{
+			Name:        "upstream",
+			Description: "Server to resolve other names with. Defaults to the first one /etc/resolv.conf lists",
+		},
+		flag.Int{
+			Name:        "cache-size",
+			Default:     dnsforward.DefaultCacheSize,
+			Description: "Maximum number of cached responses; 0 disables caching",
+		},
+	)
+
+	return
+}
+
+func runDNS(ctx context.Context) (err error) {
+	apiClient := client.FromContext(ctx).API()
+
+	orgSlug := flag.GetOrg(ctx)
+	if orgSlug == "" {
+		appName := app.NameFromContext(ctx)
+		if appName == "" {
+			return fmt.Errorf("an organization is required; set one with --org or run from within an app's directory")
+		}
+
+		app, err := apiClient.GetAppBasic(ctx, appName)
+		if err != nil {
+			return fmt.Errorf("failed fetching app %s: %w", appName, err)
+		}
+		orgSlug = app.Organization.Slug
+	}
+
+	var ac *agent.Client
+	if ac, err = agent.Establish(ctx, apiClient); err != nil {
+		return
+	}
+
+	var dialer agent.Dialer
+	if dialer, err = ac.ConnectToTunnel(ctx, orgSlug); err != nil {
+		return
+	}
+
+	listen := flag.GetString(ctx, "listen")
+
+	upstream := flag.GetString(ctx, "upstream")
+	if upstream == "" {
+		upstream = dnsforward.SystemUpstream(listen)
+	} else if _, _, err := net.SplitHostPort(upstream); err != nil {
+		upstream = net.JoinHostPort(upstream, "53")
+	}
+
+	fwd := &dnsforward.Forwarder{
+		Dialer:     dialer,
+		Nameserver: net.JoinHostPort(dialer.Config().DNS.String(), "53"),
+		Upstream:   upstream,
+	}
+
+	if size := flag.GetInt(ctx, "cache-size"); size > 0 {
+		fwd.Cache = dnsforward.NewCache(size)
+	}
+
+	host, port, _ := net.SplitHostPort(listen)
+
+	io := iostreams.FromContext(ctx)
+	fmt.Fprintf(io.Out, "Resolving .internal and .flycast names of %s on %s, other names through %s\n", orgSlug, listen, upstream)
+	fmt.Fprintf(io.Out, "Try: dig @%s -p %s <app>.internal AAAA\n", host, port)
+
+	return dnsforward.ListenAndServe(ctx, listen, fwd)
+}
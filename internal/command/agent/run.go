@@ -2,17 +2,22 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/superfly/flyctl/agent/server"
 
 	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flyctl"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/filemu"
 	"github.com/superfly/flyctl/internal/flag"
@@ -30,11 +35,44 @@ func newRun() (cmd *cobra.Command) {
 	cmd.Args = cobra.MaximumNArgs(1)
 	cmd.Aliases = []string{"daemon-start"}
 
+	flag.Add(cmd,
+		flag.String{
+			Name:        "socket",
+			Description: "Path of the socket to listen on, for agents run as a service. Ignored when the service manager passes the socket",
+		},
+		flag.String{
+			Name:        "log-file",
+			Description: "Path of the file to append logs to, besides stdout",
+		},
+		flag.String{
+			Name:        "metrics-addr",
+			Description: "Serve tunnel metrics in the Prometheus text format on this loopback address or unix:<path> socket. Defaults to $FLY_AGENT_METRICS_ADDR",
+		},
+		flag.String{
+			Name:        "idle-timeout",
+			Description: "Close tunnels which carry no connections after they've been unused for this long, e.g. 30m. Defaults to the agent_idle_timeout setting; tunnels stay up when unset",
+		},
+		flag.Int{
+			Name:        "max-tunnels",
+			Description: "Maximum number of open tunnels; the least recently used idle one is closed to make room. Defaults to the agent_max_tunnels setting",
+		},
+		flag.StringSlice{
+			Name:        "pin",
+			Description: "Organizations whose tunnels are never closed for idleness or to make room. Defaults to the agent_pinned_orgs setting",
+		},
+	)
+
 	return
 }
 
 func run(ctx context.Context) error {
+	// agents started on demand are passed their log file as an argument
 	logPath := flag.FirstArg(ctx)
+	background := logPath != ""
+	if path := flag.GetString(ctx, "log-file"); path != "" {
+		logPath = path
+	}
+
 	logger, closeLogger, err := setupLogger(logPath)
 	if err != nil {
 		err = fmt.Errorf("failed setting up logger: %w", err)
@@ -51,27 +89,77 @@ func run(ctx context.Context) error {
 		return client.ErrNoAuthToken
 	}
 
-	unlock, err := lock(ctx, logger)
+	socket := flag.GetString(ctx, "socket")
+	if socket == "" {
+		socket = socketPath(ctx)
+	}
+
+	unlock, err := lock(ctx, logger, socket)
 	if err != nil {
 		return err
 	}
 	defer unlock()
 
+	// agents started in the background inherit the environment, not flags
+	metricsAddr := flag.GetString(ctx, "metrics-addr")
+	if metricsAddr == "" {
+		metricsAddr = os.Getenv("FLY_AGENT_METRICS_ADDR")
+	}
+
 	opt := server.Options{
-		Socket:     socketPath(ctx),
-		Logger:     logger,
-		Client:     apiClient.API(),
-		Background: logPath != "",
-		ConfigFile: state.ConfigFile(ctx),
+		Socket:      socket,
+		Logger:      logger,
+		Client:      apiClient.API(),
+		Background:  background,
+		ConfigFile:  state.ConfigFile(ctx),
+		MetricsAddr: metricsAddr,
+	}
+
+	if err := tunnelOptions(ctx, &opt); err != nil {
+		logger.Print(err)
+
+		return err
 	}
 
 	return server.Run(ctx, opt)
 }
 
+// tunnelOptions sets the tunnel lifecycle options off the flags or, for those
+// which aren't set, the config file. The latter may also be set via the
+// environment, e.g. FLY_AGENT_IDLE_TIMEOUT, which agents started in the
+// background inherit.
+func tunnelOptions(ctx context.Context, opt *server.Options) error {
+	flags := flag.FromContext(ctx)
+
+	if flags.Changed("idle-timeout") {
+		d, err := time.ParseDuration(flag.GetString(ctx, "idle-timeout"))
+		if err != nil {
+			return fmt.Errorf("invalid idle timeout: %w", err)
+		}
+		opt.TunnelIdleTimeout = d
+	} else {
+		opt.TunnelIdleTimeout = viper.GetDuration(flyctl.ConfigAgentIdleTimeout)
+	}
+
+	if flags.Changed("max-tunnels") {
+		opt.MaxTunnels = flag.GetInt(ctx, "max-tunnels")
+	} else {
+		opt.MaxTunnels = viper.GetInt(flyctl.ConfigAgentMaxTunnels)
+	}
+
+	if flags.Changed("pin") {
+		opt.PinnedOrgs = flag.GetStringSlice(ctx, "pin")
+	} else {
+		opt.PinnedOrgs = viper.GetStringSlice(flyctl.ConfigAgentPinnedOrgs)
+	}
+
+	return nil
+}
+
 func setupLogger(path string) (logger *log.Logger, close func(), err error) {
 	var out io.Writer
 	if path != "" {
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -109,8 +197,23 @@ var (
 	errDupInstance = new(dupInstanceError)
 )
 
-func lock(ctx context.Context, logger *log.Logger) (unlock filemu.UnlockFunc, err error) {
-	switch unlock, err = filemu.Lock(ctx, lockPath); {
+// lockFile returns the path of the file agents serving the socket lock.
+// Agents serving sockets other than the default one, such as those run as a
+// service, lock a file named after the socket in the config directory of the
+// user they run as, since they may not create files next to the socket.
+func lockFile(ctx context.Context, socket string) string {
+	if socket == socketPath(ctx) {
+		return lockPath
+	}
+
+	sum := sha256.Sum256([]byte(socket))
+
+	return filepath.Join(state.ConfigDirectory(ctx), "agent-"+hex.EncodeToString(sum[:8])+".lock")
+}
+
+// lock keeps other agents from serving the socket.
+func lock(ctx context.Context, logger *log.Logger, socket string) (unlock filemu.UnlockFunc, err error) {
+	switch unlock, err = filemu.Lock(ctx, lockFile(ctx, socket)); {
 	case err == nil:
 		break // all done
 	case ctx.Err() != nil:
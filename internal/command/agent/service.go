@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+const (
+	serviceName      = "fly-agent"
+	systemSocketPath = "/run/fly-agent.sock"
+	systemUnitDir    = "/etc/systemd/system"
+	userSocketMode   = "0600"
+	systemSocketMode = "0660"
+)
+
+func newInstallService() (cmd *cobra.Command) {
+	const (
+		short = "Install the Fly agent as a systemd service"
+		long  = short + `, started on demand through socket activation.
+
+By default, a user service listening on the socket flyctl looks for is
+installed. With --system, a system service is installed instead, which the
+users of shared machines, such as CI runners, may point flyctl to by setting
+FLY_AGENT_SOCKET or the agent_socket setting to its socket.
+`
+	)
+
+	cmd = command.New("install-service", short, long, runInstallService)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "system",
+			Description: "Install a system service rather than a user one",
+		},
+		flag.String{
+			Name:        "socket",
+			Description: "Path of the socket the service listens on. Defaults to the socket flyctl looks for, or " + systemSocketPath + " for system services",
+		},
+		flag.String{
+			Name:        "log-file",
+			Description: "Path of the file the service appends logs to, besides the journal",
+		},
+		flag.String{
+			Name:        "user",
+			Description: "User system services run as, whose flyctl credentials they use. Defaults to root",
+		},
+		flag.String{
+			Name:        "group",
+			Description: "Group allowed to connect to the socket of system services",
+		},
+		flag.Bool{
+			Name:        "print",
+			Description: "Print the units instead of installing them",
+		},
+	)
+
+	return
+}
+
+// serviceUnits is what the unit templates render.
+type serviceUnits struct {
+	System     bool
+	Exec       string
+	Socket     string
+	SocketMode string
+	Group      string
+	User       string
+	LogFile    string
+}
+
+var (
+	socketUnitTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description=Fly.io agent socket
+
+[Socket]
+ListenStream={{.Socket}}
+SocketMode={{.SocketMode}}
+{{- with .Group}}
+SocketGroup={{.}}
+{{- end}}
+
+[Install]
+WantedBy=sockets.target
+`))
+
+	serviceUnitTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Fly.io agent, which manages the WireGuard tunnels of flyctl
+Requires=` + serviceName + `.socket
+After=network-online.target ` + serviceName + `.socket
+
+[Service]
+ExecStart={{printf "%q" .Exec}} agent run --socket {{printf "%q" .Socket}}
+{{- with .LogFile}} --log-file {{printf "%q" .}}{{end}}
+{{- with .User}}
+User={{.}}
+{{- end}}
+Environment=FLY_NO_UPDATE_CHECK=1
+Restart=on-failure
+
+[Install]
+WantedBy={{if .System}}multi-user.target{{else}}default.target{{end}}
+`))
+)
+
+// render writes the socket and service units.
+func (u *serviceUnits) render(socket, service io.Writer) error {
+	if err := socketUnitTemplate.Execute(socket, u); err != nil {
+		return err
+	}
+
+	return serviceUnitTemplate.Execute(service, u)
+}
+
+var errServiceUnsupported = errors.New("installing the agent as a service requires systemd, which is available on Linux only")
+
+func runInstallService(ctx context.Context) (err error) {
+	if runtime.GOOS != "linux" {
+		return errServiceUnsupported
+	}
+
+	units, err := newServiceUnits(ctx)
+	if err != nil {
+		return
+	}
+
+	io := iostreams.FromContext(ctx)
+
+	if flag.GetBool(ctx, "print") {
+		var socket, service bytes.Buffer
+		if err = units.render(&socket, &service); err == nil {
+			fmt.Fprintf(io.Out, "# %s.socket\n%s\n# %s.service\n%s", serviceName, &socket, serviceName, &service)
+		}
+
+		return
+	}
+
+	dir, err := unitDir(units.System)
+	if err != nil {
+		return
+	}
+
+	if err = writeUnits(dir, units); err != nil {
+		return
+	}
+	fmt.Fprintf(io.Out, "Wrote %s.socket and %s.service to %s\n", serviceName, serviceName, dir)
+
+	systemctl := func(args ...string) error {
+		if !units.System {
+			args = append([]string{"--user"}, args...)
+		}
+
+		cmd := exec.CommandContext(ctx, "systemctl", args...)
+		cmd.Stdout = io.Out
+		cmd.Stderr = io.ErrOut
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed running systemctl %v: %w", args, err)
+		}
+
+		return nil
+	}
+
+	if err = systemctl("daemon-reload"); err != nil {
+		return
+	}
+
+	if err = systemctl("enable", "--now", serviceName+".socket"); err != nil {
+		return
+	}
+
+	fmt.Fprintf(io.Out, "The agent now listens on %s\n", units.Socket)
+
+	if units.Socket == socketPath(ctx) {
+		return
+	}
+
+	// have this user's flyctl find the service
+	viper.Set(flyctl.ConfigAgentSocket, units.Socket)
+	if err = flyctl.SaveConfig(); err != nil {
+		return fmt.Errorf("failed saving the agent socket to the config: %w", err)
+	}
+
+	if units.System {
+		fmt.Fprintf(io.Out, "Other users may use it by setting FLY_AGENT_SOCKET=%s\n", units.Socket)
+	}
+
+	return
+}
+
+func newServiceUnits(ctx context.Context) (*serviceUnits, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed locating flyctl: %w", err)
+	}
+
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, fmt.Errorf("failed locating flyctl: %w", err)
+	}
+
+	units := &serviceUnits{
+		System:     flag.GetBool(ctx, "system"),
+		Exec:       exe,
+		Socket:     flag.GetString(ctx, "socket"),
+		SocketMode: userSocketMode,
+		LogFile:    flag.GetString(ctx, "log-file"),
+	}
+
+	if units.System {
+		units.SocketMode = systemSocketMode
+		units.User = flag.GetString(ctx, "user")
+		units.Group = flag.GetString(ctx, "group")
+
+		if units.Socket == "" {
+			units.Socket = systemSocketPath
+		}
+	} else {
+		if flag.GetString(ctx, "user") != "" || flag.GetString(ctx, "group") != "" {
+			return nil, errors.New("--user and --group apply to system services only")
+		}
+
+		if units.Socket == "" {
+			units.Socket = socketPath(ctx)
+		}
+	}
+
+	for _, path := range []*string{&units.Socket, &units.LogFile} {
+		if *path == "" {
+			continue
+		}
+
+		if *path, err = filepath.Abs(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	return units, nil
+}
+
+func unitDir(system bool) (string, error) {
+	if system {
+		return systemUnitDir, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "systemd", "user"), nil
+}
+
+func writeUnits(dir string, units *serviceUnits) (err error) {
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed creating %s: %w", dir, err)
+	}
+
+	socket, err := os.Create(filepath.Join(dir, serviceName+".socket"))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := socket.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	service, err := os.Create(filepath.Join(dir, serviceName+".service"))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := service.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return units.render(socket, service)
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/internal/state"
+)
+
+func TestServiceUnits(t *testing.T) {
+	units := &serviceUnits{
+		System:     true,
+		Exec:       "/usr/local/bin/flyctl",
+		Socket:     "/run/fly-agent.sock",
+		SocketMode: systemSocketMode,
+		Group:      "ci",
+		User:       "runner",
+		LogFile:    "/var/log/fly agent.log",
+	}
+
+	var socket, service strings.Builder
+	require.NoError(t, units.render(&socket, &service))
+
+	assert.Contains(t, socket.String(), "ListenStream=/run/fly-agent.sock\nSocketMode=0660\nSocketGroup=ci\n")
+	assert.Contains(t, service.String(), "ExecStart=\"/usr/local/bin/flyctl\" agent run --socket \"/run/fly-agent.sock\" --log-file \"/var/log/fly agent.log\"\nUser=runner\n")
+	assert.Contains(t, service.String(), "WantedBy=multi-user.target")
+
+	units = &serviceUnits{
+		Exec:       "/usr/local/bin/flyctl",
+		Socket:     "/home/me/.fly/fly-agent.sock",
+		SocketMode: userSocketMode,
+	}
+
+	socket.Reset()
+	service.Reset()
+	require.NoError(t, units.render(&socket, &service))
+
+	assert.NotContains(t, socket.String(), "SocketGroup")
+	assert.Contains(t, service.String(), "--socket \"/home/me/.fly/fly-agent.sock\"\nEnvironment=")
+	assert.NotContains(t, service.String(), "User=")
+	assert.Contains(t, service.String(), "WantedBy=default.target")
+}
+
+func TestLockFile(t *testing.T) {
+	dir := t.TempDir()
+	ctx := state.WithConfigDirectory(context.Background(), dir)
+
+	assert.Equal(t, lockPath, lockFile(ctx, socketPath(ctx)))
+
+	// services may not create files next to their sockets in /run
+	system := lockFile(ctx, systemSocketPath)
+	assert.Equal(t, dir, filepath.Dir(system))
+	assert.NotEqual(t, system, lockFile(ctx, "/run/other.sock"))
+	assert.Equal(t, system, lockFile(ctx, systemSocketPath))
+}
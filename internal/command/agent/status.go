@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newStatus() (cmd *cobra.Command) {
+	const (
+		short = "Show the status of the Fly agent and its tunnels"
+		long  = short + `, such as the traffic and latest handshake of each
+organization's peer, the DNS queries sent through it and the connections
+proxied over it.
+`
+	)
+
+	cmd = command.New("status", short, long, runStatus)
+
+	cmd.Args = cobra.NoArgs
+
+	return
+}
+
+func runStatus(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	var status agent.Status
+	if status, err = client.Status(ctx); err != nil {
+		err = fmt.Errorf("failed fetching agent status: %w", err)
+
+		return
+	}
+
+	out := iostreams.FromContext(ctx).Out
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(out, status)
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%-10s: %d\n", "PID", status.PID)
+	fmt.Fprintf(&buf, "%-10s: %s\n", "Version", status.Version)
+	fmt.Fprintf(&buf, "%-10s: %t\n", "Background", status.Background)
+
+	if _, err = buf.WriteTo(out); err != nil {
+		return
+	}
+
+	if len(status.Tunnels) == 0 {
+		fmt.Fprintln(out, "\nNo tunnels are open.")
+
+		return
+	}
+
+	var rows [][]string
+	for _, t := range status.Tunnels {
+		handshake := "never"
+		if !t.LastHandshake.IsZero() {
+			handshake = humanize.Time(t.LastHandshake)
+		}
+
+		rows = append(rows, []string{
+			t.Org,
+			t.PeerIP,
+			t.Endpoint,
+			transport(t),
+			humanize.Bytes(t.BytesIn),
+			humanize.Bytes(t.BytesOut),
+			handshake,
+			fmt.Sprint(t.DNSQueries),
+			fmt.Sprint(len(t.Sessions)),
+		})
+	}
+
+	fmt.Fprintln(out)
+	if err = render.Table(out, "Tunnels", rows, "Org", "Peer IP", "Endpoint", "Transport", "In", "Out", "Last Handshake", "DNS Queries", "Sessions"); err != nil {
+		return
+	}
+
+	rows = rows[:0]
+	for _, t := range status.Tunnels {
+		for _, s := range t.Sessions {
+			rows = append(rows, []string{s.ID, t.Org, s.Network, s.Target, humanize.Time(s.Since)})
+		}
+	}
+
+	if len(rows) > 0 {
+		if err = render.Table(out, "Sessions", rows, "ID", "Org", "Network", "Target", "Since"); err != nil {
+			return
+		}
+	}
+
+	rows = rows[:0]
+	for _, c := range status.SSH {
+		rows = append(rows, []string{c.Org, c.Addr, c.User, fmt.Sprint(c.Channels), humanize.Time(c.LastUsed)})
+	}
+
+	if len(rows) > 0 {
+		err = render.Table(out, "SSH Connections", rows, "Org", "Address", "User", "Channels", "Last Used")
+	}
+
+	return
+}
+
+func transport(t agent.TunnelStatus) string {
+	if t.WebsocketReconnects == 0 {
+		return t.Transport
+	}
+
+	return fmt.Sprintf("%s (%d reconnects)", t.Transport, t.WebsocketReconnects)
+}
@@ -2,6 +2,7 @@ package deploy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"github.com/superfly/flyctl/internal/app"
 	"github.com/superfly/flyctl/internal/build/imgsrc"
 	"github.com/superfly/flyctl/internal/spinner"
+	"github.com/superfly/flyctl/internal/watch"
 	"github.com/superfly/flyctl/iostreams"
 )
 
@@ -213,6 +215,12 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 		strategy = "rolling"
 	}
 
+	// Machines keep their config when it's the app's secrets which changed,
+	// and the previous values of those can't be retrieved to restore them.
+	if machineConfig.Image == "" && strategy == "rolling" {
+		return errRollingSecrets
+	}
+
 	var regionCode string
 	if appConfig != nil {
 		regionCode = appConfig.PrimaryRegion
@@ -220,7 +228,13 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 
 	msg := fmt.Sprintf("Deploying with %s strategy", strategy)
 	spin := spinner.Run(io, msg)
-	defer spin.StopWithSuccess()
+	defer func() {
+		if err != nil {
+			spin.Stop()
+		} else {
+			spin.StopWithSuccess()
+		}
+	}()
 
 	machineConfig.Init.Cmd = nil
 
@@ -238,8 +252,11 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 
 	if len(machines) > 0 {
 
+		// The leases have to last until the last machine is updated and
+		// checked, and the rollback pass should that fail.
+		leaseTTL := api.IntPointer(int(deployLeaseTTL(len(machines)) / time.Second))
+
 		for _, machine := range machines {
-			leaseTTL := api.IntPointer(30)
 			lease, err := flapsClient.AcquireLease(ctx, machine.ID, leaseTTL)
 			if err != nil {
 				return err
@@ -249,13 +266,17 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 			defer releaseLease(ctx, machine)
 		}
 
-		for _, machine := range machines {
+		// Machines which have been sent their new config, so that they may be
+		// restored should a later machine fail to come up healthy.
+		var updated []*api.Machine
+
+		for i, machine := range machines {
 			launchInput.ID = machine.ID
 
 			// We assume a config with no image specificed means the deploy should recreate machines
 			// with the existing config. For example, for applying recently set secrets.
 			if machineConfig.Image == "" {
-				launchInput.Config = machine.Config
+				launchInput.Config = copyMachineConfig(machine.Config)
 			}
 
 			launchInput.Region = machine.Region
@@ -272,6 +293,10 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 				machineConfig.Metadata["fly-managed-postgres"] = "true"
 			}
 
+			if launchInput.Config.Env == nil {
+				launchInput.Config.Env = map[string]string{}
+			}
+
 			if launchInput.Config.Env["PRIMARY_REGION"] == "" {
 				launchInput.Config.Env["PRIMARY_REGION"] = machine.Config.Env["PRIMARY_REGION"]
 			}
@@ -288,26 +313,39 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 				launchInput.Config.Mounts = machine.Config.Mounts
 			}
 
+			spin.Set(fmt.Sprintf("%s: updating machine %s [%d/%d]", msg, machine.ID, i+1, len(machines)))
+
 			updateResult, err := flapsClient.Update(ctx, launchInput, machine.LeaseNonce)
 			if err != nil {
 				if strategy != "immediate" {
-					return err
-
-				} else {
-					fmt.Printf("Continuing after error: %s\n", err)
+					return rollbackMachines(ctx, spin, app, updated, err)
 				}
+
+				fmt.Fprintf(io.ErrOut, "Continuing after error: %s\n", err)
+				continue
+			}
+
+			updated = append(updated, machine)
+
+			if strategy == "immediate" {
+				continue
 			}
 
-			if strategy != "immediate" {
-				err = flapsClient.Wait(ctx, updateResult, "started")
-				if err != nil {
-					return err
+			if err = flapsClient.Wait(ctx, updateResult, "started"); err != nil {
+				return rollbackMachines(ctx, spin, app, updated, err)
+			}
+
+			if len(updateResult.Config.Checks) > 0 {
+				if err = watch.MachinesChecks(ctx, []*api.Machine{updateResult}); err != nil {
+					return rollbackMachines(ctx, spin, app, updated, fmt.Errorf("machine %s failed health checks: %w", machine.ID, err))
 				}
 			}
 		}
 
+		spin.Set(fmt.Sprintf("%s: updated %d machines", msg, len(updated)))
 	} else {
-		fmt.Fprintf(io.Out, "Launching VM with image %s\n", launchInput.Config.Image)
+		spin.Set(fmt.Sprintf("%s: launching VM with image %s", msg, launchInput.Config.Image))
+
 		_, err = flapsClient.Launch(ctx, launchInput)
 		if err != nil {
 			return err
@@ -317,6 +355,71 @@ func DeployMachinesApp(ctx context.Context, app *api.AppCompact, strategy string
 	return
 }
 
+// errRollingSecrets is returned for rolling deployments of secrets, which
+// couldn't be rolled back.
+var errRollingSecrets = errors.New("deployments of secrets can't be rolled back, since the previous values of secrets can't be retrieved; use the immediate strategy")
+
+// perMachineDeployTime is how long updating a machine, waiting for it to
+// start and pass its checks, and rolling it back may take.
+const perMachineDeployTime = 5 * time.Minute
+
+// deployLeaseTTL returns how long the leases on the machines of a deployment
+// should last: long enough to update and then roll back every one of them.
+func deployLeaseTTL(machines int) time.Duration {
+	return 2 * time.Duration(machines) * perMachineDeployTime
+}
+
+// rollbackMachines restores the config the given machines had before the
+// deployment started, in reverse order, reporting progress on spin. It
+// returns cause, annotated with the outcome of the rollback.
+func rollbackMachines(ctx context.Context, spin *spinner.Spinner, app *api.AppCompact, machines []*api.Machine, cause error) error {
+	flapsClient := flaps.FromContext(ctx)
+
+	if len(machines) == 0 {
+		return cause
+	}
+
+	msg := fmt.Sprintf("Deployment failed, rolling back %d machines", len(machines))
+
+	for i := len(machines) - 1; i >= 0; i-- {
+		machine := machines[i]
+
+		spin.Set(fmt.Sprintf("%s: rolling back machine %s", msg, machine.ID))
+
+		input := api.LaunchMachineInput{
+			ID:     machine.ID,
+			AppID:  app.Name,
+			Region: machine.Region,
+			Config: machine.Config,
+		}
+
+		restored, err := flapsClient.Update(ctx, input, machine.LeaseNonce)
+		if err == nil {
+			err = flapsClient.Wait(ctx, restored, "started")
+		}
+		if err != nil {
+			return fmt.Errorf("%w (rollback of machine %s failed: %v)", cause, machine.ID, err)
+		}
+	}
+
+	return fmt.Errorf("%w (rolled back to the previous configuration)", cause)
+}
+
+// copyMachineConfig returns a copy of config which may be modified without
+// affecting the original, so that it's still available for rollbacks.
+func copyMachineConfig(config *api.MachineConfig) *api.MachineConfig {
+	c := *config
+
+	if config.Env != nil {
+		c.Env = make(map[string]string, len(config.Env))
+		for k, v := range config.Env {
+			c.Env[k] = v
+		}
+	}
+
+	return &c
+}
+
 func releaseLease(ctx context.Context, machine *api.Machine) error {
 	var client = flaps.FromContext(ctx)
 
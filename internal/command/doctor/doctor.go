@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	dockerclient "github.com/docker/docker/client"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/superfly/flyctl/agent"
 	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/terminal"
+	"github.com/superfly/flyctl/wg"
 
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/internal/build/imgsrc"
@@ -22,6 +25,7 @@ import (
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/internal/wireguard"
 )
 
 // New initializes and returns a new doctor Command.
@@ -143,6 +147,23 @@ Run 'flyctl agent restart'.
 
 	// ------------------------------------------------------------
 
+	lprint(nil, "Comparing WireGuard transports (give us a sec)... ")
+	latencies, err := runTransports(ctx)
+	if check("transports", err) {
+		lprint(nil, "    Handshake over UDP took %s, over websockets %s\n",
+			latencies[wg.TransportUDP].Round(time.Millisecond), latencies[wg.TransportWebsockets].Round(time.Millisecond))
+	} else if _, ok := latencies[wg.TransportWebsockets]; ok {
+		lprint(nil, `
+WireGuard handshakes over UDP fail, while those over websockets succeed, which
+suggests your network blocks 51820/udp.
+
+Run 'flyctl wireguard websockets enable', or set FLY_WIREGUARD_WEBSOCKETS=1,
+followed by 'flyctl agent restart', and we'll run WireGuard over HTTPS.
+`)
+	}
+
+	// ------------------------------------------------------------
+
 	lprint(nil, "Pinging WireGuard gateway (give us a sec)... ")
 	err = runPersonalOrgPing(ctx)
 	if !check("ping", err) {
@@ -252,6 +273,92 @@ func runPersonalOrgPing(ctx context.Context) (err error) {
 	return fmt.Errorf("ping gateway: no response from gateway received")
 }
 
+const (
+	// handshakeTimeout caps how long runTransports waits for each handshake.
+	handshakeTimeout = 10 * time.Second
+
+	// peerReadyTimeout caps how long runTransports waits for the gateway to
+	// accept handshakes with the peer it creates.
+	peerReadyTimeout = 30 * time.Second
+)
+
+// runTransports measures how long handshakes with the WireGuard gateway of
+// the personal organization take over UDP and over websockets. It returns
+// the latencies of the transports which succeeded.
+//
+// The handshakes are made with a temporary peer, since those made with the
+// agent's one would have the gateway roam away from the agent's tunnel.
+func runTransports(ctx context.Context) (latencies map[string]time.Duration, err error) {
+	client := client.FromContext(ctx).API()
+
+	org, err := client.GetOrganizationBySlug(ctx, "personal")
+	if err != nil {
+		return nil, fmt.Errorf("compare transports: %w", err)
+	}
+
+	state, err := wireguard.CreateTemporary(ctx, client, org, "doctor")
+	if err != nil {
+		return nil, fmt.Errorf("compare transports: failed creating peer: %w", err)
+	}
+	defer func() {
+		if err := client.RemoveWireGuardPeer(context.Background(), org, state.Name); err != nil {
+			terminal.Debugf("failed removing peer %s: %v\n", state.Name, err)
+		}
+	}()
+
+	// the gateway takes a moment to learn of new peers, which mustn't count
+	// towards the handshakes measured
+	if err := waitForPeer(ctx, state); err != nil {
+		return nil, fmt.Errorf("compare transports: %w", err)
+	}
+
+	latencies = map[string]time.Duration{}
+
+	var failed []string
+	for _, transport := range []string{wg.TransportUDP, wg.TransportWebsockets} {
+		ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		latency, err := wg.MeasureHandshake(ctx, state, transport)
+		cancel()
+
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", transport, err))
+
+			continue
+		}
+
+		latencies[transport] = latency
+	}
+
+	if len(failed) > 0 {
+		err = fmt.Errorf("compare transports: %s", strings.Join(failed, "; "))
+	}
+
+	return
+}
+
+// waitForPeer waits for the gateway to accept a handshake with the peer over
+// either transport.
+func waitForPeer(ctx context.Context, state *wg.WireGuardState) error {
+	ctx, cancel := context.WithTimeout(ctx, peerReadyTimeout)
+	defer cancel()
+
+	for {
+		for _, transport := range []string{wg.TransportUDP, wg.TransportWebsockets} {
+			attemptCtx, cancelAttempt := context.WithTimeout(ctx, 3*time.Second)
+			_, err := wg.MeasureHandshake(attemptCtx, state, transport)
+			cancelAttempt()
+
+			if err == nil {
+				return nil
+			}
+
+			if ctx.Err() != nil {
+				return fmt.Errorf("peer %s wasn't ready in time: %w", state.Name, err)
+			}
+		}
+	}
+}
+
 func runLocalDocker(ctx context.Context) (err error) {
 	defer func() {
 		if err == nil {
@@ -0,0 +1,101 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/superfly/flyctl/internal/logger"
+	"github.com/superfly/flyctl/logs"
+)
+
+// checkpointInterval is how often the --checkpoint file is written.
+const checkpointInterval = 5 * time.Second
+
+// loadCheckpoint reads the cursors of the apps from the checkpoint file. An
+// empty path or a missing file yield no cursors.
+func loadCheckpoint(path string) (map[string]*logs.Cursor, error) {
+	cursors := make(map[string]*logs.Cursor)
+	if path == "" {
+		return cursors, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return cursors, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed reading checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, fmt.Errorf("failed parsing checkpoint %s: %w", path, err)
+	}
+
+	return cursors, nil
+}
+
+// writeCheckpoint writes the cursors to the checkpoint file. The file is
+// replaced in one go so that it's never left half written.
+func writeCheckpoint(path string, cursors map[string]*logs.Cursor) error {
+	data, err := json.Marshal(cursors)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// keepCheckpoint writes the cursors to the checkpoint file periodically until
+// the returned function is called, which writes them one last time.
+func keepCheckpoint(ctx context.Context, path string, cursors map[string]*logs.Cursor) (stop func() error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := writeCheckpoint(path, cursors); err != nil {
+					logger.FromContext(ctx).Warn(err.Error())
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		<-stopped
+
+		return writeCheckpoint(path, cursors)
+	}
+}
@@ -0,0 +1,119 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/logs"
+)
+
+// newFilter builds the log filter the command's flags describe.
+func newFilter(ctx context.Context, appNames []string) (filter *logs.Filter, err error) {
+	filter = new(logs.Filter)
+	now := time.Now()
+
+	if since := flag.GetString(ctx, "since"); since != "" {
+		if filter.Since, err = logs.ParseTime(since, now); err != nil {
+			return nil, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+
+	if until := flag.GetString(ctx, "until"); until != "" {
+		if filter.Until, err = logs.ParseTime(until, now); err != nil {
+			return nil, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && filter.Until.Before(filter.Since) {
+		return nil, fmt.Errorf("--until must be later than --since")
+	}
+
+	if level := flag.GetString(ctx, "level"); level != "" {
+		if !logs.ValidLevel(level) {
+			return nil, fmt.Errorf("unknown log level %q", level)
+		}
+		filter.MinLevel = level
+	}
+
+	if expr := flag.GetString(ctx, "grep"); expr != "" {
+		if filter.Pattern, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid --grep: %w", err)
+		}
+	}
+
+	if group := flag.GetString(ctx, "process-group"); group != "" {
+		filter.Instances = make(map[string]bool)
+
+		for _, appName := range appNames {
+			instances, err := processGroupInstances(ctx, appName, group)
+			if err != nil {
+				return nil, err
+			}
+
+			for id := range instances {
+				filter.Instances[id] = true
+			}
+		}
+
+		if len(filter.Instances) == 0 {
+			return nil, fmt.Errorf("no instances found in process group %s", group)
+		}
+	}
+
+	return filter, nil
+}
+
+// processGroupInstances returns the IDs of the app's instances which belong
+// to the named process group.
+func processGroupInstances(ctx context.Context, appName, group string) (map[string]bool, error) {
+	client := client.FromContext(ctx).API()
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]bool)
+
+	if app.PlatformVersion == "machines" {
+		flapsClient, err := flaps.New(ctx, app)
+		if err != nil {
+			return nil, fmt.Errorf("could not make flaps client: %w", err)
+		}
+
+		machines, err := flapsClient.List(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, machine := range machines {
+			machineGroup := "app"
+			if machine.Config != nil && machine.Config.Metadata["process_group"] != "" {
+				machineGroup = machine.Config.Metadata["process_group"]
+			}
+
+			if machineGroup == group {
+				instances[machine.ID] = true
+			}
+		}
+	} else {
+		status, err := client.GetAppStatus(ctx, appName, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, alloc := range status.Allocations {
+			if alloc.TaskName == group {
+				instances[alloc.ID] = true
+				instances[alloc.IDShort] = true
+			}
+		}
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,317 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/logs"
+)
+
+// entryPrinter writes a single log entry to w.
+type entryPrinter func(w io.Writer, entry logs.LogEntry) error
+
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatLogfmt = "logfmt"
+)
+
+// newPrinter returns the printer for the given --format and --fields values.
+// Formats other than text, json and logfmt are parsed as Go templates.
+func newPrinter(format string, fields []string) (entryPrinter, error) {
+	switch format {
+	case "", formatText:
+		if len(fields) > 0 {
+			return logfmtPrinter(fields), nil
+		}
+
+		return textPrinter, nil
+	case formatJSON:
+		if len(fields) > 0 {
+			return jsonFieldsPrinter(fields), nil
+		}
+
+		return jsonPrinter, nil
+	case formatLogfmt:
+		return logfmtPrinter(fields), nil
+	}
+
+	tmpl, err := template.New("format").Option("missingkey=zero").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format template: %w", err)
+	}
+
+	return templatePrinter(tmpl), nil
+}
+
+func textPrinter(w io.Writer, entry logs.LogEntry) error {
+	return render.LogEntry(w, entry,
+		render.HideAllocID(),
+		render.RemoveNewlines(),
+		render.HideRegion(),
+	)
+}
+
+func jsonPrinter(w io.Writer, entry logs.LogEntry) error {
+	return render.JSON(w, entry)
+}
+
+// appColors are the colors app prefixes are drawn from. Red is left out so
+// that prefixes aren't mistaken for errors.
+var appColors = []string{"cyan", "magenta", "yellow", "green", "blue"}
+
+// appColor picks the color of the app's prefix. Colors are derived from the
+// app's name so that an app is always printed in the same color.
+func appColor(appName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(appName))
+
+	return appColors[h.Sum32()%uint32(len(appColors))]
+}
+
+// withAppPrefix prefixes each entry the printer writes with the name of its
+// app, padded to the longest of the app names so that entries line up.
+func withAppPrefix(printer entryPrinter, appNames []string, colors *iostreams.ColorScheme) entryPrinter {
+	var width int
+	for _, appName := range appNames {
+		if len(appName) > width {
+			width = len(appName)
+		}
+	}
+
+	return func(w io.Writer, entry logs.LogEntry) error {
+		var buf bytes.Buffer
+
+		colorize := colors.ColorFromString(appColor(entry.AppName))
+		fmt.Fprintf(&buf, "%s | ", colorize(fmt.Sprintf("%-*s", width, entry.AppName)))
+
+		if err := printer(&buf, entry); err != nil {
+			return err
+		}
+
+		_, err := buf.WriteTo(w)
+
+		return err
+	}
+}
+
+// templateEntry is the data --format templates are executed against.
+type templateEntry struct {
+	logs.LogEntry
+
+	// Fields holds the fields of messages which are JSON objects.
+	Fields map[string]interface{}
+}
+
+func templatePrinter(tmpl *template.Template) entryPrinter {
+	return func(w io.Writer, entry logs.LogEntry) error {
+		var buf bytes.Buffer
+
+		data := templateEntry{
+			LogEntry: entry,
+			Fields:   messageFields(entry.Message),
+		}
+
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+
+		if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+
+		_, err := buf.WriteTo(w)
+
+		return err
+	}
+}
+
+func jsonFieldsPrinter(fields []string) entryPrinter {
+	return func(w io.Writer, entry logs.LogEntry) error {
+		projected := make(map[string]interface{}, len(fields))
+
+		for _, kv := range projectFields(entry, fields) {
+			projected[kv.key] = kv.value
+		}
+
+		b, err := json.Marshal(projected)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "%s\n", b)
+
+		return err
+	}
+}
+
+func logfmtPrinter(fields []string) entryPrinter {
+	return func(w io.Writer, entry logs.LogEntry) error {
+		var kvs []keyValue
+		if len(fields) > 0 {
+			kvs = projectFields(entry, fields)
+		} else {
+			kvs = allFields(entry)
+		}
+
+		var buf bytes.Buffer
+		for i, kv := range kvs {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(kv.key)
+			buf.WriteByte('=')
+			buf.WriteString(logfmtValue(kv.value))
+		}
+		buf.WriteByte('\n')
+
+		_, err := buf.WriteTo(w)
+
+		return err
+	}
+}
+
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+// entryFields returns the fields of the entry itself, which --fields falls
+// back to when the message doesn't define them.
+func entryFields(entry logs.LogEntry) (kvs []keyValue) {
+	if entry.AppName != "" {
+		kvs = append(kvs, keyValue{"app", entry.AppName})
+	}
+
+	return append(kvs,
+		keyValue{"timestamp", entry.Timestamp},
+		keyValue{"level", entry.Level},
+		keyValue{"instance", entry.Instance},
+		keyValue{"region", entry.Region},
+	)
+}
+
+// allFields returns the entry's fields followed by the message, which is
+// expanded into its fields when it's a JSON object.
+func allFields(entry logs.LogEntry) []keyValue {
+	kvs := entryFields(entry)
+
+	msg := messageFields(entry.Message)
+	if msg == nil {
+		return append(kvs, keyValue{"msg", entry.Message})
+	}
+
+	keys := make([]string, 0, len(msg))
+	for k := range msg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// The message's own fields take precedence over the entry's.
+	for i, kv := range kvs {
+		if v, ok := msg[kv.key]; ok {
+			kvs[i].value = v
+			delete(msg, kv.key)
+		}
+	}
+
+	for _, k := range keys {
+		if v, ok := msg[k]; ok {
+			kvs = append(kvs, keyValue{k, v})
+		}
+	}
+
+	return kvs
+}
+
+// projectFields looks the named fields up in the message, when it's a JSON
+// object, and then in the entry. Dotted names address nested objects.
+// Fields found in neither are left out.
+func projectFields(entry logs.LogEntry, fields []string) (kvs []keyValue) {
+	msg := messageFields(entry.Message)
+
+	builtin := make(map[string]interface{})
+	for _, kv := range entryFields(entry) {
+		builtin[kv.key] = kv.value
+	}
+	builtin["message"] = entry.Message
+
+	for _, field := range fields {
+		if v, ok := lookupField(msg, field); ok {
+			kvs = append(kvs, keyValue{field, v})
+		} else if v, ok := builtin[field]; ok {
+			kvs = append(kvs, keyValue{field, v})
+		}
+	}
+
+	return
+}
+
+func lookupField(m map[string]interface{}, path string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	if v, ok := m[path]; ok {
+		return v, true
+	}
+
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil, false
+	}
+
+	nested, ok := m[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	return lookupField(nested, rest)
+}
+
+// messageFields parses messages which are JSON objects. It returns nil for
+// any other message.
+func messageFields(message string) map[string]interface{} {
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, "{") {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &fields); err != nil {
+		return nil
+	}
+
+	return fields
+}
+
+func logfmtValue(v interface{}) string {
+	var s string
+
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
@@ -0,0 +1,92 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/logs"
+)
+
+var jsonEntry = logs.LogEntry{
+	Level:     "info",
+	Instance:  "abc123",
+	Region:    "ord",
+	Timestamp: "2022-10-01T12:00:00Z",
+	Message:   `{"level":"error","msg":"request failed","req_id":"r-1","http":{"status":500}}`,
+}
+
+func printEntry(t *testing.T, format string, fields []string, entry logs.LogEntry) string {
+	t.Helper()
+
+	printer, err := newPrinter(format, fields)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, printer(&buf, entry))
+
+	return buf.String()
+}
+
+func TestLogfmtPrinter(t *testing.T) {
+	plain := jsonEntry
+	plain.Message = "hello world"
+
+	assert.Equal(t,
+		`timestamp=2022-10-01T12:00:00Z level=info instance=abc123 region=ord msg="hello world"`+"\n",
+		printEntry(t, formatLogfmt, nil, plain))
+
+	assert.Equal(t,
+		`timestamp=2022-10-01T12:00:00Z level=error instance=abc123 region=ord http="{\"status\":500}" msg="request failed" req_id=r-1`+"\n",
+		printEntry(t, formatLogfmt, nil, jsonEntry))
+}
+
+func TestFieldsProjection(t *testing.T) {
+	fields := []string{"level", "msg", "req_id", "http.status", "region", "missing"}
+
+	assert.Equal(t,
+		`level=error msg="request failed" req_id=r-1 http.status=500 region=ord`+"\n",
+		printEntry(t, "", fields, jsonEntry))
+
+	assert.JSONEq(t,
+		`{"level":"error","msg":"request failed","req_id":"r-1","http.status":500,"region":"ord"}`,
+		printEntry(t, formatJSON, fields, jsonEntry))
+}
+
+func TestTemplatePrinter(t *testing.T) {
+	assert.Equal(t,
+		"ord abc123 request failed\n",
+		printEntry(t, "{{.Region}} {{.Instance}} {{.Fields.msg}}", nil, jsonEntry))
+
+	_, err := newPrinter("{{.Broken", nil)
+	assert.Error(t, err)
+}
+
+func TestAppPrefix(t *testing.T) {
+	entry := jsonEntry
+	entry.AppName = "api"
+	entry.Message = "hello"
+
+	plain := func(w io.Writer, entry logs.LogEntry) error {
+		_, err := fmt.Fprintln(w, entry.Message)
+
+		return err
+	}
+
+	printer := withAppPrefix(plain, []string{"api", "worker"}, iostreams.NewColorScheme(false, false))
+
+	var buf bytes.Buffer
+	require.NoError(t, printer(&buf, entry))
+	assert.Equal(t, "api    | hello\n", buf.String())
+
+	assert.Equal(t, appColor("worker"), appColor("worker"))
+
+	assert.Equal(t,
+		`app=api timestamp=2022-10-01T12:00:00Z level=info instance=abc123 region=ord msg=hello`+"\n",
+		printEntry(t, formatLogfmt, nil, entry))
+}
@@ -4,10 +4,13 @@ package logs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/azazeal/pause"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
@@ -21,7 +24,6 @@ import (
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/logger"
-	"github.com/superfly/flyctl/internal/render"
 )
 
 func New() (cmd *cobra.Command) {
@@ -29,54 +31,268 @@ func New() (cmd *cobra.Command) {
 		long = `View application logs as generated by the application running on
 the Fly platform.
 
+Logs of several apps may be viewed at once by passing --app/-a multiple
+times, or with --all-apps for every app of the organization given by --org.
+Entries of each app are prefixed with its name, always in the same color.
+
 Logs can be filtered to a specific instance using the --instance/-i flag or
 to all instances running in a specific region using the --region/-r flag.
+
+Entries may be further narrowed down by time with --since and --until, by
+minimum severity with --level, by message with --grep and by process group
+with --process-group. Use --no-tail to print the buffered logs and exit.
+
+Output may be rendered as json, logfmt or through a Go template with --format.
+Templates are executed against each log entry, with the fields of messages
+which are JSON objects available under .Fields. --fields projects the given
+fields out of such messages, falling back to the entry's own timestamp, level,
+instance, region and message fields.
+
+Entries are deduplicated across the polling and live sources, and the live
+stream reconnects with backoff when it drops, catching up on what was missed.
+With --checkpoint the position of each app's stream is kept in a file, so that
+a restarted process resumes where the previous one stopped. Positions older
+than a few minutes resume from the latest logs instead, skipping the entries
+which were already seen.
+
+Instead of printing them, logs may be shipped elsewhere with --ship-to, which
+accepts a file path (rotated at 10MB by default), a file:// URL with max_size
+and max_files parameters, a syslog+tcp:// or syslog+udp:// address receiving
+RFC 5424 messages, an http(s):// endpoint receiving NDJSON batches, or a
+loki+http(s):// Loki push endpoint.
 `
 		short = "View app logs"
 	)
 
 	cmd = command.New("logs", short, long, run,
 		command.RequireSession,
-		command.RequireAppName,
+		command.LoadAppNameIfPresent,
 	)
 
 	cmd.Args = cobra.NoArgs
 
 	flag.Add(cmd,
-		flag.App(),
+		flag.StringSlice{
+			Name:        flag.AppName,
+			Shorthand:   "a",
+			Description: "Application name. May be given multiple times to view the logs of several apps",
+		},
 		flag.AppConfig(),
+		flag.Org(),
+		flag.Bool{
+			Name:        "all-apps",
+			Description: "View the logs of all apps of the organization given by --org",
+		},
 		flag.Region(),
 		flag.String{
 			Name:        "instance",
 			Shorthand:   "i",
 			Description: "Filter by instance ID",
 		},
+		flag.String{
+			Name:        "since",
+			Description: "Only show logs newer than a relative duration like 2h, or an RFC 3339 timestamp",
+		},
+		flag.String{
+			Name:        "until",
+			Description: "Only show logs older than a relative duration like 30m, or an RFC 3339 timestamp",
+		},
+		flag.String{
+			Name:        "level",
+			Description: "Only show logs of this severity or higher, e.g. warn or error",
+		},
+		flag.String{
+			Name:        "grep",
+			Description: "Only show logs whose message matches this regular expression",
+		},
+		flag.String{
+			Name:        "process-group",
+			Description: "Only show logs of instances in this process group",
+		},
+		flag.Bool{
+			Name:        "no-tail",
+			Description: "Print the buffered logs and exit instead of following new ones",
+		},
+		flag.String{
+			Name:        "format",
+			Description: "Output format: text, json, logfmt or a Go template such as '{{.Timestamp}} {{.Fields.msg}}'",
+		},
+		flag.String{
+			Name:        "ship-to",
+			Description: "Ship logs to a sink instead of printing them: a file path or file://, syslog+tcp://, syslog+udp://, http(s):// (NDJSON) or loki+http(s):// URL",
+		},
+		flag.String{
+			Name:        "checkpoint",
+			Description: "Keep the position of the log streams in this file and resume from it",
+		},
+		flag.StringSlice{
+			Name:        "fields",
+			Description: "Comma separated fields to print, looked up in JSON messages first, e.g. level,msg,req_id",
+		},
 	)
 
 	return
 }
 
-func run(ctx context.Context) error {
+func run(ctx context.Context) (err error) {
 	client := client.FromContext(ctx).API()
 
-	opts := &logs.LogOptions{
-		AppName:    app.NameFromContext(ctx),
+	appNames, err := selectApps(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	filter, err := newFilter(ctx, appNames)
+	if err != nil {
+		return err
+	}
+
+	base := logs.LogOptions{
 		RegionCode: config.FromContext(ctx).Region,
 		VMID:       flag.GetString(ctx, "instance"),
+		NoTail:     flag.GetBool(ctx, "no-tail"),
+		Filter:     filter,
+	}
+
+	format := flag.GetString(ctx, "format")
+	if format == "" && config.FromContext(ctx).JSONOutput {
+		format = formatJSON
+	}
+
+	fields := flag.GetStringSlice(ctx, "fields")
+
+	printer, err := newPrinter(format, fields)
+	if err != nil {
+		return err
+	}
+
+	if len(appNames) > 1 && (format == "" || format == formatText) && len(fields) == 0 {
+		printer = withAppPrefix(printer, appNames, iostreams.FromContext(ctx).ColorScheme())
+	}
+
+	// Logs stop at --until, so there's nothing to follow when it's in the past
+	// and streaming ends once it's reached otherwise.
+	var untilReached context.Context
+	if until := filter.Until; !until.IsZero() {
+		if until.Before(time.Now()) {
+			base.NoTail = true
+		} else {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, until)
+			defer cancel()
+
+			untilReached = ctx
+		}
+	}
+
+	checkpoint := flag.GetString(ctx, "checkpoint")
+
+	cursors, err := loadCheckpoint(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	apps := make([]*logs.LogOptions, 0, len(appNames))
+	for _, appName := range appNames {
+		if cursors[appName] == nil {
+			cursors[appName] = new(logs.Cursor)
+		}
+
+		opts := base
+		opts.AppName = appName
+		opts.Cursor = cursors[appName]
+
+		apps = append(apps, &opts)
+	}
+
+	if checkpoint != "" {
+		stop := keepCheckpoint(ctx, checkpoint, cursors)
+		defer func() {
+			if e := stop(); err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if target := flag.GetString(ctx, "ship-to"); target != "" {
+		err = ship(ctx, client, apps, target)
+		if untilReached != nil && errors.Is(untilReached.Err(), context.DeadlineExceeded) {
+			err = nil
+		}
+
+		return err
 	}
 
 	var eg *errgroup.Group
 	eg, ctx = errgroup.WithContext(ctx)
 
-	pollingCtx, cancelPolling := context.WithCancel(ctx)
-	pollEntries := poll(pollingCtx, eg, client, opts)
-	liveEntries := nats(ctx, eg, client, opts, cancelPolling)
+	var streams []<-chan logs.LogEntry
+	for _, opts := range apps {
+		if opts.NoTail {
+			streams = append(streams, poll(ctx, eg, client, opts))
+
+			continue
+		}
+
+		pollingCtx, cancelPolling := context.WithCancel(ctx)
+		streams = append(streams,
+			poll(pollingCtx, eg, client, opts),
+			nats(ctx, eg, client, opts, cancelPolling),
+		)
+	}
 
 	eg.Go(func() error {
-		return printStreams(ctx, pollEntries, liveEntries)
+		return printStreams(ctx, printer, streams...)
 	})
 
-	return eg.Wait()
+	err = eg.Wait()
+	if untilReached != nil && errors.Is(untilReached.Err(), context.DeadlineExceeded) {
+		err = nil
+	}
+
+	return err
+}
+
+// selectApps returns the names of the apps whose logs the command's flags
+// select: those given by --app, those of the organization when --all-apps is
+// set, or else the one of the current app config.
+func selectApps(ctx context.Context, client *api.Client) ([]string, error) {
+	if flag.GetBool(ctx, "all-apps") {
+		slug := flag.GetOrg(ctx)
+		if slug == "" {
+			return nil, errors.New("--all-apps requires --org")
+		}
+
+		apps, err := client.GetApps(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed retrieving apps: %w", err)
+		}
+
+		var appNames []string
+		for _, app := range apps {
+			if app.Organization.Slug == slug {
+				appNames = append(appNames, app.Name)
+			}
+		}
+
+		if len(appNames) == 0 {
+			return nil, fmt.Errorf("organization %s has no apps", slug)
+		}
+
+		sort.Strings(appNames)
+
+		return appNames, nil
+	}
+
+	if appNames := lo.Uniq(flag.GetStringSlice(ctx, flag.AppName)); len(appNames) > 0 {
+		return appNames, nil
+	}
+
+	if appName := app.NameFromContext(ctx); appName != "" {
+		return []string{appName}, nil
+	}
+
+	return nil, errors.New("we couldn't find a fly.toml nor an app specified by the -a flag")
 }
 
 func poll(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *logs.LogOptions) <-chan logs.LogEntry {
@@ -118,7 +334,7 @@ func nats(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *log
 		pause.For(ctx, 2*time.Second)
 		cancelPolling()
 
-		for entry := range stream.Stream(ctx, opts) {
+		for entry := range logs.NewResumingStream(client, stream).Stream(ctx, opts) {
 			c <- entry
 		}
 
@@ -128,25 +344,77 @@ func nats(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *log
 	return c
 }
 
-func printStreams(ctx context.Context, streams ...<-chan logs.LogEntry) error {
+// ship writes the apps' logs to the sink the target URL describes. Entries are
+// streamed over NATS when the WireGuard tunnel is available, or polled for
+// otherwise. Each app is shipped separately, sharing the sink.
+func ship(ctx context.Context, client *api.Client, apps []*logs.LogOptions, target string) (err error) {
+	sink, err := logs.NewSink(target, apps[0].AppName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := sink.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	streams := make([]logs.LogStream, len(apps))
+	for i, opts := range apps {
+		var stream logs.LogStream
+		if !opts.NoTail {
+			if stream, err = logs.NewNatsStream(ctx, client, opts); err != nil {
+				logger := logger.FromContext(ctx)
+
+				logger.Debugf("could not connect to wireguard tunnel: %v\n", err)
+				logger.Debug("falling back to log polling...")
+			} else {
+				stream = logs.NewResumingStream(client, stream)
+			}
+		}
+
+		if stream == nil {
+			if stream, err = logs.NewPollingStream(client, opts); err != nil {
+				return err
+			}
+		}
+
+		streams[i] = stream
+	}
+
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	for i, opts := range apps {
+		opts, stream := opts, streams[i]
+
+		fmt.Fprintf(iostreams.FromContext(ctx).ErrOut, "Shipping logs of %s to %s\n", opts.AppName, target)
+
+		eg.Go(func() error {
+			return logs.Ship(ctx, stream, opts, sink, logs.DefaultShipOptions)
+		})
+	}
+
+	return eg.Wait()
+}
+
+func printStreams(ctx context.Context, printer entryPrinter, streams ...<-chan logs.LogEntry) error {
 	var eg *errgroup.Group
 	eg, ctx = errgroup.WithContext(ctx)
 
 	out := iostreams.FromContext(ctx).Out
-	json := config.FromContext(ctx).JSONOutput
 
 	for _, stream := range streams {
 		stream := stream
 
 		eg.Go(func() error {
-			return printStream(ctx, out, stream, json)
+			return printStream(ctx, out, stream, printer)
 		})
 	}
 
 	return eg.Wait()
 }
 
-func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry, json bool) error {
+func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry, printer entryPrinter) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -156,18 +424,7 @@ func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry,
 				return nil
 			}
 
-			var err error
-			if json {
-				err = render.JSON(w, entry)
-			} else {
-				err = render.LogEntry(w, entry,
-					render.HideAllocID(),
-					render.RemoveNewlines(),
-					render.HideRegion(),
-				)
-			}
-
-			if err != nil {
+			if err := printer(w, entry); err != nil {
 				return err
 			}
 		}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/superfly/flyctl/agent"
@@ -13,19 +14,38 @@ import (
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/proxy"
 )
 
 func New() *cobra.Command {
 	var (
-		long  = strings.Trim(`Proxies connections to a fly VM through a Wireguard tunnel The current application DNS is the default remote host`, "\n")
+		long = strings.Trim(`Proxies connections to a fly VM through a Wireguard tunnel The current application DNS is the default remote host
+
+Several ports may be proxied at once, e.g. 'fly proxy 5432:5432 6379:6379'.
+Each mapping takes the local[:remote] form, where local may also be the path
+of a unix socket, and forwards UDP instead of TCP when suffixed with /udp.
+With --unix, the single port given is proxied from a unix socket instead.
+
+With --balance, connections are spread across every instance of the app,
+either round-robin or to the instance with the fewest connections proxied
+(least-conn). Instances which fail to connect are left out for 30 seconds,
+and --sticky sends connections from the same source port to the same one.
+
+On interrupt, connections in flight are given --drain-timeout seconds to
+finish before they're closed. --idle-timeout closes connections which carry
+no data for the given number of seconds.
+
+With --socks5, a SOCKS5 server is run on the given address through which every
+*.internal name and 6PN address of the organization is reachable, e.g.
+'fly proxy --socks5 :1080'. Port mappings are optional then.`, "\n")
 		short = `Proxies connections to a fly VM`
 	)
 
-	cmd := command.New("proxy <local:remote> [remote_host]", short, long, run,
+	cmd := command.New("proxy <local:remote>... [remote_host]", short, long, run,
 		command.RequireSession, command.LoadAppNameIfPresent)
 
-	cmd.Args = cobra.RangeArgs(1, 2)
+	cmd.Args = cobra.ArbitraryArgs
 
 	flag.Add(cmd,
 		flag.App(),
@@ -42,6 +62,36 @@ func New() *cobra.Command {
 			Shorthand:   "q",
 			Description: "Don't print progress indicators for WireGuard",
 		},
+		flag.String{
+			Name:        "bind-addr",
+			Default:     "127.0.0.1",
+			Description: "Local address to bind the proxied ports to",
+		},
+		flag.String{
+			Name:        "balance",
+			Description: "Spread connections across all instances of the app: round-robin or least-conn",
+		},
+		flag.Bool{
+			Name:        "sticky",
+			Description: "Send connections from the same source port to the same instance when balancing",
+		},
+		flag.Int{
+			Name:        "idle-timeout",
+			Description: "Close connections which carried no data for this many seconds. 0 disables the timeout",
+		},
+		flag.Int{
+			Name:        "drain-timeout",
+			Default:     10,
+			Description: "Seconds to wait for connections in flight to finish on interrupt before closing them",
+		},
+		flag.String{
+			Name:        "socks5",
+			Description: "Run a SOCKS5 server on this address, e.g. :1080, to reach any *.internal name or 6PN address",
+		},
+		flag.String{
+			Name:        "unix",
+			Description: "Proxy the remote port from a unix socket at this path",
+		},
 	)
 
 	return cmd
@@ -54,6 +104,46 @@ func run(ctx context.Context) (err error) {
 	args := flag.Args(ctx)
 	promptInstance := flag.GetBool(ctx, "select")
 
+	mappings, remoteHost, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+
+	balance := flag.GetString(ctx, "balance")
+	switch balance {
+	case "", proxy.BalanceRoundRobin, proxy.BalanceLeastConn:
+	default:
+		return fmt.Errorf("--balance must be either %s or %s", proxy.BalanceRoundRobin, proxy.BalanceLeastConn)
+	}
+
+	if balance != "" {
+		switch {
+		case appName == "":
+			return errors.New("--app required when --balance flag provided")
+		case promptInstance:
+			return errors.New("--balance and --select are mutually exclusive")
+		case remoteHost != "":
+			return errors.New("--balance proxies to the app's instances and takes no remote host")
+		}
+	}
+
+	if flag.GetBool(ctx, "sticky") && balance == "" {
+		return errors.New("--sticky requires --balance")
+	}
+
+	socks5Addr := flag.GetString(ctx, "socks5")
+	if len(mappings) == 0 && socks5Addr == "" {
+		return errors.New("at least one port mapping, or --socks5, is required")
+	}
+
+	if path := flag.GetString(ctx, "unix"); path != "" {
+		if len(mappings) != 1 || mappings[0].Network != "tcp" {
+			return errors.New("--unix requires a single tcp port mapping")
+		}
+
+		mappings[0].Local = path
+	}
+
 	if promptInstance && appName == "" {
 		return errors.New("--app required when --select flag provided")
 	}
@@ -98,21 +188,49 @@ func run(ctx context.Context) (err error) {
 		return err
 	}
 
-	ports := strings.Split(args[0], ":")
+	io := iostreams.FromContext(ctx)
 
 	params := &proxy.ConnectParams{
-		Ports:            ports,
+		Mappings:         mappings,
 		AppName:          appName,
 		OrganizationSlug: orgSlug,
 		Dialer:           dialer,
 		PromptInstance:   promptInstance,
+		BindAddr:         flag.GetString(ctx, "bind-addr"),
+		SOCKS5Addr:       socks5Addr,
+		Balance:          balance,
+		Sticky:           flag.GetBool(ctx, "sticky"),
+		IdleTimeout:      time.Duration(flag.GetInt(ctx, "idle-timeout")) * time.Second,
+		DrainTimeout:     time.Duration(flag.GetInt(ctx, "drain-timeout")) * time.Second,
+		ShowStatus:       !flag.GetBool(ctx, "quiet") && io.IsStderrTTY(),
 	}
 
-	if len(args) > 1 {
-		params.RemoteHost = args[1]
+	if remoteHost != "" {
+		params.RemoteHost = remoteHost
 	} else {
 		params.RemoteHost = fmt.Sprintf("%s.internal", appName)
 	}
 
 	return proxy.Connect(ctx, params)
 }
+
+// parseArgs splits the arguments into port mappings and the remote host,
+// which is the last argument when it isn't a mapping itself.
+func parseArgs(args []string) (mappings []proxy.Mapping, remoteHost string, err error) {
+	for i, arg := range args {
+		m, err := proxy.ParseMapping(arg)
+		if err == nil {
+			mappings = append(mappings, m)
+
+			continue
+		}
+
+		if len(mappings) == 0 || i < len(args)-1 {
+			return nil, "", err
+		}
+
+		remoteHost = arg
+	}
+
+	return mappings, remoteHost, nil
+}
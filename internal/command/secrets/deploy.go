@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/app"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newDeploy() (cmd *cobra.Command) {
+	const (
+		long = `Deploy secrets staged with the --stage flag to the machines of an
+		application. Machines are all updated at once with their existing
+		configuration. Deployments of secrets can't be rolled back, since the
+		previous values of secrets can't be retrieved.`
+		short = "Deploy staged secrets to the machines of an application"
+		usage = "deploy [flags]"
+	)
+
+	cmd = command.New(usage, short, long, runDeploy, command.RequireSession, command.LoadAppNameIfPresent)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		strategyFlag,
+	)
+
+	return cmd
+}
+
+func runDeploy(ctx context.Context) (err error) {
+	if err = validateStrategy(ctx); err != nil {
+		return
+	}
+
+	client := client.FromContext(ctx).API()
+	appName := app.NameFromContext(ctx)
+	out := iostreams.FromContext(ctx).Out
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	if app.PlatformVersion != "machines" {
+		return errors.New("secrets deploy is only available for machines apps")
+	}
+
+	staged, err := loadStaged(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("failed loading staged secrets: %w", err)
+	}
+
+	if staged.empty() {
+		fmt.Fprintln(out, "No staged secrets recorded on this machine, deploying the current secrets")
+	} else {
+		if len(staged.Set) > 0 {
+			fmt.Fprintf(out, "Setting staged secrets: %s\n", strings.Join(staged.Set, ", "))
+		}
+		if len(staged.Unset) > 0 {
+			fmt.Fprintf(out, "Unsetting staged secrets: %s\n", strings.Join(staged.Unset, ", "))
+		}
+	}
+
+	return deployMachines(ctx, app)
+}
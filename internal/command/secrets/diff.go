@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/app"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+const (
+	diffAdded   = "added"
+	diffChanged = "changed"
+	diffMissing = "missing"
+	diffExtra   = "extra"
+)
+
+// errSecretsDrifted is returned when the local values don't match the
+// deployed ones, so that CI jobs fail on drift.
+var errSecretsDrifted = errors.New("local secrets differ from the deployed secrets")
+
+func newDiff() (cmd *cobra.Command) {
+	const (
+		long = `Compare the secrets in a local file against the secrets set on the
+		application. Local values are hashed the same way the deployed digests are
+		computed, so values never leave this machine.
+
+		Each differing secret is reported as one of:
+
+		  added    set in the local file, but not on the application
+		  changed  set in both, but the digests differ
+		  missing  declared in the local file without a value and not set on the application
+		  extra    set on the application, but not declared in the local file
+
+		The command exits with a non-zero status when any differences are found.`
+		short = "Compare local secret values against the deployed digests"
+		usage = "diff [flags]"
+	)
+
+	cmd = command.New(usage, short, long, runDiff, command.RequireSession, command.LoadAppNameIfPresent)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.String{
+			Name:        "from",
+			Description: "Path to a file of NAME=VALUE pairs, or - to read from stdin",
+			Default:     ".env",
+		},
+	)
+
+	return cmd
+}
+
+func runDiff(ctx context.Context) (err error) {
+	client := client.FromContext(ctx).API()
+	appName := app.NameFromContext(ctx)
+	out := iostreams.FromContext(ctx).Out
+	cfg := config.FromContext(ctx)
+
+	local, err := readLocalSecrets(flag.GetString(ctx, "from"))
+	if err != nil {
+		return err
+	}
+
+	deployed, err := client.GetAppSecrets(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	diffs := diffSecrets(local, deployed)
+
+	if cfg.JSONOutput {
+		if err := render.JSON(out, diffs); err != nil {
+			return err
+		}
+	} else if len(diffs) == 0 {
+		fmt.Fprintf(out, "Secrets for %s match the local values\n", appName)
+	} else {
+		var rows [][]string
+
+		for _, d := range diffs {
+			rows = append(rows, []string{d.Name, d.Status, d.LocalDigest, d.DeployedDigest})
+		}
+
+		if err := render.Table(out, "", rows, "Name", "Status", "Local Digest", "Deployed Digest"); err != nil {
+			return err
+		}
+	}
+
+	if len(diffs) > 0 {
+		return errSecretsDrifted
+	}
+
+	return nil
+}
+
+func readLocalSecrets(path string) (map[string]string, error) {
+	if path == "-" {
+		return parseSecrets(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening local secrets: %w", err)
+	}
+	defer f.Close()
+
+	return parseSecrets(f)
+}
+
+type secretDiff struct {
+	Name           string
+	Status         string
+	LocalDigest    string `json:",omitempty"`
+	DeployedDigest string `json:",omitempty"`
+}
+
+// diffSecrets compares local values against the deployed secrets. Secrets
+// which match are omitted from the result, which is sorted by name.
+func diffSecrets(local map[string]string, deployed []api.Secret) (diffs []secretDiff) {
+	remote := make(map[string]string, len(deployed))
+	for _, secret := range deployed {
+		remote[secret.Name] = secret.Digest
+	}
+
+	for name, value := range local {
+		deployedDigest, ok := remote[name]
+
+		switch {
+		case value == "" && !ok:
+			diffs = append(diffs, secretDiff{Name: name, Status: diffMissing})
+		case value == "":
+			// Declared without a value, so there's nothing to compare.
+		case !ok:
+			diffs = append(diffs, secretDiff{Name: name, Status: diffAdded, LocalDigest: digestSecret(value, "")})
+		case !digestMatches(value, deployedDigest):
+			diffs = append(diffs, secretDiff{
+				Name:           name,
+				Status:         diffChanged,
+				LocalDigest:    digestSecret(value, deployedDigest),
+				DeployedDigest: deployedDigest,
+			})
+		}
+	}
+
+	for name, digest := range remote {
+		if _, ok := local[name]; !ok {
+			diffs = append(diffs, secretDiff{Name: name, Status: diffExtra, DeployedDigest: digest})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+
+	return
+}
+
+// digestLength is the number of hex characters the API keeps of a secret's
+// SHA-256 digest.
+const digestLength = 16
+
+// digestSecret hashes value the way the API computes secret digests. When a
+// deployed digest is given, the result is truncated to the same length so the
+// two may be compared side by side.
+func digestSecret(value, deployedDigest string) string {
+	sum := sha256.Sum256([]byte(value))
+	digest := hex.EncodeToString(sum[:])
+
+	n := digestLength
+	if l := len(deployedDigest); l > 0 && l <= len(digest) {
+		n = l
+	}
+
+	return digest[:n]
+}
+
+func digestMatches(value, deployedDigest string) bool {
+	if deployedDigest == "" {
+		return false
+	}
+
+	return digestSecret(value, deployedDigest) == strings.ToLower(deployedDigest)
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/flyctl/api"
+)
+
+func TestParseSecrets(t *testing.T) {
+	const input = `# a comment
+FOO=bar
+MULTI="""line one
+line two"""
+EMPTY=
+`
+
+	secrets, err := parseSecrets(strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"FOO":   "bar",
+		"MULTI": "line one\nline two",
+		"EMPTY": "",
+	}, secrets)
+
+	_, err = parseSecrets(strings.NewReader("INVALID"))
+	assert.Error(t, err)
+}
+
+func TestDiffSecrets(t *testing.T) {
+	local := map[string]string{
+		"SAME":     "value",
+		"CHANGED":  "new",
+		"ADDED":    "value",
+		"DECLARED": "",
+		"MISSING":  "",
+	}
+
+	deployed := []api.Secret{
+		{Name: "SAME", Digest: digestSecret("value", "")},
+		{Name: "CHANGED", Digest: digestSecret("old", "")},
+		{Name: "DECLARED", Digest: digestSecret("whatever", "")},
+		{Name: "EXTRA", Digest: digestSecret("value", "")},
+	}
+
+	diffs := diffSecrets(local, deployed)
+
+	var got []string
+	for _, d := range diffs {
+		got = append(got, d.Name+":"+d.Status)
+	}
+
+	assert.Equal(t, []string{
+		"ADDED:added",
+		"CHANGED:changed",
+		"EXTRA:extra",
+		"MISSING:missing",
+	}, got)
+}
+
+func TestDigestMatches(t *testing.T) {
+	digest := digestSecret("value", "")
+
+	assert.Len(t, digest, digestLength)
+	assert.True(t, digestMatches("value", digest))
+	assert.True(t, digestMatches("value", strings.ToUpper(digest[:8])))
+	assert.False(t, digestMatches("other", digest))
+	assert.False(t, digestMatches("value", ""))
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/internal/app"
@@ -32,6 +34,10 @@ func newImport() (cmd *cobra.Command) {
 }
 
 func runImport(ctx context.Context) (err error) {
+	if err = validateStrategy(ctx); err != nil {
+		return
+	}
+
 	client := client.FromContext(ctx).API()
 	appName := app.NameFromContext(ctx)
 	app, err := client.GetAppCompact(ctx, appName)
@@ -39,13 +45,33 @@ func runImport(ctx context.Context) (err error) {
 		return
 	}
 
-	secrets := make(map[string]string)
+	secrets, err := parseSecrets(os.Stdin)
+	if err != nil {
+		return err
+	}
 
-	secretsString, err := ioutil.ReadAll(os.Stdin)
+	if len(secrets) < 1 {
+		return errors.New("requires at least one SECRET=VALUE pair")
+	}
+
+	release, err := client.SetSecrets(ctx, appName, secrets)
 	if err != nil {
 		return err
 	}
 
+	return deployForSecrets(ctx, app, release, stagedChanges{Set: lo.Keys(secrets)})
+}
+
+// parseSecrets reads NAME=VALUE pairs from r. Values wrapped in triple quotes
+// may span multiple lines and lines starting with # are ignored.
+func parseSecrets(r io.Reader) (map[string]string, error) {
+	secrets := make(map[string]string)
+
+	secretsString, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
 	secretsArray := strings.Split(string(secretsString), "\n")
 
 	parsestate := 0
@@ -55,8 +81,11 @@ func runImport(ctx context.Context) (err error) {
 	for _, line := range secretsArray {
 		switch parsestate {
 		case 0:
-			if line != "" {
+			if line != "" && !strings.HasPrefix(line, "#") {
 				parts := strings.SplitN(line, "=", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("Secrets must be provided as NAME=VALUE pairs (%s is invalid)", line)
+				}
 				if strings.HasPrefix(parts[1], "\"\"\"") {
 					// Switch to multiline
 					parsestate = 1
@@ -64,9 +93,6 @@ func runImport(ctx context.Context) (err error) {
 					parsebuffer.WriteString(strings.TrimPrefix(parts[1], "\"\"\""))
 					parsebuffer.WriteString("\n")
 				} else {
-					if len(parts) != 2 {
-						return fmt.Errorf("Secrets must be provided as NAME=VALUE pairs (%s is invalid)", line)
-					}
 					key := parts[0]
 					value := parts[1]
 					secrets[key] = value
@@ -90,14 +116,5 @@ func runImport(ctx context.Context) (err error) {
 		}
 	}
 
-	if len(secrets) < 1 {
-		return errors.New("requires at least one SECRET=VALUE pair")
-	}
-
-	release, err := client.SetSecrets(ctx, appName, secrets)
-	if err != nil {
-		return err
-	}
-
-	return deployForSecrets(ctx, app, release)
+	return secrets, nil
 }
@@ -23,6 +23,12 @@ var sharedFlags = flag.Set{
 		Name:        "stage",
 		Description: "Set secrets but skip deployment for machine apps",
 	},
+	strategyFlag,
+}
+
+var strategyFlag = flag.String{
+	Name:        "strategy",
+	Description: "The strategy for replacing running machines. The only option is immediate, since secrets deployments can't be rolled back.",
 }
 
 func New() *cobra.Command {
@@ -42,12 +48,14 @@ func New() *cobra.Command {
 		newSet(),
 		newUnset(),
 		newImport(),
+		newDiff(),
+		newDeploy(),
 	)
 
 	return secrets
 }
 
-func deployForSecrets(ctx context.Context, app *api.AppCompact, release *api.Release) (err error) {
+func deployForSecrets(ctx context.Context, app *api.AppCompact, release *api.Release, changes stagedChanges) (err error) {
 	out := iostreams.FromContext(ctx).Out
 
 	if flag.GetBool(ctx, "stage") {
@@ -56,7 +64,11 @@ func deployForSecrets(ctx context.Context, app *api.AppCompact, release *api.Rel
 			return errors.New("--stage isn't available for Nomad apps")
 		}
 
-		fmt.Fprint(out, "Secrets have been staged, but not set on VMs. Deploy or update machines in this app for the secrets to take effect.\n")
+		if err := recordStaged(ctx, app.Name, changes); err != nil {
+			return fmt.Errorf("failed recording staged secrets: %w", err)
+		}
+
+		fmt.Fprint(out, "Secrets have been staged, but not set on VMs. Run `flyctl secrets deploy` for the secrets to take effect.\n")
 		return
 	}
 
@@ -66,7 +78,7 @@ func deployForSecrets(ctx context.Context, app *api.AppCompact, release *api.Rel
 			fmt.Fprint(out, "The --detach option isn't available for Machine apps")
 		}
 
-		return deploy.DeployMachinesApp(ctx, app, "rolling", api.MachineConfig{}, nil)
+		return deployMachines(ctx, app)
 	}
 
 	if !app.Deployed {
@@ -84,3 +96,33 @@ func deployForSecrets(ctx context.Context, app *api.AppCompact, release *api.Rel
 
 	return err
 }
+
+// deployMachines restarts the app's machines with their existing config, so
+// they pick up the current secrets, and forgets any staged changes once done.
+// Machines are updated immediately, since the previous values of the secrets
+// a rolling deployment would roll back to can't be retrieved.
+func deployMachines(ctx context.Context, app *api.AppCompact) error {
+	strategy := flag.GetString(ctx, strategyFlag.Name)
+	if strategy == "" {
+		strategy = "immediate"
+	}
+
+	if err := deploy.DeployMachinesApp(ctx, app, strategy, api.MachineConfig{}, nil); err != nil {
+		return err
+	}
+
+	return clearStaged(ctx, app.Name)
+}
+
+// validateStrategy checks the strategy flag names a strategy secrets may be
+// deployed with, before any secret is changed.
+func validateStrategy(ctx context.Context) error {
+	switch strategy := flag.GetString(ctx, strategyFlag.Name); strategy {
+	case "", "immediate":
+		return nil
+	case "rolling":
+		return errors.New("secrets can't be deployed with the rolling strategy, since the previous values of secrets can't be retrieved to roll back to")
+	default:
+		return fmt.Errorf("invalid strategy %q: the only option is immediate", strategy)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/helpers"
@@ -33,6 +34,10 @@ func newSet() (cmd *cobra.Command) {
 }
 
 func runSet(ctx context.Context) (err error) {
+	if err = validateStrategy(ctx); err != nil {
+		return
+	}
+
 	client := client.FromContext(ctx).API()
 	appName := app.NameFromContext(ctx)
 	app, err := client.GetAppCompact(ctx, appName)
@@ -67,5 +72,5 @@ func runSet(ctx context.Context) (err error) {
 		return err
 	}
 
-	return deployForSecrets(ctx, app, release)
+	return deployForSecrets(ctx, app, release, stagedChanges{Set: lo.Keys(secrets)})
 }
@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/superfly/flyctl/internal/state"
+)
+
+// stagedFileName denotes the name of the file, relative to the config
+// directory, which records secret changes staged for machines apps.
+const stagedFileName = "staged_secrets.yml"
+
+// stagedChanges records the secrets which were set or unset with --stage and
+// haven't been deployed to the app's machines yet.
+type stagedChanges struct {
+	Set      []string  `yaml:"set,omitempty"`
+	Unset    []string  `yaml:"unset,omitempty"`
+	StagedAt time.Time `yaml:"staged_at"`
+}
+
+func (c *stagedChanges) empty() bool {
+	return c == nil || len(c.Set)+len(c.Unset) == 0
+}
+
+// merge folds next into c. A secret which is set after being unset (or vice
+// versa) is only recorded under its latest change.
+func (c *stagedChanges) merge(next stagedChanges) {
+	set := make(map[string]bool)
+	for _, name := range c.Set {
+		set[name] = true
+	}
+	for _, name := range c.Unset {
+		set[name] = false
+	}
+	for _, name := range next.Set {
+		set[name] = true
+	}
+	for _, name := range next.Unset {
+		set[name] = false
+	}
+
+	c.Set, c.Unset = nil, nil
+	for name, isSet := range set {
+		if isSet {
+			c.Set = append(c.Set, name)
+		} else {
+			c.Unset = append(c.Unset, name)
+		}
+	}
+	sort.Strings(c.Set)
+	sort.Strings(c.Unset)
+
+	c.StagedAt = next.StagedAt
+}
+
+func stagedPath(ctx context.Context) string {
+	return filepath.Join(state.ConfigDirectory(ctx), stagedFileName)
+}
+
+func loadAllStaged(ctx context.Context) (map[string]*stagedChanges, error) {
+	all := make(map[string]*stagedChanges)
+
+	data, err := os.ReadFile(stagedPath(ctx))
+	switch {
+	case os.IsNotExist(err):
+		return all, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	if all == nil {
+		all = make(map[string]*stagedChanges)
+	}
+
+	return all, nil
+}
+
+func saveAllStaged(ctx context.Context, all map[string]*stagedChanges) error {
+	data, err := yaml.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(stagedPath(ctx), data, 0o600)
+}
+
+// loadStaged returns the changes staged for the named app, or nil if there
+// are none.
+func loadStaged(ctx context.Context, appName string) (*stagedChanges, error) {
+	all, err := loadAllStaged(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return all[appName], nil
+}
+
+// recordStaged adds changes to the ones already staged for the named app.
+func recordStaged(ctx context.Context, appName string, changes stagedChanges) error {
+	all, err := loadAllStaged(ctx)
+	if err != nil {
+		return err
+	}
+
+	staged := all[appName]
+	if staged == nil {
+		staged = new(stagedChanges)
+		all[appName] = staged
+	}
+
+	changes.StagedAt = time.Now().UTC()
+	staged.merge(changes)
+
+	return saveAllStaged(ctx, all)
+}
+
+// clearStaged forgets the changes staged for the named app.
+func clearStaged(ctx context.Context, appName string) error {
+	all, err := loadAllStaged(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := all[appName]; !ok {
+		return nil
+	}
+	delete(all, appName)
+
+	return saveAllStaged(ctx, all)
+}
@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func TestStagedChangesMerge(t *testing.T) {
+	var staged stagedChanges
+	assert.True(t, staged.empty())
+
+	staged.merge(stagedChanges{Set: []string{"B", "A"}})
+	staged.merge(stagedChanges{Unset: []string{"A", "C"}})
+	staged.merge(stagedChanges{Set: []string{"C"}})
+
+	assert.Equal(t, []string{"B", "C"}, staged.Set)
+	assert.Equal(t, []string{"A"}, staged.Unset)
+	assert.False(t, staged.empty())
+}
+
+func TestValidateStrategy(t *testing.T) {
+	for strategy, valid := range map[string]bool{"": true, "rolling": false, "immediate": true, "bluegreen": false} {
+		fs := pflag.NewFlagSet("secrets", pflag.ContinueOnError)
+		fs.String(strategyFlag.Name, strategy, "")
+
+		err := validateStrategy(flag.NewContext(context.Background(), fs))
+		assert.Equal(t, valid, err == nil, strategy)
+	}
+}
@@ -29,6 +29,10 @@ func newUnset() (cmd *cobra.Command) {
 }
 
 func runUnset(ctx context.Context) (err error) {
+	if err = validateStrategy(ctx); err != nil {
+		return
+	}
+
 	client := client.FromContext(ctx).API()
 	appName := app.NameFromContext(ctx)
 	app, err := client.GetAppCompact(ctx, appName)
@@ -41,5 +45,5 @@ func runUnset(ctx context.Context) (err error) {
 		return err
 	}
 
-	return deployForSecrets(ctx, app, release)
+	return deployForSecrets(ctx, app, release, stagedChanges{Unset: flag.Args(ctx)})
 }
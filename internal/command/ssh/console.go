@@ -28,27 +28,36 @@ import (
 )
 
 func stdArgsSSH(cmd *cobra.Command) {
+	connArgsSSH(cmd)
+
 	flag.Add(cmd,
-		flag.Org(),
-		flag.App(),
-		flag.AppConfig(),
 		flag.String{
 			Name:        "command",
 			Shorthand:   "C",
 			Default:     "",
 			Description: "command to run on SSH session",
 		},
+		flag.String{
+			Name:        "region",
+			Shorthand:   "r",
+			Description: "Region to create WireGuard connection in",
+		},
+	)
+}
+
+// connArgsSSH adds the flags selecting the VM to connect to, which commands
+// needing -r for other purposes use in place of stdArgsSSH.
+func connArgsSSH(cmd *cobra.Command) {
+	flag.Add(cmd,
+		flag.Org(),
+		flag.App(),
+		flag.AppConfig(),
 		flag.Bool{
 			Name:        "select",
 			Shorthand:   "s",
 			Default:     false,
 			Description: "select available instances",
 		},
-		flag.String{
-			Name:        "region",
-			Shorthand:   "r",
-			Description: "Region to create WireGuard connection in",
-		},
 		flag.Bool{
 			Name:        "quiet",
 			Shorthand:   "q",
@@ -213,45 +222,86 @@ func runConsole(ctx context.Context) error {
 }
 
 func sshConnect(p *SSHParams, addr string) (*ssh.Client, error) {
-	terminal.Debugf("Fetching certificate for %s\n", addr)
+	var endSpin context.CancelFunc
+	if !p.DisableSpinner {
+		endSpin = spin(fmt.Sprintf("Connecting to %s...", addr),
+			fmt.Sprintf("Connecting to %s... complete\n", addr))
+		defer endSpin()
+	}
 
-	cert, pk, err := singleUseSSHCertificate(p.Ctx, p.Org)
+	sshClient, err := dialSSH(p, net.JoinHostPort(addr, "22"), "root")
 	if err != nil {
-		return nil, fmt.Errorf("create ssh certificate: %w (if you haven't created a key for your org yet, try `flyctl ssh establish`)", err)
+		return nil, errors.Wrap(err, "error connecting to SSH server")
+	}
+
+	terminal.Debugf("Connection to %s completed.\n", addr)
+
+	if !p.DisableSpinner {
+		endSpin()
 	}
 
-	pemkey := ssh.MarshalED25519PrivateKey(pk, "single-use certificate")
+	return sshClient, nil
+}
+
+// dialSSH connects to the SSH server at addr as user. Agents which share SSH
+// connections are asked for theirs, which saves handshaking with the server
+// anew; others are merely dialed through.
+func dialSSH(p *SSHParams, addr, user string) (*ssh.Client, error) {
+	credentials := p.Credentials
+	if credentials == nil {
+		// issued once, whether the agent shares its connection or not
+		credentials = onceCredentials(sshCredentials(p.Org))
+	}
+
+	if mux, ok := p.Dialer.(agent.SSHMultiplexer); ok {
+		client, err := mux.DialSSH(p.Ctx, addr, user, credentials)
+		switch {
+		case err == nil:
+			return ssh.Attach(addr, user, client), nil
+		case !errors.Is(err, agent.ErrUnsupportedCommand) && !errors.Is(err, agent.ErrSSHNotShared):
+			return nil, err
+		}
+
+		terminal.Debugf("agent doesn't share SSH connections; connecting directly\n")
+	}
+
+	cert, privateKey, err := credentials(p.Ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	terminal.Debugf("Keys for %s configured; connecting...\n", addr)
 
 	sshClient := &ssh.Client{
-		Addr: net.JoinHostPort(addr, "22"),
-		User: "root",
+		Addr: addr,
+		User: user,
 
 		Dial: p.Dialer.DialContext,
 
-		Certificate: cert.Certificate,
-		PrivateKey:  string(pemkey),
-	}
-
-	var endSpin context.CancelFunc
-	if !p.DisableSpinner {
-		endSpin = spin(fmt.Sprintf("Connecting to %s...", addr),
-			fmt.Sprintf("Connecting to %s... complete\n", addr))
-		defer endSpin()
+		Certificate: cert,
+		PrivateKey:  privateKey,
 	}
 
 	if err := sshClient.Connect(p.Ctx); err != nil {
-		return nil, errors.Wrap(err, "error connecting to SSH server")
+		return nil, err
 	}
 
-	terminal.Debugf("Connection completed.\n", addr)
+	return sshClient, nil
+}
 
-	if !p.DisableSpinner {
-		endSpin()
-	}
+// sshCredentials returns a func issuing single use credentials for the
+// organization.
+func sshCredentials(org api.OrganizationImpl) agent.SSHCredentialsFunc {
+	return func(ctx context.Context) (string, string, error) {
+		terminal.Debugf("Fetching certificate for %s\n", org.GetSlug())
 
-	return sshClient, nil
+		cert, pk, err := singleUseSSHCertificate(ctx, org)
+		if err != nil {
+			return "", "", fmt.Errorf("create ssh certificate: %w (if you haven't created a key for your org yet, try `flyctl ssh establish`)", err)
+		}
+
+		return cert.Certificate, string(ssh.MarshalED25519PrivateKey(pk, "single-use certificate")), nil
+	}
 }
 
 func addrForMachines(ctx context.Context, app *api.AppCompact, console bool) (addr string, err error) {
@@ -0,0 +1,385 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/ssh"
+
+	"github.com/superfly/flyctl/internal/app"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newExec() *cobra.Command {
+	const (
+		short = "Run a command on many instances of the current app"
+		long  = short + `, in parallel.
+
+A single argument is run as a shell command line, so that it may use pipes
+and the like. Several arguments are quoted, each remaining a single argument
+of the command they make up.
+
+Each line of output is prefixed with the ID of the instance it comes from.
+A summary of the exit statuses is printed once the command has run
+everywhere. Select the instances with --all or --region.
+`
+		usage = "exec <command>"
+	)
+
+	cmd := command.New(usage, short, long, runExec, command.RequireSession, command.LoadAppNameIfPresent)
+
+	cmd.Args = cobra.MinimumNArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Bool{
+			Name:        "all",
+			Description: "Run the command on every instance",
+		},
+		flag.StringSlice{
+			Name:        "region",
+			Shorthand:   "r",
+			Description: "Run the command on the instances in these regions",
+		},
+		flag.Int{
+			Name:        "parallel",
+			Shorthand:   "p",
+			Default:     4,
+			Description: "Number of instances to run the command on at a time",
+		},
+	)
+
+	return cmd
+}
+
+// execTarget is an instance exec runs the command on.
+type execTarget struct {
+	ID     string
+	Region string
+	Addr   string
+}
+
+// execResult is how running the command on an instance went.
+type execResult struct {
+	execTarget
+	ExitStatus int
+	Err        error
+	Took       time.Duration
+}
+
+var errNoTargets = errors.New("select the instances to run the command on with --all or --region")
+
+func runExec(ctx context.Context) error {
+	var (
+		all      = flag.GetBool(ctx, "all")
+		regions  = flag.GetStringSlice(ctx, "region")
+		parallel = flag.GetInt(ctx, "parallel")
+		cmd      = execCommand(flag.Args(ctx))
+	)
+
+	if !all && len(regions) == 0 {
+		return errNoTargets
+	}
+
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+
+	client := client.FromContext(ctx).API()
+	appName := app.NameFromContext(ctx)
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("get app: %w", err)
+	}
+
+	targets, err := execTargets(ctx, app)
+	if err != nil {
+		return err
+	}
+
+	targets = filterTargets(targets, all, regions)
+
+	if len(targets) == 0 {
+		return fmt.Errorf("app %s has no running instances to run the command on", app.Name)
+	}
+
+	_, dialer, err := bringUp(ctx, client, app)
+	if err != nil {
+		return err
+	}
+
+	var (
+		io  = iostreams.FromContext(ctx)
+		mu  sync.Mutex // serializes output lines
+		eg  errgroup.Group
+		res = make([]execResult, len(targets))
+	)
+	eg.SetLimit(parallel)
+
+	// a single certificate does for every instance
+	credentials := onceCredentials(sshCredentials(app.Organization))
+
+	for i, target := range targets {
+		i, target := i, target
+
+		eg.Go(func() error {
+			stdout := newPrefixWriter(&mu, io.Out, target.ID)
+			stderr := newPrefixWriter(&mu, io.ErrOut, target.ID)
+
+			params := &SSHParams{
+				Ctx:            ctx,
+				Org:            app.Organization,
+				Dialer:         dialer,
+				App:            app.Name,
+				Cmd:            cmd,
+				Stdin:          strings.NewReader(""),
+				Stdout:         stdout,
+				Stderr:         stderr,
+				DisableSpinner: true,
+				Credentials:    credentials,
+			}
+
+			res[i] = execOn(params, target)
+
+			_ = stdout.Close()
+			_ = stderr.Close()
+
+			return nil
+		})
+	}
+
+	_ = eg.Wait()
+
+	fmt.Fprintln(io.Out)
+
+	rows, failed := summarize(res)
+
+	if err := render.Table(io.Out, "Summary", rows, "Instance", "Region", "Address", "Exit Status", "Took"); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d instances", failed, len(res))
+	}
+
+	return nil
+}
+
+// execOn runs the command of the params on the target.
+func execOn(params *SSHParams, target execTarget) (res execResult) {
+	res.execTarget = target
+
+	start := time.Now()
+	defer func() {
+		res.Took = time.Since(start)
+	}()
+
+	sshc, err := sshConnect(params, target.Addr)
+	if err != nil {
+		res.Err = err
+
+		return
+	}
+	defer sshc.Close()
+
+	term := &ssh.Terminal{
+		Stdin:  params.Stdin,
+		Stdout: params.Stdout,
+		Stderr: params.Stderr,
+	}
+
+	res.ExitStatus, res.Err = exitStatus(sshc.Shell(params.Ctx, term, params.Cmd))
+
+	return
+}
+
+// exitStatus splits the error running a command returned into the command's
+// exit status and the error which kept it from running, if any.
+func exitStatus(err error) (int, error) {
+	var exitErr *xssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+
+	return 0, err
+}
+
+// summarize returns the rows of the summary of the results along with the
+// number of instances the command failed on.
+func summarize(res []execResult) (rows [][]string, failed int) {
+	rows = make([][]string, 0, len(res))
+	for _, r := range res {
+		status := fmt.Sprint(r.ExitStatus)
+		if r.Err != nil {
+			status = r.Err.Error()
+		}
+
+		if r.Err != nil || r.ExitStatus != 0 {
+			failed++
+		}
+
+		rows = append(rows, []string{r.ID, r.Region, r.Addr, status, r.Took.Round(time.Millisecond).String()})
+	}
+
+	return
+}
+
+// filterTargets returns the targets in the regions, or all of them.
+func filterTargets(targets []execTarget, all bool, regions []string) []execTarget {
+	if all {
+		return targets
+	}
+
+	return lo.Filter(targets, func(t execTarget, _ int) bool {
+		return lo.Contains(regions, t.Region)
+	})
+}
+
+// execCommand returns the command line the arguments make up. A single
+// argument is taken to be a command line already.
+func execCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, helpers.ShellQuote(arg))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// execTargets returns the running instances of the app.
+func execTargets(ctx context.Context, app *api.AppCompact) ([]execTarget, error) {
+	if app.PlatformVersion != "machines" {
+		status, err := client.FromContext(ctx).API().GetAppStatus(ctx, app.Name, false)
+		if err != nil {
+			return nil, fmt.Errorf("get app status: %w", err)
+		}
+
+		var targets []execTarget
+		for _, alloc := range status.Allocations {
+			if alloc.Status == "running" && alloc.PrivateIP != "" {
+				targets = append(targets, execTarget{ID: alloc.IDShort, Region: alloc.Region, Addr: alloc.PrivateIP})
+			}
+		}
+
+		return targets, nil
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	machines, err := flapsClient.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []execTarget
+	for _, m := range machines {
+		if m.State == "started" {
+			targets = append(targets, execTarget{ID: m.ID, Region: m.Region, Addr: m.PrivateIP})
+		}
+	}
+
+	return targets, nil
+}
+
+// onceCredentials returns a func which calls fn once and returns what it
+// returned ever after.
+func onceCredentials(fn agent.SSHCredentialsFunc) agent.SSHCredentialsFunc {
+	var (
+		once             sync.Once
+		cert, privateKey string
+		err              error
+	)
+
+	return func(ctx context.Context) (string, string, error) {
+		once.Do(func() {
+			cert, privateKey, err = fn(ctx)
+		})
+
+		return cert, privateKey, err
+	}
+}
+
+// prefixWriter prefixes the lines written to it before writing them to w.
+// Writers sharing a mutex write whole lines, so that their output doesn't
+// interleave.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(mu *sync.Mutex, w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		mu:     mu,
+		w:      w,
+		prefix: []byte(prefix + ": "),
+	}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Close writes what's left of the last line.
+func (pw *prefixWriter) Close() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+
+	line := append(pw.buf, '\n')
+	pw.buf = nil
+
+	return pw.writeLine(line)
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	_, err := pw.w.Write(append(pw.prefix[:len(pw.prefix):len(pw.prefix)], line...))
+
+	return err
+}
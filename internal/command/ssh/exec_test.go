@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+	)
+
+	a := newPrefixWriter(&mu, &out, "a")
+	b := newPrefixWriter(&mu, &out, "b")
+
+	_, err := a.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+
+	// partial lines are held back until they're complete
+	_, err = b.Write([]byte("three\n"))
+	require.NoError(t, err)
+
+	_, err = a.Write([]byte("o\nfour"))
+	require.NoError(t, err)
+
+	require.NoError(t, a.Close())
+	require.NoError(t, b.Close())
+
+	assert.Equal(t, "a: one\nb: three\na: two\na: four\n", out.String())
+}
+
+func TestExecCommand(t *testing.T) {
+	assert.Equal(t, "ls -l | wc -l", execCommand([]string{"ls -l | wc -l"}))
+	assert.Equal(t, "echo 'a b' '' 'it'\"'\"'s' /data/x.db", execCommand([]string{"echo", "a b", "", "it's", "/data/x.db"}))
+}
+
+func TestFilterTargets(t *testing.T) {
+	targets := []execTarget{
+		{ID: "a", Region: "ord"},
+		{ID: "b", Region: "ams"},
+		{ID: "c", Region: "ord"},
+	}
+
+	assert.Equal(t, targets, filterTargets(targets, true, nil))
+	assert.Equal(t, []execTarget{targets[0], targets[2]}, filterTargets(targets, false, []string{"ord"}))
+	assert.Empty(t, filterTargets(targets, false, []string{"syd"}))
+}
+
+func TestSummarize(t *testing.T) {
+	status, err := exitStatus(nil)
+	assert.Zero(t, status)
+	assert.NoError(t, err)
+
+	refused := errors.New("connection refused")
+	_, err = exitStatus(refused)
+	assert.Equal(t, refused, err)
+
+	rows, failed := summarize([]execResult{
+		{execTarget: execTarget{ID: "a", Region: "ord", Addr: "fdaa::1"}},
+		{execTarget: execTarget{ID: "b", Region: "ord", Addr: "fdaa::2"}, ExitStatus: 2},
+		{execTarget: execTarget{ID: "c", Region: "ams", Addr: "fdaa::3"}, Err: refused},
+	})
+
+	assert.Equal(t, 2, failed)
+	assert.Equal(t, [][]string{
+		{"a", "ord", "fdaa::1", "0", "0s"},
+		{"b", "ord", "fdaa::2", "2", "0s"},
+		{"c", "ams", "fdaa::3", "connection refused", "0s"},
+	}, rows)
+}
@@ -9,6 +9,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -36,6 +37,8 @@ func NewSFTP() *cobra.Command {
 		newFind(),
 		newSFTPShell(),
 		newGet(),
+		newPut(),
+		newSync(),
 	)
 
 	return cmd
@@ -86,6 +89,38 @@ func newGet() *cobra.Command {
 
 }
 
+func newPut() *cobra.Command {
+	const (
+		long = `The SFTP PUT uploads a file, or a directory and its contents with
+--recursive, to a remote VM. Files which already exist on the VM are left
+alone. Interrupted uploads resume where they left off when run again.`
+		short = "Upload a file or directory to a remote VM"
+		usage = "put <local-path> [remote-path]"
+	)
+
+	cmd := command.New(usage, short, long, runPut, command.RequireSession, command.LoadAppNameIfPresent)
+
+	cmd.Args = cobra.RangeArgs(1, 2)
+
+	connArgsSSH(cmd)
+
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "recursive",
+			Shorthand:   "r",
+			Description: "Upload directories and their contents, keeping the local permissions",
+		},
+		flag.String{
+			Name:        "mode",
+			Shorthand:   "m",
+			Default:     "0644",
+			Description: "Permissions of the uploaded file",
+		},
+	)
+
+	return cmd
+}
+
 func newSFTPConnection(ctx context.Context) (*sftp.Client, error) {
 	client := client.FromContext(ctx).API()
 	appName := app.NameFromContext(ctx)
@@ -201,6 +236,58 @@ func runGet(ctx context.Context) error {
 	return nil
 }
 
+func runPut(ctx context.Context) error {
+	args := flag.Args(ctx)
+
+	local := args[0]
+	remote := path.Base(filepath.ToSlash(local))
+	if len(args) > 1 {
+		remote = args[1]
+	}
+
+	perm, err := strconv.ParseInt(flag.GetString(ctx, "mode"), 8, 16)
+	if err != nil {
+		return fmt.Errorf("put: invalid permissions (only numeric allowed): %w", err)
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return fmt.Errorf("put: local file %s: %w", local, err)
+	}
+
+	if info.IsDir() && !flag.GetBool(ctx, "recursive") {
+		return fmt.Errorf("put: local file %s: is a directory; pass --recursive to upload it", local)
+	}
+
+	ftp, err := newSFTPConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	if info.IsDir() {
+		if err := putDir(ftp, local, remote, func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		}); err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+
+		return nil
+	}
+
+	if _, err := ftp.Stat(remote); err == nil {
+		return fmt.Errorf("put: remote file %s: already exists", remote)
+	}
+
+	offset, bytes, err := upload(ftp, local, remote, fs.FileMode(perm))
+	if err != nil {
+		return fmt.Errorf("put: %w (%d bytes written)", err, bytes)
+	}
+
+	fmt.Printf("%d bytes written to %s%s\n", bytes, remote, resumedAt(offset))
+	return nil
+}
+
 var completer = readline.NewPrefixCompleter(
 	readline.PcItem("ls"),
 	readline.PcItem("cd"),
@@ -398,25 +485,26 @@ func (sc *sftpContext) put(args ...string) error {
 	fgs := goflag.NewFlagSet("put", goflag.ContinueOnError)
 
 	perm := fgs.String("m", "0644", "file mode")
+	recursive := fgs.Bool("r", false, "upload directories and their contents")
 
-	permbits, err := strconv.ParseInt(*perm, 8, 16)
-	if err != nil {
-		sc.out("put: invalid permissions (only numeric allowed) '%s': %s", *perm, err)
+	if err := fgs.Parse(args[1:]); err != nil {
+		sc.out("put [-m mode] [-r] <local-filename> [filename]")
 		return nil
 	}
 
-	if err := fgs.Parse(args[1:]); err != nil {
-		sc.out("put [-m] <local-filename> [filename]")
+	permbits, err := strconv.ParseInt(*perm, 8, 16)
+	if err != nil {
+		sc.out("put: invalid permissions (only numeric allowed) '%s': %s", *perm, err)
 		return nil
 	}
 
 	lpath := fgs.Arg(0)
 	if lpath == "" {
-		sc.out("put [-m] <local-filename> [filename]")
+		sc.out("put [-m mode] [-r] <local-filename> [filename]")
 		return nil
 	}
 
-	rpath := sc.wd + path.Base(lpath)
+	rpath := sc.wd + path.Base(filepath.ToSlash(lpath))
 	if rarg := fgs.Arg(1); rarg != "" {
 		if rarg[0] == '/' {
 			rpath = rarg
@@ -425,38 +513,38 @@ func (sc *sftpContext) put(args ...string) error {
 		}
 	}
 
-	if _, err = sc.ftp.Stat(rpath); err == nil {
-		sc.out("put %s -> %s: file exists on VM", lpath, rpath)
-		return nil
-	}
-
-	f, err := os.Open(lpath)
+	inf, err := os.Stat(lpath)
 	if err != nil {
 		sc.out("put %s -> %s: open local file: %s", lpath, rpath, err)
 		return nil
 	}
-	defer f.Close()
 
-	rf, err := sc.ftp.OpenFile(rpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
-	if err != nil {
-		sc.out("put %s -> %s: create remote file: %s", lpath, rpath, err)
+	if inf.IsDir() {
+		if !*recursive {
+			sc.out("put %s -> %s: is a directory (use -r)", lpath, rpath)
+			return nil
+		}
+
+		if err = putDir(sc.ftp, lpath, rpath, sc.out); err != nil {
+			sc.out("put %s -> %s: %s", lpath, rpath, err)
+		}
+
 		return nil
 	}
-	defer rf.Close()
 
-	bytes, err := rf.ReadFrom(f)
-	if err != nil {
-		sc.out("put %s -> %s: copy file file: %s (%d bytes written)", lpath, rpath, err, bytes)
+	if _, err = sc.ftp.Stat(rpath); err == nil {
+		sc.out("put %s -> %s: file exists on VM", lpath, rpath)
 		return nil
 	}
 
-	sc.out("%d bytes written", bytes)
-
-	if err = sc.ftp.Chmod(rpath, fs.FileMode(permbits)); err != nil {
-		sc.out("put %s -> %s: set permissions: %s", lpath, rpath, err)
+	offset, bytes, err := upload(sc.ftp, lpath, rpath, fs.FileMode(permbits))
+	if err != nil {
+		sc.out("put %s -> %s: %s (%d bytes written)", lpath, rpath, err, bytes)
 		return nil
 	}
 
+	sc.out("%d bytes written%s", bytes, resumedAt(offset))
+
 	return nil
 }
 
@@ -0,0 +1,545 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+const (
+	// partialSuffix ends the names of the files uploads write to until
+	// they're complete, which lets interrupted uploads resume. See
+	// partialName.
+	partialSuffix = ".flypart"
+
+	// resumeSlack is how much of the tail of a partial file is uploaded anew
+	// when resuming. Writes are issued concurrently, 64 packets of 32KiB at a
+	// time, so an interrupted upload may have left holes that far back.
+	resumeSlack = 2 << 20
+)
+
+func newSync() *cobra.Command {
+	const (
+		long = `The SFTP SYNC command mirrors a local directory to a remote VM.
+
+Files are uploaded when they're missing from the VM or differ from the local
+ones in size or modification time. With --delete, what the VM has that the
+local directory doesn't is removed. Interrupted uploads resume where they
+left off when run again.`
+		short = "Mirror a local directory to a remote VM"
+		usage = "sync <local-dir> <remote-dir>"
+	)
+
+	cmd := command.New(usage, short, long, runSync, command.RequireSession, command.LoadAppNameIfPresent)
+
+	cmd.Args = cobra.ExactArgs(2)
+
+	connArgsSSH(cmd)
+
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "delete",
+			Description: "Remove the remote files and directories missing from the local directory",
+		},
+		flag.Bool{
+			Name:        "dry-run",
+			Shorthand:   "n",
+			Description: "Print what would be done without doing it",
+		},
+	)
+
+	return cmd
+}
+
+func runSync(ctx context.Context) error {
+	var (
+		args   = flag.Args(ctx)
+		lroot  = args[0]
+		rroot  = path.Clean(args[1])
+		del    = flag.GetBool(ctx, "delete")
+		dryRun = flag.GetBool(ctx, "dry-run")
+	)
+
+	if del && protectedRoot(rroot) {
+		return fmt.Errorf("sync: refusing to --delete in %s; pick a directory of your own", rroot)
+	}
+
+	if info, err := os.Stat(lroot); err != nil {
+		return fmt.Errorf("sync: local directory %s: %w", lroot, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("sync: local directory %s: not a directory", lroot)
+	}
+
+	local, skipped, err := localTree(lroot)
+	if err != nil {
+		return fmt.Errorf("sync: walk local directory %s: %w", lroot, err)
+	}
+
+	for _, p := range skipped {
+		fmt.Printf("skipping %s: not a regular file\n", p)
+	}
+
+	ftp, err := newSFTPConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	remote, err := remoteTree(ftp, rroot)
+	if err != nil {
+		return fmt.Errorf("sync: walk remote directory %s: %w", rroot, err)
+	}
+
+	ops := planSync(local, remote, del)
+
+	if dryRun {
+		for _, op := range ops {
+			fmt.Printf("%s %s\n", op.Action, path.Join(rroot, op.Path))
+		}
+
+		return nil
+	}
+
+	if err := ftp.MkdirAll(rroot); err != nil {
+		return fmt.Errorf("sync: create remote directory %s: %w", rroot, err)
+	}
+
+	var (
+		uploaded, deleted, failed int
+		sent                      int64
+	)
+
+	for _, op := range ops {
+		lpath := filepath.Join(lroot, filepath.FromSlash(op.Path))
+		rpath := path.Join(rroot, op.Path)
+
+		var err error
+		switch op.Action {
+		case syncConflict:
+			err = errors.New("a directory on one side and a file on the other; pass --delete to replace it")
+		case syncDelete:
+			if err = ftp.Remove(rpath); err == nil {
+				fmt.Printf("deleted %s\n", rpath)
+				deleted++
+			}
+		case syncMkdir:
+			err = ftp.Mkdir(rpath)
+		case syncUpload:
+			var offset, n int64
+			if offset, n, err = upload(ftp, lpath, rpath, local[op.Path].Mode().Perm()); err == nil {
+				fmt.Printf("%s (%s)%s\n", rpath, humanize.Bytes(uint64(n)), resumedAt(offset))
+				uploaded++
+			}
+			sent += n
+		}
+
+		if err != nil {
+			fmt.Printf("sync %s: %s\n", rpath, err)
+			failed++
+		}
+	}
+
+	fmt.Printf("%d uploaded (%s), %d deleted, %d up to date\n",
+		uploaded, humanize.Bytes(uint64(sent)), deleted, countFiles(local)-countUploads(ops))
+
+	if failed > 0 {
+		return fmt.Errorf("sync: %d of %d operations failed", failed, len(ops))
+	}
+
+	return nil
+}
+
+// protectedRoots are the directories sync refuses to delete in, which hold the
+// system of the VM rather than its data.
+var protectedRoots = map[string]bool{
+	"/": true, ".": true, "..": true,
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true,
+	"/lib": true, "/lib64": true, "/opt": true, "/proc": true, "/root": true,
+	"/run": true, "/sbin": true, "/srv": true, "/sys": true, "/tmp": true,
+	"/usr": true, "/var": true,
+}
+
+// protectedRoot reports whether the remote directory is one sync refuses to
+// delete in: those of protectedRoots, the home directory relative paths
+// resolve against, or one above it.
+func protectedRoot(rroot string) bool {
+	rroot = path.Clean(rroot)
+
+	return protectedRoots[rroot] || strings.HasPrefix(rroot, "../")
+}
+
+// putDir uploads the local directory and its contents to rroot, leaving the
+// files which already exist on the VM alone. Those alike in size and
+// modification time, which an interrupted run left, are skipped; others
+// fail.
+func putDir(ftp *sftp.Client, lroot, rroot string, out func(string, ...interface{})) error {
+	local, skipped, err := localTree(lroot)
+	if err != nil {
+		return fmt.Errorf("walk local directory %s: %w", lroot, err)
+	}
+
+	for _, p := range skipped {
+		out("skipping %s: not a regular file", p)
+	}
+
+	if err := ftp.MkdirAll(rroot); err != nil {
+		return fmt.Errorf("create remote directory %s: %w", rroot, err)
+	}
+
+	var failed int
+	for _, p := range local.paths() {
+		lpath := filepath.Join(lroot, filepath.FromSlash(p))
+		rpath := path.Join(rroot, p)
+
+		info := local[p]
+		if info.IsDir() {
+			if err := ftp.MkdirAll(rpath); err != nil {
+				out("put %s -> %s: create remote directory: %s", lpath, rpath, err)
+				failed++
+			}
+
+			continue
+		}
+
+		if rinfo, err := ftp.Stat(rpath); err == nil {
+			if !sameFile(info, rinfo) {
+				out("put %s -> %s: file exists on VM", lpath, rpath)
+				failed++
+			}
+
+			// files alike were uploaded by a previous run
+			continue
+		}
+
+		offset, n, err := upload(ftp, lpath, rpath, info.Mode().Perm())
+		if err != nil {
+			out("put %s -> %s: %s (%d bytes written)", lpath, rpath, err, n)
+			failed++
+
+			continue
+		}
+
+		out("%s (%s)%s", rpath, humanize.Bytes(uint64(n)), resumedAt(offset))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d entries failed to upload", failed, len(local))
+	}
+
+	return nil
+}
+
+// upload copies the local file to rpath with the given permissions and the
+// modification time of the local file. The file is written under a partial
+// name and moved in place once complete; when a previous attempt left one
+// behind, the upload resumes at the returned offset.
+func upload(ftp *sftp.Client, lpath, rpath string, perm fs.FileMode) (offset, sent int64, err error) {
+	f, err := os.Open(lpath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open local file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("stat local file: %w", err)
+	}
+
+	partial := partialName(rpath, info)
+	if pinfo, err := ftp.Stat(partial); err == nil {
+		offset = resumeOffset(pinfo, info)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	rf, err := ftp.OpenFile(partial, flags)
+	if err != nil {
+		return 0, 0, fmt.Errorf("create remote file: %w", err)
+	}
+	defer rf.Close()
+
+	if offset > 0 {
+		if err = rf.Truncate(offset); err != nil {
+			return 0, 0, fmt.Errorf("truncate partial file: %w", err)
+		}
+
+		if _, err = rf.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, fmt.Errorf("seek partial file: %w", err)
+		}
+	}
+
+	if sent, err = rf.ReadFrom(io.NewSectionReader(f, offset, info.Size()-offset)); err != nil {
+		return offset, sent, fmt.Errorf("copy file: %w", err)
+	}
+
+	if err = rf.Close(); err != nil {
+		return offset, sent, fmt.Errorf("close remote file: %w", err)
+	}
+
+	if err = ftp.Chmod(partial, perm); err != nil {
+		return offset, sent, fmt.Errorf("set permissions: %w", err)
+	}
+
+	if err = ftp.Chtimes(partial, info.ModTime(), info.ModTime()); err != nil {
+		return offset, sent, fmt.Errorf("set modification time: %w", err)
+	}
+
+	if err = replace(ftp, partial, rpath); err != nil {
+		return offset, sent, fmt.Errorf("move partial file in place: %w", err)
+	}
+
+	return offset, sent, nil
+}
+
+// partialName returns the name of the partial file uploads of the local file
+// to rpath write to. It records the size and modification time of the local
+// file, so that only uploads of the same version of it resume from it.
+func partialName(rpath string, local fs.FileInfo) string {
+	return fmt.Sprintf("%s.%d-%d%s", rpath, local.Size(), local.ModTime().Unix(), partialSuffix)
+}
+
+// resumeOffset returns the offset to resume uploading the file at, given the
+// partial file a previous upload of the same version of it left.
+func resumeOffset(partial, file fs.FileInfo) int64 {
+	if !partial.Mode().IsRegular() || partial.Size() > file.Size() {
+		return 0
+	}
+
+	if offset := partial.Size() - resumeSlack; offset > 0 {
+		return offset
+	}
+
+	return 0
+}
+
+func resumedAt(offset int64) string {
+	if offset == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(", resumed at %s", humanize.Bytes(uint64(offset)))
+}
+
+// replace renames oldname to newname, replacing what's there.
+func replace(ftp *sftp.Client, oldname, newname string) error {
+	if err := ftp.PosixRename(oldname, newname); err == nil {
+		return nil
+	}
+
+	// servers lacking the posix-rename extension don't rename over files
+	if err := ftp.Remove(newname); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return ftp.Rename(oldname, newname)
+}
+
+// tree maps the paths of the entries of a directory, slash separated and
+// relative to it, to their info.
+type tree map[string]fs.FileInfo
+
+// paths returns the paths of the tree in lexical order, which lists
+// directories before their contents.
+func (t tree) paths() []string {
+	paths := make([]string, 0, len(t))
+	for p := range t {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func (t tree) isFile(p string) bool {
+	info, ok := t[p]
+
+	return ok && !info.IsDir()
+}
+
+// resumes reports whether p names the partial file uploading the version of
+// the file the tree holds resumes from.
+func (t tree) resumes(p string) bool {
+	if !strings.HasSuffix(p, partialSuffix) {
+		return false
+	}
+
+	// strip the suffix and the version to get at the name of the file
+	target := strings.TrimSuffix(p, partialSuffix)
+	if i := strings.LastIndexByte(target, '.'); i >= 0 {
+		target = target[:i]
+	}
+
+	return t.isFile(target) && p == partialName(target, t[target])
+}
+
+func countFiles(t tree) (n int) {
+	for _, info := range t {
+		if !info.IsDir() {
+			n++
+		}
+	}
+
+	return
+}
+
+// localTree walks the local directory. Entries which are neither regular
+// files nor directories, symlinks included, are returned as skipped.
+func localTree(root string) (t tree, skipped []string, err error) {
+	t = tree{}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			skipped = append(skipped, p)
+
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		t[filepath.ToSlash(rel)] = info
+
+		return nil
+	})
+
+	return
+}
+
+// remoteTree walks the remote directory, which is empty when it doesn't
+// exist.
+func remoteTree(ftp *sftp.Client, root string) (tree, error) {
+	t := tree{}
+	prefix := strings.TrimSuffix(root, "/") + "/"
+
+	walker := ftp.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root && errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+
+			return nil, err
+		}
+
+		if walker.Path() == root {
+			if !walker.Stat().IsDir() {
+				return nil, fmt.Errorf("%s: not a directory", root)
+			}
+
+			continue
+		}
+
+		t[strings.TrimPrefix(walker.Path(), prefix)] = walker.Stat()
+	}
+
+	return t, nil
+}
+
+type syncAction string
+
+const (
+	syncConflict syncAction = "conflict"
+	syncDelete   syncAction = "delete"
+	syncMkdir    syncAction = "mkdir"
+	syncUpload   syncAction = "upload"
+)
+
+func countUploads(ops []syncOp) (n int) {
+	for _, op := range ops {
+		if op.Action == syncUpload {
+			n++
+		}
+	}
+
+	return
+}
+
+// syncOp is an operation mirroring a local directory to a remote one takes.
+type syncOp struct {
+	Action syncAction
+	Path   string
+}
+
+// planSync returns the operations which mirror the local tree to the remote
+// one: conflicts first, then deletions, children before their parents, then
+// directories to create and files to upload, parents before their children.
+// Files are uploaded when they differ in size or modification time. When del
+// is false nothing is deleted, and entries which are a directory on one side
+// and a file on the other are conflicts.
+func planSync(local, remote tree, del bool) []syncOp {
+	var conflicts, deletes, creates []syncOp
+
+	for _, p := range remote.paths() {
+		l, ok := local[p]
+
+		switch {
+		case ok && l.IsDir() == remote[p].IsDir():
+			continue
+		case local.resumes(p):
+			continue
+		case !del && ok:
+			conflicts = append(conflicts, syncOp{Action: syncConflict, Path: p})
+		case del:
+			deletes = append(deletes, syncOp{Action: syncDelete, Path: p})
+		}
+	}
+
+	for _, p := range local.paths() {
+		l := local[p]
+		r, ok := remote[p]
+
+		replaced := ok && l.IsDir() != r.IsDir()
+		if replaced && !del {
+			continue
+		}
+
+		switch {
+		case l.IsDir():
+			if !ok || replaced {
+				creates = append(creates, syncOp{Action: syncMkdir, Path: p})
+			}
+		case !ok || replaced || !sameFile(l, r):
+			creates = append(creates, syncOp{Action: syncUpload, Path: p})
+		}
+	}
+
+	// children go before their parents
+	for i, j := 0, len(deletes)-1; i < j; i, j = i+1, j-1 {
+		deletes[i], deletes[j] = deletes[j], deletes[i]
+	}
+
+	return append(append(conflicts, deletes...), creates...)
+}
+
+// sameFile reports whether the files look alike by size and modification
+// time, to the second since that's what SFTP keeps.
+func sameFile(a, b fs.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Unix() == b.ModTime().Unix()
+}
@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInfo struct {
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi fakeInfo) Name() string       { return "" }
+func (fi fakeInfo) Size() int64        { return fi.size }
+func (fi fakeInfo) ModTime() time.Time { return fi.modTime }
+func (fi fakeInfo) IsDir() bool        { return fi.dir }
+func (fi fakeInfo) Sys() interface{}   { return nil }
+
+func (fi fakeInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+func TestPlanSync(t *testing.T) {
+	then := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	dir := fakeInfo{dir: true}
+
+	local := tree{
+		"a":           dir,
+		"a/same":      fakeInfo{size: 1, modTime: then},
+		"a/touched":   fakeInfo{size: 1, modTime: then.Add(time.Second)},
+		"a/grown":     fakeInfo{size: 2, modTime: then},
+		"a/new":       fakeInfo{size: 1, modTime: then},
+		"b":           dir,
+		"b/c":         fakeInfo{size: 1, modTime: then},
+		"was-dir":     fakeInfo{size: 1, modTime: then},
+		"interrupted": fakeInfo{size: 1, modTime: then},
+	}
+
+	// a partial file of another version of interrupted
+	remoteStale := fakeInfo{size: 2, modTime: then}
+
+	remote := tree{
+		"a":         dir,
+		"a/same":    fakeInfo{size: 1, modTime: then.Add(time.Millisecond)},
+		"a/touched": fakeInfo{size: 1, modTime: then},
+		"a/grown":   fakeInfo{size: 1, modTime: then},
+		"a/stale":   fakeInfo{size: 1, modTime: then},
+		"gone":      dir,
+		"gone/x":    fakeInfo{size: 1, modTime: then},
+		"was-dir":   dir,
+		"was-dir/y": fakeInfo{size: 1, modTime: then},
+		partialName("interrupted", local["interrupted"]): fakeInfo{size: 1, modTime: then},
+		partialName("interrupted", remoteStale):          fakeInfo{size: 1, modTime: then},
+		"abandoned" + partialSuffix:                      fakeInfo{size: 1, modTime: then},
+	}
+
+	assert.Equal(t, []syncOp{
+		{Action: syncConflict, Path: "was-dir"},
+		{Action: syncUpload, Path: "a/grown"},
+		{Action: syncUpload, Path: "a/new"},
+		{Action: syncUpload, Path: "a/touched"},
+		{Action: syncMkdir, Path: "b"},
+		{Action: syncUpload, Path: "b/c"},
+		{Action: syncUpload, Path: "interrupted"},
+	}, planSync(local, remote, false))
+
+	assert.Equal(t, []syncOp{
+		{Action: syncDelete, Path: "was-dir/y"},
+		{Action: syncDelete, Path: "was-dir"},
+		{Action: syncDelete, Path: partialName("interrupted", remoteStale)},
+		{Action: syncDelete, Path: "gone/x"},
+		{Action: syncDelete, Path: "gone"},
+		{Action: syncDelete, Path: "abandoned" + partialSuffix},
+		{Action: syncDelete, Path: "a/stale"},
+		{Action: syncUpload, Path: "a/grown"},
+		{Action: syncUpload, Path: "a/new"},
+		{Action: syncUpload, Path: "a/touched"},
+		{Action: syncMkdir, Path: "b"},
+		{Action: syncUpload, Path: "b/c"},
+		{Action: syncUpload, Path: "interrupted"},
+		{Action: syncUpload, Path: "was-dir"},
+	}, planSync(local, remote, true))
+}
+
+func TestResumeOffset(t *testing.T) {
+	then := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	file := fakeInfo{size: 10 << 20, modTime: then}
+
+	assert.Equal(t, "/data/seed.db.10485760-1654084800"+partialSuffix, partialName("/data/seed.db", file))
+
+	assert.Equal(t, int64(3<<20), resumeOffset(fakeInfo{size: 5 << 20}, file))
+
+	// too little to resume past the slack
+	assert.Zero(t, resumeOffset(fakeInfo{size: 1 << 20}, file))
+
+	assert.Zero(t, resumeOffset(fakeInfo{size: 11 << 20}, file))
+}
+
+func TestProtectedRoot(t *testing.T) {
+	for _, p := range []string{"/", "/usr/", ".", "", "../x", "/etc"} {
+		assert.True(t, protectedRoot(p), p)
+	}
+
+	for _, p := range []string{"/data", "/data/seed", "seed", "/usr/local/app"} {
+		assert.False(t, protectedRoot(p), p)
+	}
+}
+
+func TestLocalTree(t *testing.T) {
+	root := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "b", "c"), []byte("c"), 0644))
+
+	tr, _, err := localTree(root)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "a/b", "a/b/c"}, tr.paths())
+	assert.True(t, tr.isFile("a/b/c"))
+	assert.False(t, tr.isFile("a/b"))
+	assert.Equal(t, 1, countFiles(tr))
+}
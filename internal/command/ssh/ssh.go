@@ -16,6 +16,7 @@ func New() *cobra.Command {
 
 	cmd.AddCommand(
 		newConsole(),
+		newExec(),
 		newIssue(),
 		newLog(),
 		NewSFTP(),
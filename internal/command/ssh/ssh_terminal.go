@@ -9,7 +9,6 @@ import (
 	"crypto/ed25519"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"time"
 
@@ -21,7 +20,6 @@ import (
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/helpers"
 	"github.com/superfly/flyctl/ssh"
-	"github.com/superfly/flyctl/terminal"
 )
 
 func spin(in, out string) context.CancelFunc {
@@ -56,6 +54,10 @@ type SSHParams struct {
 	Stdout         io.WriteCloser
 	Stderr         io.WriteCloser
 	DisableSpinner bool
+
+	// Credentials, when set, provides the credentials to connect with in
+	// place of ones issued for the connection.
+	Credentials agent.SSHCredentialsFunc
 }
 
 func RunSSHCommand(ctx context.Context, app *api.AppCompact, dialer agent.Dialer, addr string, cmd string) ([]byte, error) {
@@ -89,45 +91,12 @@ func RunSSHCommand(ctx context.Context, app *api.AppCompact, dialer agent.Dialer
 }
 
 func SSHConnect(p *SSHParams, addr string) error {
-	terminal.Debugf("Fetching certificate for %s\n", addr)
-
-	cert, pk, err := singleUseSSHCertificate(p.Ctx, p.Org)
+	sshClient, err := sshConnect(p, addr)
 	if err != nil {
-		return fmt.Errorf("create ssh certificate: %w (if you haven't created a key for your org yet, try `flyctl ssh establish`)", err)
-	}
-
-	pemkey := ssh.MarshalED25519PrivateKey(pk, "single-use certificate")
-
-	terminal.Debugf("Keys for %s configured; connecting...\n", addr)
-
-	sshClient := &ssh.Client{
-		Addr: net.JoinHostPort(addr, "22"),
-		User: "root",
-
-		Dial: p.Dialer.DialContext,
-
-		Certificate: cert.Certificate,
-		PrivateKey:  string(pemkey),
-	}
-
-	var endSpin context.CancelFunc
-	if !p.DisableSpinner {
-		endSpin = spin(fmt.Sprintf("Connecting to %s...", addr),
-			fmt.Sprintf("Connecting to %s... complete\n", addr))
-		defer endSpin()
-	}
-
-	if err := sshClient.Connect(context.Background()); err != nil {
-		return errors.Wrap(err, "error connecting to SSH server")
+		return err
 	}
 	defer sshClient.Close()
 
-	terminal.Debugf("Connection completed.\n", addr)
-
-	if !p.DisableSpinner {
-		endSpin()
-	}
-
 	term := &ssh.Terminal{
 		Stdin:  p.Stdin,
 		Stdout: p.Stdout,
@@ -70,7 +70,9 @@ func runExtend(ctx context.Context) error {
 
 	sizeGB := flag.GetInt(ctx, "size")
 	if sizeGB == 0 {
-		return fmt.Errorf("Volume size must be specified")
+		if sizeGB, err = promptSuggestedSize(ctx, volID); err != nil {
+			return err
+		}
 	}
 
 	if app.PlatformVersion == "nomad" {
@@ -90,7 +92,7 @@ func runExtend(ctx context.Context) error {
 
 	input := api.ExtendVolumeInput{
 		VolumeID: volID,
-		SizeGb:   flag.GetInt(ctx, "size"),
+		SizeGb:   sizeGB,
 	}
 
 	volume, err := client.ExtendVolume(ctx, input)
@@ -114,3 +116,40 @@ func runExtend(ctx context.Context) error {
 
 	return nil
 }
+
+// promptSuggestedSize suggests a size based on the usage growth recorded by
+// `volumes list --usage` and asks whether to extend the volume to it.
+func promptSuggestedSize(ctx context.Context, volID string) (int, error) {
+	client := client.FromContext(ctx).API()
+
+	volume, err := client.GetVolume(ctx, volID)
+	if err != nil {
+		return 0, fmt.Errorf("failed retrieving volume: %w", err)
+	}
+
+	history, err := loadUsageHistory(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed loading volume usage history: %w", err)
+	}
+
+	suggested, ok := suggestSize(history[volID], volume.SizeGb)
+	if !ok {
+		return 0, fmt.Errorf("Volume size must be specified. Run `flyctl volumes list --usage` over time to get a suggested size")
+	}
+
+	msg := fmt.Sprintf("Based on the observed growth, %dGB should last about %d days. Extend volume %s to %dGB?",
+		suggested, int(suggestionHorizon.Hours()/24), volID, suggested)
+
+	switch confirmed, err := prompt.Confirm(ctx, msg); {
+	case err == nil:
+		if !confirmed {
+			return 0, fmt.Errorf("Volume size must be specified")
+		}
+	case prompt.IsNonInteractive(err):
+		return 0, prompt.NonInteractiveError(fmt.Sprintf("size flag must be specified when not running interactively (suggested size: %dGB)", suggested))
+	default:
+		return 0, err
+	}
+
+	return suggested, nil
+}
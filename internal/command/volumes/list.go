@@ -3,14 +3,19 @@ package volumes
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 
+	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/terminal"
 
 	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
 	"github.com/superfly/flyctl/internal/app"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/config"
@@ -33,6 +38,14 @@ func newList() *cobra.Command {
 	flag.Add(cmd,
 		flag.App(),
 		flag.AppConfig(),
+		flag.Bool{
+			Name:        "usage",
+			Description: "Show the used and free space of volumes attached to started machines",
+		},
+		flag.String{
+			Name:        "warn-at",
+			Description: "Exit with a non-zero status when a volume's usage reaches this percentage, e.g. 80%, or with status 2 when the usage of an attached volume can't be determined. Implies --usage",
+		},
 	)
 
 	return cmd
@@ -49,10 +62,42 @@ func runList(ctx context.Context) error {
 		return fmt.Errorf("failed retrieving volumes: %w", err)
 	}
 
+	var warnAt float64
+	if v := flag.GetString(ctx, "warn-at"); v != "" {
+		if warnAt, err = parsePercent(v); err != nil {
+			return err
+		}
+	}
+
+	var usage map[string]*volumeUsage
+	if flag.GetBool(ctx, "usage") || warnAt > 0 {
+		if usage, err = gatherUsage(ctx, appName, volumes); err != nil {
+			return err
+		}
+	}
+
 	out := iostreams.FromContext(ctx).Out
 
 	if cfg.JSONOutput {
-		return render.JSON(out, volumes)
+		if usage == nil {
+			return render.JSON(out, volumes)
+		}
+
+		type volumeWithUsage struct {
+			api.Volume
+			Usage *volumeUsage `json:",omitempty"`
+		}
+
+		withUsage := make([]volumeWithUsage, 0, len(volumes))
+		for _, volume := range volumes {
+			withUsage = append(withUsage, volumeWithUsage{volume, usage[volume.ID]})
+		}
+
+		if err := render.JSON(out, withUsage); err != nil {
+			return err
+		}
+
+		return checkUsage(volumes, usage, warnAt)
 	}
 
 	rows := make([][]string, 0, len(volumes))
@@ -73,7 +118,7 @@ func runList(ctx context.Context) error {
 			}
 		}
 
-		rows = append(rows, []string{
+		row := []string{
 			volume.ID,
 			volume.State,
 			volume.Name,
@@ -83,8 +128,123 @@ func runList(ctx context.Context) error {
 			fmt.Sprint(volume.Encrypted),
 			attachedVMID,
 			humanize.Time(volume.CreatedAt),
-		})
+		}
+
+		if usage != nil {
+			var used, free string
+			if u := usage[volume.ID]; u != nil {
+				used = fmt.Sprintf("%s (%.0f%%)", humanize.IBytes(u.UsedBytes), u.Percent())
+				free = humanize.IBytes(u.FreeBytes())
+			}
+			row = append(row, used, free)
+		}
+
+		rows = append(rows, row)
+	}
+
+	cols := []string{"ID", "State", "Name", "Size", "Region", "Zone", "Encrypted", "Attached VM", "Created At"}
+	if usage != nil {
+		cols = append(cols, "Used", "Free")
+	}
+
+	if err := render.Table(out, "", rows, cols...); err != nil {
+		return err
+	}
+
+	return checkUsage(volumes, usage, warnAt)
+}
+
+// gatherUsage fetches the usage of the volumes attached to started machines.
+// Volumes whose usage can't be determined are left out of the result.
+func gatherUsage(ctx context.Context, appName string, volumes []api.Volume) (map[string]*volumeUsage, error) {
+	var (
+		io     = iostreams.FromContext(ctx)
+		client = client.FromContext(ctx).API()
+		usage  = make(map[string]*volumeUsage)
+	)
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return nil, err
 	}
 
-	return render.Table(out, "", rows, "ID", "State", "Name", "Size", "Region", "Zone", "Encrypted", "Attached VM", "Created At")
+	if app.PlatformVersion != "machines" {
+		return nil, fmt.Errorf("volume usage is only available for machines apps")
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return nil, fmt.Errorf("could not make flaps client: %w", err)
+	}
+
+	for _, volume := range volumes {
+		if volume.AttachedMachine == nil {
+			continue
+		}
+
+		u, err := fetchUsage(ctx, flapsClient, volume.AttachedMachine.ID, volume.ID)
+		if err != nil {
+			fmt.Fprintf(io.ErrOut, "Could not determine usage of volume %s: %s\n", volume.ID, err)
+			continue
+		}
+
+		usage[volume.ID] = u
+	}
+
+	if err := recordUsage(ctx, usage); err != nil {
+		terminal.Debugf("failed recording volume usage: %v\n", err)
+	}
+
+	return usage, nil
+}
+
+// usageUnknownError is returned by checkUsage when the usage of some of the
+// volumes couldn't be determined. Its exit status tells monitors that the
+// volumes may be full rather than that they are.
+type usageUnknownError struct {
+	volumes []string
+}
+
+func (e *usageUnknownError) Error() string {
+	return fmt.Sprintf("couldn't determine the usage of volumes: %s", strings.Join(e.volumes, ", "))
+}
+
+func (*usageUnknownError) ExitCode() int {
+	return 2
+}
+
+// checkUsage returns an error when any of the volumes' usage reaches the
+// warnAt percentage, so that monitoring may rely on the exit status. Volumes
+// attached to machines whose usage is unknown yield a usageUnknownError,
+// unless others are over warnAt.
+func checkUsage(volumes []api.Volume, usage map[string]*volumeUsage, warnAt float64) error {
+	if warnAt <= 0 {
+		return nil
+	}
+
+	var over, unknown []string
+	for _, volume := range volumes {
+		u := usage[volume.ID]
+
+		switch {
+		case u == nil && volume.AttachedMachine != nil:
+			unknown = append(unknown, volume.ID)
+		case u != nil && u.Percent() >= warnAt:
+			over = append(over, volume.ID)
+		}
+	}
+
+	sort.Strings(over)
+	sort.Strings(unknown)
+
+	switch {
+	case len(over) > 0 && len(unknown) > 0:
+		return fmt.Errorf("volumes at or above %.0f%% usage: %s (usage of %s unknown)", warnAt, strings.Join(over, ", "), strings.Join(unknown, ", "))
+	case len(over) > 0:
+		return fmt.Errorf("volumes at or above %.0f%% usage: %s", warnAt, strings.Join(over, ", "))
+	case len(unknown) > 0:
+		return &usageUnknownError{volumes: unknown}
+	default:
+		return nil
+	}
 }
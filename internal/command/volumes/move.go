@@ -0,0 +1,331 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/app"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/watch"
+)
+
+func newMove() *cobra.Command {
+	const (
+		long = `Move a volume, and the machine it's attached to, to another region.
+
+The attached machine is leased and stopped, and the volume is snapshotted. Once
+complete, the snapshot is restored into a new volume in the target region, and a
+clone of the machine mounting the new volume is started there. The original
+machine and volume are only destroyed once the clone has started and passed its
+health checks.`
+
+		short = "Move a volume and its machine to another region"
+
+		usage = "move <id>"
+	)
+
+	cmd := command.New(usage, short, long, runMove,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Region(),
+		flag.Yes(),
+	)
+
+	return cmd
+}
+
+func runMove(ctx context.Context) (err error) {
+	var (
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+		client   = client.FromContext(ctx).API()
+		appName  = app.NameFromContext(ctx)
+		volID    = flag.FirstArg(ctx)
+		region   = flag.GetRegion(ctx)
+	)
+
+	if region == "" {
+		return errors.New("--region must be specified")
+	}
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	if app.PlatformVersion != "machines" {
+		return errors.New("volumes can only be moved for machines apps")
+	}
+
+	vol, err := client.GetVolume(ctx, volID)
+	if err != nil {
+		return fmt.Errorf("failed retrieving volume: %w", err)
+	}
+
+	if vol.Region == region {
+		return fmt.Errorf("volume %s is already in region %s", vol.ID, region)
+	}
+
+	if vol.AttachedMachine == nil {
+		return fmt.Errorf("volume %s isn't attached to a machine", vol.ID)
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return fmt.Errorf("could not make flaps client: %w", err)
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	source, err := flapsClient.Get(ctx, vol.AttachedMachine.ID)
+	if err != nil {
+		return err
+	}
+
+	if !flag.GetYes(ctx) {
+		msg := fmt.Sprintf("Machine %s will be stopped while volume %s is moved from %s to %s. Continue?",
+			source.ID, vol.ID, vol.Region, region)
+
+		switch confirmed, err := prompt.Confirm(ctx, msg); {
+		case err == nil:
+			if !confirmed {
+				return nil
+			}
+		case prompt.IsNonInteractive(err):
+			return prompt.NonInteractiveError("yes flag must be specified when not running interactively")
+		default:
+			return err
+		}
+	}
+
+	// Keep others from updating or deploying to the machine while it's moved.
+	source, releaseLeaseFunc, err := mach.AcquireLeaseWithTTL(ctx, source, moveLeaseTTL)
+	var destroyed bool
+	defer func() {
+		if !destroyed {
+			releaseLeaseFunc(ctx, source)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Stopping machine %s\n", colorize.Bold(source.ID))
+
+	if err := flapsClient.Stop(ctx, api.StopMachineInput{ID: source.ID}); err != nil {
+		return err
+	}
+
+	// From here on, the source machine is brought back up should anything fail
+	// before the clone is healthy.
+	restartSource := func(cause error) error {
+		fmt.Fprintf(io.ErrOut, "Move failed, starting machine %s again\n", source.ID)
+
+		if _, err := flapsClient.Start(ctx, source.ID); err != nil {
+			return fmt.Errorf("%w (failed starting machine %s again: %v)", cause, source.ID, err)
+		}
+
+		return cause
+	}
+
+	if err := mach.WaitForStartOrStop(ctx, source, "stop", 5*time.Minute); err != nil {
+		return restartSource(err)
+	}
+
+	fmt.Fprintf(io.Out, "Snapshotting volume %s\n", colorize.Bold(vol.ID))
+
+	snapshot, err := createSnapshot(ctx, vol.ID)
+	if err != nil {
+		return restartSource(err)
+	}
+
+	fmt.Fprintf(io.Out, "Restoring snapshot %s into a new volume in %s\n", colorize.Bold(snapshot.ID), colorize.Bold(region))
+
+	newVol, err := client.CreateVolume(ctx, api.CreateVolumeInput{
+		AppID:      app.ID,
+		Name:       vol.Name,
+		Region:     region,
+		SizeGb:     vol.SizeGb,
+		Encrypted:  vol.Encrypted,
+		SnapshotID: api.StringPointer(snapshot.ID),
+	})
+	if err != nil {
+		return restartSource(fmt.Errorf("failed restoring snapshot: %w", err))
+	}
+
+	config, err := mach.CloneConfig(*source.Config)
+	if err != nil {
+		return restartSource(err)
+	}
+	config.Image = source.FullImageRef()
+
+	for i, mnt := range config.Mounts {
+		if mnt.Volume == vol.ID {
+			config.Mounts[i].Volume = newVol.ID
+		}
+	}
+
+	fmt.Fprintf(io.Out, "Cloning machine %s into %s\n", colorize.Bold(source.ID), colorize.Bold(region))
+
+	clone, err := flapsClient.Launch(ctx, api.LaunchMachineInput{
+		AppID:  app.Name,
+		Name:   cloneName(source.Name, region),
+		Region: region,
+		Config: config,
+	})
+	if err != nil {
+		return restartSource(discardVolume(ctx, newVol, err))
+	}
+
+	if err = mach.WaitForStartOrStop(ctx, clone, "start", 5*time.Minute); err == nil {
+		err = watch.MachinesChecks(ctx, []*api.Machine{clone})
+	}
+	if err != nil {
+		err = fmt.Errorf("machine %s failed to start: %w", clone.ID, err)
+
+		if e := flapsClient.Destroy(ctx, api.RemoveMachineInput{AppID: app.Name, ID: clone.ID, Kill: true}); e != nil {
+			return restartSource(fmt.Errorf("%w (failed destroying machine %s: %v)", err, clone.ID, e))
+		}
+
+		return restartSource(discardVolume(ctx, newVol, err))
+	}
+
+	fmt.Fprintf(io.Out, "Destroying machine %s and volume %s\n", colorize.Bold(source.ID), colorize.Bold(vol.ID))
+
+	if err := flapsClient.Destroy(ctx, api.RemoveMachineInput{AppID: app.Name, ID: source.ID}); err != nil {
+		return fmt.Errorf("failed destroying machine %s: %w", source.ID, err)
+	}
+	destroyed = true
+
+	if _, err := client.DeleteVolume(ctx, vol.ID); err != nil {
+		return fmt.Errorf("failed destroying volume %s: %w", vol.ID, err)
+	}
+
+	fmt.Fprintf(io.Out, "Moved volume %s to %s as %s, attached to machine %s\n",
+		vol.ID, region, colorize.Bold(newVol.ID), colorize.Bold(clone.ID))
+
+	return nil
+}
+
+// moveLeaseTTL is how long the lease on the moved machine lasts. It covers
+// stopping the machine, snapshotting its volume and starting its clone.
+const moveLeaseTTL = 30 * time.Minute
+
+// cloneName names the clone of the machine so that it doesn't collide with
+// the machine itself, which still exists while its clone starts.
+func cloneName(name, region string) string {
+	if name == "" {
+		return ""
+	}
+
+	return name + "-" + region
+}
+
+// createSnapshot snapshots the volume and waits for the snapshot to complete,
+// returning it.
+func createSnapshot(ctx context.Context, volID string) (*api.Snapshot, error) {
+	client := client.FromContext(ctx).API()
+
+	existing, err := client.GetVolumeSnapshots(ctx, volID)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving snapshots: %w", err)
+	}
+
+	seen := make(map[string]bool, len(existing))
+	for _, snapshot := range existing {
+		seen[snapshot.ID] = true
+	}
+
+	if err := client.CreateVolumeSnapshot(ctx, volID); err != nil {
+		return nil, fmt.Errorf("failed creating snapshot: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	b := &backoff.Backoff{
+		Min:    time.Second,
+		Max:    10 * time.Second,
+		Factor: 2,
+	}
+
+	// The mutation doesn't return the snapshot it creates, so it's told apart
+	// from the existing ones first and then fetched by its ID, which the API
+	// only resolves once the snapshot is stored.
+	var snapshotID string
+	for {
+		if snapshotID == "" {
+			snapshots, err := client.GetVolumeSnapshots(ctx, volID)
+			if err != nil {
+				return nil, fmt.Errorf("failed retrieving snapshots: %w", err)
+			}
+
+			if snapshot := newSnapshot(snapshots, seen); snapshot != nil {
+				snapshotID = snapshot.ID
+			}
+		}
+
+		if snapshotID != "" {
+			switch snapshot, err := client.GetVolumeSnapshot(ctx, snapshotID); {
+			case err == nil && snapshot.ID == snapshotID:
+				return snapshot, nil
+			case err != nil && !api.IsNotFoundError(err):
+				return nil, fmt.Errorf("failed retrieving snapshot %s: %w", snapshotID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for snapshot of volume %s: %w", volID, ctx.Err())
+		case <-time.After(b.Duration()):
+		}
+	}
+}
+
+// newSnapshot returns the latest of the snapshots which aren't seen.
+func newSnapshot(snapshots []api.Snapshot, seen map[string]bool) *api.Snapshot {
+	var latest *api.Snapshot
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		if seen[snapshot.ID] {
+			continue
+		}
+
+		if latest == nil || snapshot.CreatedAt.After(latest.CreatedAt) {
+			latest = snapshot
+		}
+	}
+
+	return latest
+}
+
+// discardVolume deletes a volume created during a failed move and returns
+// cause, annotated should the deletion fail as well.
+func discardVolume(ctx context.Context, vol *api.Volume, cause error) error {
+	client := client.FromContext(ctx).API()
+
+	if _, err := client.DeleteVolume(ctx, vol.ID); err != nil {
+		return fmt.Errorf("%w (failed destroying volume %s: %v)", cause, vol.ID, err)
+	}
+
+	return cause
+}
@@ -0,0 +1,34 @@
+package volumes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	seen := map[string]bool{"old": true}
+
+	snapshots := []api.Snapshot{
+		{ID: "old", CreatedAt: now.Add(-time.Hour)},
+		{ID: "new", CreatedAt: now},
+		{ID: "newer", CreatedAt: now.Add(time.Minute)},
+	}
+
+	assert.Nil(t, newSnapshot(snapshots[:1], seen))
+
+	snapshot := newSnapshot(snapshots, seen)
+	require.NotNil(t, snapshot)
+	assert.Equal(t, "newer", snapshot.ID)
+}
+
+func TestCloneName(t *testing.T) {
+	assert.Equal(t, "web-ams", cloneName("web", "ams"))
+	assert.Empty(t, cloneName("", "ams"))
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 
+	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/iostreams"
 
 	"github.com/superfly/flyctl/client"
@@ -28,6 +30,13 @@ number to operate. This can be found through the volumes list command`
 	)
 	cmd.Args = cobra.ExactArgs(1)
 
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "usage",
+			Description: "Show the used and free space of the volume, when attached to a started machine",
+		},
+	)
+
 	return
 }
 
@@ -44,9 +53,40 @@ func runShow(ctx context.Context) error {
 
 	out := iostreams.FromContext(ctx).Out
 
+	var usage *volumeUsage
+	if flag.GetBool(ctx, "usage") && volume.AttachedMachine != nil {
+		all, err := gatherUsage(ctx, volume.App.Name, []api.Volume{*volume})
+		if err != nil {
+			return err
+		}
+
+		usage = all[volume.ID]
+	}
+
 	if cfg.JSONOutput {
-		return render.JSON(out, volume)
+		if usage == nil {
+			return render.JSON(out, volume)
+		}
+
+		return render.JSON(out, struct {
+			*api.Volume
+			Usage *volumeUsage
+		}{volume, usage})
+	}
+
+	if err := printVolume(out, volume); err != nil {
+		return err
+	}
+
+	switch {
+	case !flag.GetBool(ctx, "usage"):
+		break
+	case volume.AttachedMachine == nil:
+		fmt.Fprintf(out, "%10s: %s\n", "Usage", "unavailable, the volume isn't attached to a machine")
+	case usage != nil:
+		fmt.Fprintf(out, "%10s: %s (%.0f%%)\n", "Used", humanize.IBytes(usage.UsedBytes), usage.Percent())
+		fmt.Fprintf(out, "%10s: %s\n", "Free", humanize.IBytes(usage.FreeBytes()))
 	}
 
-	return printVolume(out, volume)
+	return nil
 }
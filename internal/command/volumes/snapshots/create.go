@@ -0,0 +1,47 @@
+package snapshots
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func newCreate() *cobra.Command {
+	const (
+		long  = "Create an on-demand snapshot of the specified volume"
+		short = "Create a snapshot"
+
+		usage = "create <volume-id>"
+	)
+
+	cmd := command.New(usage, short, long, runCreate,
+		command.RequireSession,
+	)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	return cmd
+}
+
+func runCreate(ctx context.Context) error {
+	var (
+		io     = iostreams.FromContext(ctx)
+		client = client.FromContext(ctx).API()
+		volID  = flag.FirstArg(ctx)
+	)
+
+	if err := client.CreateVolumeSnapshot(ctx, volID); err != nil {
+		return fmt.Errorf("failed creating snapshot: %w", err)
+	}
+
+	fmt.Fprintf(io.Out, "Scheduled a snapshot of volume %s. Run `flyctl volumes snapshots list %s` to follow its progress.\n", volID, volID)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package snapshots
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/prompt"
+)
+
+func newDelete() *cobra.Command {
+	const (
+		long  = "Delete one or more volume snapshots by ID"
+		short = "Delete snapshots"
+
+		usage = "delete <snapshot-id>..."
+	)
+
+	cmd := command.New(usage, short, long, runDelete,
+		command.RequireSession,
+	)
+
+	cmd.Args = cobra.MinimumNArgs(1)
+	cmd.Aliases = []string{"destroy", "rm"}
+
+	flag.Add(cmd,
+		flag.Yes(),
+	)
+
+	return cmd
+}
+
+func runDelete(ctx context.Context) error {
+	ids := flag.Args(ctx)
+
+	if !flag.GetYes(ctx) {
+		switch confirmed, err := prompt.Confirmf(ctx, "Are you sure you want to delete %d snapshot(s)?", len(ids)); {
+		case err == nil:
+			if !confirmed {
+				return nil
+			}
+		case prompt.IsNonInteractive(err):
+			return prompt.NonInteractiveError("yes flag must be specified when not running interactively")
+		default:
+			return err
+		}
+	}
+
+	return deleteSnapshots(ctx, ids...)
+}
+
+// deleteSnapshots deletes the snapshots, reporting each on stdout or, when
+// JSON is output, on stderr.
+func deleteSnapshots(ctx context.Context, ids ...string) error {
+	var (
+		io     = iostreams.FromContext(ctx)
+		client = client.FromContext(ctx).API()
+		out    = io.Out
+	)
+
+	if config.FromContext(ctx).JSONOutput {
+		out = io.ErrOut
+	}
+
+	for _, id := range ids {
+		if err := client.DeleteVolumeSnapshot(ctx, id); err != nil {
+			return fmt.Errorf("failed deleting snapshot %s: %w", id, err)
+		}
+
+		fmt.Fprintf(out, "Deleted snapshot %s\n", id)
+	}
+
+	return nil
+}
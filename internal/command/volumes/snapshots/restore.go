@@ -0,0 +1,150 @@
+package snapshots
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/app"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newRestore() *cobra.Command {
+	const (
+		long = `Restore a snapshot into a new volume. The volume is created in the
+region given by --region, which may differ from the region of the snapshotted
+volume. --size, which defaults to the size of the snapshotted volume, must be at
+least as large as the snapshotted volume.`
+
+		short = "Restore a snapshot into a new volume"
+
+		usage = "restore <snapshot-id>"
+	)
+
+	cmd := command.New(usage, short, long, runRestore,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Region(),
+		flag.String{
+			Name:        "name",
+			Description: "Name of the new volume",
+		},
+		flag.Int{
+			Name:        "size",
+			Shorthand:   "s",
+			Description: "Size of the new volume in gigabytes. Defaults to the size of the snapshotted volume",
+		},
+		flag.Bool{
+			Name:        "no-encryption",
+			Description: "Do not encrypt the volume contents",
+			Default:     false,
+		},
+		flag.Bool{
+			Name:        "require-unique-zone",
+			Description: "Require volume to be placed in separate hardware zone from existing volumes",
+			Default:     true,
+		},
+	)
+
+	return cmd
+}
+
+func runRestore(ctx context.Context) error {
+	var (
+		cfg    = config.FromContext(ctx)
+		io     = iostreams.FromContext(ctx)
+		client = client.FromContext(ctx).API()
+
+		snapshotID = flag.FirstArg(ctx)
+		appName    = app.NameFromContext(ctx)
+		volumeName = flag.GetString(ctx, "name")
+	)
+
+	if volumeName == "" {
+		return fmt.Errorf("--name must be specified")
+	}
+
+	appID, err := client.GetAppID(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	region, err := prompt.Region(ctx, prompt.RegionParams{
+		Message: "",
+	})
+	if err != nil {
+		return err
+	}
+
+	size := flag.GetInt(ctx, "size")
+	if size == 0 {
+		snapshot, err := client.GetVolumeSnapshot(ctx, snapshotID)
+		if err != nil {
+			return fmt.Errorf("failed retrieving snapshot: %w", err)
+		}
+
+		if size, err = restoreSizeGB(snapshot); err != nil {
+			return err
+		}
+	}
+
+	input := api.CreateVolumeInput{
+		AppID:             appID,
+		Name:              volumeName,
+		Region:            region.Code,
+		SizeGb:            size,
+		Encrypted:         !flag.GetBool(ctx, "no-encryption"),
+		RequireUniqueZone: flag.GetBool(ctx, "require-unique-zone"),
+		SnapshotID:        api.StringPointer(snapshotID),
+	}
+
+	volume, err := client.CreateVolume(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed restoring snapshot: %w", err)
+	}
+
+	if cfg.JSONOutput {
+		return render.JSON(io.Out, volume)
+	}
+
+	fmt.Fprintf(io.Out, "Restored snapshot %s into volume %s (%s) in %s\n", snapshotID, volume.ID, volume.Name, volume.Region)
+
+	return nil
+}
+
+// restoreSizeGB returns the size in gigabytes of a volume the snapshot can be
+// restored into: the size of the snapshotted volume, or of the data in the
+// snapshot rounded up, whichever is larger.
+func restoreSizeGB(snapshot *api.Snapshot) (int, error) {
+	size, err := strconv.ParseUint(snapshot.Size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("snapshot %s has an invalid size %q; pass --size", snapshot.ID, snapshot.Size)
+	}
+
+	gb := int((size + 1<<30 - 1) >> 30)
+	if snapshot.Volume != nil && snapshot.Volume.SizeGb > gb {
+		gb = snapshot.Volume.SizeGb
+	}
+	if gb < 1 {
+		gb = 1
+	}
+
+	return gb, nil
+}
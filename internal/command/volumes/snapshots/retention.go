@@ -0,0 +1,147 @@
+package snapshots
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newRetention() *cobra.Command {
+	const (
+		long = `List the snapshots of the specified volume which are older than the
+retention period given by --days. Pass --delete to delete them.`
+
+		short = "Apply a retention policy to snapshots"
+
+		usage = "retention <volume-id>"
+	)
+
+	cmd := command.New(usage, short, long, runRetention,
+		command.RequireSession,
+	)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.Int{
+			Name:        "days",
+			Default:     7,
+			Description: "Number of days to retain snapshots for",
+		},
+		flag.Bool{
+			Name:        "delete",
+			Description: "Delete the snapshots which are older than the retention period",
+		},
+		flag.Yes(),
+	)
+
+	return cmd
+}
+
+func runRetention(ctx context.Context) error {
+	var (
+		io     = iostreams.FromContext(ctx)
+		cfg    = config.FromContext(ctx)
+		client = client.FromContext(ctx).API()
+		volID  = flag.FirstArg(ctx)
+		days   = flag.GetInt(ctx, "days")
+	)
+
+	if days < 1 {
+		return fmt.Errorf("--days must be at least 1")
+	}
+
+	snapshots, err := client.GetVolumeSnapshots(ctx, volID)
+	if err != nil {
+		return fmt.Errorf("failed retrieving snapshots: %w", err)
+	}
+
+	expired := expiredSnapshots(snapshots, time.Now().AddDate(0, 0, -days))
+
+	del := flag.GetBool(ctx, "delete")
+
+	switch {
+	case cfg.JSONOutput && (!del || len(expired) == 0):
+		return render.JSON(io.Out, expired)
+	case len(expired) == 0:
+		fmt.Fprintf(io.ErrOut, "No snapshots of volume %s are older than %d days\n", volID, days)
+		return nil
+	case !cfg.JSONOutput:
+		rows := make([][]string, 0, len(expired))
+		for _, snapshot := range expired {
+			rows = append(rows, []string{
+				snapshot.ID,
+				snapshot.Size,
+				humanize.Time(snapshot.CreatedAt),
+			})
+		}
+
+		title := fmt.Sprintf("Snapshots older than %d days", days)
+		if err := render.Table(io.Out, title, rows, "ID", "Size", "Created At"); err != nil {
+			return err
+		}
+	}
+
+	if !del {
+		return nil
+	}
+
+	if !flag.GetYes(ctx) {
+		switch confirmed, err := prompt.Confirmf(ctx, "Delete these %d snapshots?", len(expired)); {
+		case err == nil:
+			if !confirmed {
+				return nil
+			}
+		case prompt.IsNonInteractive(err):
+			return prompt.NonInteractiveError("yes flag must be specified when not running interactively")
+		default:
+			return err
+		}
+	}
+
+	ids := make([]string, 0, len(expired))
+	for _, snapshot := range expired {
+		ids = append(ids, snapshot.ID)
+	}
+
+	if err := deleteSnapshots(ctx, ids...); err != nil {
+		return err
+	}
+
+	if cfg.JSONOutput {
+		return render.JSON(io.Out, expired)
+	}
+
+	return nil
+}
+
+// expiredSnapshots returns the snapshots created before cutoff, oldest first.
+func expiredSnapshots(snapshots []api.Snapshot, cutoff time.Time) []api.Snapshot {
+	expired := make([]api.Snapshot, 0, len(snapshots))
+
+	for _, snapshot := range snapshots {
+		if snapshot.CreatedAt.Before(cutoff) {
+			expired = append(expired, snapshot)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].CreatedAt.Before(expired[j].CreatedAt)
+	})
+
+	return expired
+}
@@ -22,6 +22,10 @@ func New() *cobra.Command {
 
 	snapshots.AddCommand(
 		newList(),
+		newCreate(),
+		newRestore(),
+		newDelete(),
+		newRetention(),
 	)
 
 	return snapshots
@@ -0,0 +1,58 @@
+package snapshots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+)
+
+func TestExpiredSnapshots(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	snapshots := []api.Snapshot{
+		{ID: "recent", CreatedAt: now.AddDate(0, 0, -1)},
+		{ID: "old", CreatedAt: now.AddDate(0, 0, -8)},
+		{ID: "older", CreatedAt: now.AddDate(0, 0, -30)},
+		{ID: "cutoff", CreatedAt: now.AddDate(0, 0, -7)},
+	}
+
+	expired := expiredSnapshots(snapshots, now.AddDate(0, 0, -7))
+
+	var ids []string
+	for _, snapshot := range expired {
+		ids = append(ids, snapshot.ID)
+	}
+	assert.Equal(t, []string{"older", "old"}, ids)
+
+	assert.Empty(t, expiredSnapshots(nil, now))
+}
+
+func TestRestoreSizeGB(t *testing.T) {
+	for size, gb := range map[string]int{
+		"0":          1,
+		"1048576":    1,
+		"1073741824": 1,
+		"1073741825": 2,
+		"3221225472": 3,
+	} {
+		got, err := restoreSizeGB(&api.Snapshot{Size: size})
+		require.NoError(t, err, size)
+		assert.Equal(t, gb, got, size)
+	}
+
+	// the new volume is as large as the snapshotted one, not just its data
+	got, err := restoreSizeGB(&api.Snapshot{Size: "1048576", Volume: &api.Volume{SizeGb: 10}})
+	require.NoError(t, err)
+	assert.Equal(t, 10, got)
+
+	got, err = restoreSizeGB(&api.Snapshot{Size: "3221225472", Volume: &api.Volume{SizeGb: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, got)
+
+	_, err = restoreSizeGB(&api.Snapshot{Size: "3GB"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package volumes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/state"
+)
+
+// volumeUsage reports the space used on a volume's filesystem.
+type volumeUsage struct {
+	UsedBytes  uint64
+	AvailBytes uint64
+	TotalBytes uint64
+}
+
+// Percent reports the used space as a percentage of the space available to
+// users, rounded up like df does. Blocks the filesystem reserves for root
+// count towards neither.
+func (u *volumeUsage) Percent() float64 {
+	if u.UsedBytes+u.AvailBytes == 0 {
+		return 0
+	}
+
+	return math.Ceil(float64(u.UsedBytes) / float64(u.UsedBytes+u.AvailBytes) * 100)
+}
+
+// FreeBytes reports the space left on the filesystem for users.
+func (u *volumeUsage) FreeBytes() uint64 {
+	return u.AvailBytes
+}
+
+// fetchUsage runs df on the machine the volume is mounted on. The machine
+// has to be started for this to work.
+func fetchUsage(ctx context.Context, flapsClient *flaps.Client, machineID, volID string) (*volumeUsage, error) {
+	machine, err := flapsClient.Get(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	var path string
+	for _, mnt := range machine.Config.Mounts {
+		if mnt.Volume == volID {
+			path = mnt.Path
+		}
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("volume %s isn't mounted on machine %s", volID, machineID)
+	}
+
+	if machine.State != "started" {
+		return nil, fmt.Errorf("machine %s is %s", machineID, machine.State)
+	}
+
+	out, err := flapsClient.Exec(ctx, machineID, &api.MachineExecRequest{
+		Cmd:     dfCommand(path),
+		Timeout: 10,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.ExitCode != 0 || out.StdOut == nil {
+		return nil, fmt.Errorf("df exited with status %d", out.ExitCode)
+	}
+
+	return parseDF(*out.StdOut)
+}
+
+// dfCommand returns the command reporting the usage of the filesystem the
+// path is on.
+func dfCommand(path string) string {
+	return "df -Pk " + helpers.ShellQuote(path)
+}
+
+// parseDF parses the output of df -Pk for a single filesystem.
+func parseDF(output string) (*volumeUsage, error) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	// skip the header
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("unexpected df output: %q", output)
+	}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		total, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected df output: %w", err)
+		}
+
+		used, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected df output: %w", err)
+		}
+
+		avail, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected df output: %w", err)
+		}
+
+		return &volumeUsage{
+			UsedBytes:  used * 1024,
+			AvailBytes: avail * 1024,
+			TotalBytes: total * 1024,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected df output: %q", output)
+}
+
+// parsePercent parses thresholds such as 80% or 80.
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v <= 0 || v > 100 {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+
+	return v, nil
+}
+
+// usageHistoryFileName denotes the name of the file, relative to the config
+// directory, which records observed volume usage.
+const usageHistoryFileName = "volume_usage.yml"
+
+// maxUsageSamples caps the number of samples recorded per volume.
+const maxUsageSamples = 50
+
+type usageSample struct {
+	At        time.Time `yaml:"at"`
+	UsedBytes uint64    `yaml:"used_bytes"`
+}
+
+func usageHistoryPath(ctx context.Context) string {
+	return filepath.Join(state.ConfigDirectory(ctx), usageHistoryFileName)
+}
+
+func loadUsageHistory(ctx context.Context) (map[string][]usageSample, error) {
+	history := make(map[string][]usageSample)
+
+	data, err := os.ReadFile(usageHistoryPath(ctx))
+	switch {
+	case os.IsNotExist(err):
+		return history, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	if history == nil {
+		history = make(map[string][]usageSample)
+	}
+
+	return history, nil
+}
+
+// recordUsage appends the observed usage of the volumes to their history.
+func recordUsage(ctx context.Context, usage map[string]*volumeUsage) error {
+	history, err := loadUsageHistory(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for volID, u := range usage {
+		samples := append(history[volID], usageSample{At: now, UsedBytes: u.UsedBytes})
+		if len(samples) > maxUsageSamples {
+			samples = samples[len(samples)-maxUsageSamples:]
+		}
+		history[volID] = samples
+	}
+
+	data, err := yaml.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(usageHistoryPath(ctx), data, 0o600)
+}
+
+const (
+	// suggestionHorizon is how far ahead size suggestions account for growth.
+	suggestionHorizon = 90 * 24 * time.Hour
+
+	// suggestionTarget is the share of the suggested size the projected usage
+	// should fill.
+	suggestionTarget = 0.8
+)
+
+// suggestSize suggests a volume size, in gigabytes, which fits the usage
+// projected from samples over the suggestion horizon. It reports false when
+// there aren't enough samples to observe any growth.
+func suggestSize(samples []usageSample, currentGB int) (int, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+
+	elapsed := last.At.Sub(first.At)
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	growth := float64(last.UsedBytes) - float64(first.UsedBytes)
+	if growth < 0 {
+		growth = 0
+	}
+
+	perDay := growth / elapsed.Hours() * 24
+	projected := float64(last.UsedBytes) + perDay*suggestionHorizon.Hours()/24
+
+	gb := int(math.Ceil(projected / suggestionTarget / (1 << 30)))
+	if gb <= currentGB {
+		gb = currentGB + 1
+	}
+
+	return gb, true
+}
@@ -0,0 +1,99 @@
+package volumes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/flyerr"
+)
+
+func TestParseDF(t *testing.T) {
+	const output = `Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/vdb           1031736  257936    721372      27% /data
+`
+
+	usage, err := parseDF(output)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(257936*1024), usage.UsedBytes)
+	assert.Equal(t, uint64(1031736*1024), usage.TotalBytes)
+	assert.Equal(t, uint64(721372*1024), usage.FreeBytes())
+
+	// as df reports it, leaving out the blocks reserved for root
+	assert.Equal(t, 27.0, usage.Percent())
+
+	_, err = parseDF("garbage")
+	assert.Error(t, err)
+}
+
+func TestDFCommand(t *testing.T) {
+	assert.Equal(t, "df -Pk /data", dfCommand("/data"))
+	assert.Equal(t, "df -Pk '/data; rm -rf /'", dfCommand("/data; rm -rf /"))
+}
+
+func TestCheckUsage(t *testing.T) {
+	attached := func(id string) api.Volume {
+		v := api.Volume{ID: id}
+		v.AttachedMachine = &api.GqlMachine{ID: "m-" + id}
+
+		return v
+	}
+
+	volumes := []api.Volume{attached("a"), attached("b"), {ID: "detached"}}
+	usage := map[string]*volumeUsage{
+		"a": {UsedBytes: 10, AvailBytes: 90},
+		"b": {UsedBytes: 90, AvailBytes: 10},
+	}
+
+	assert.NoError(t, checkUsage(volumes, usage, 0))
+	assert.NoError(t, checkUsage(volumes, usage, 95))
+	assert.EqualError(t, checkUsage(volumes, usage, 80), "volumes at or above 80% usage: b")
+
+	// volumes whose usage is unknown aren't reported healthy
+	delete(usage, "a")
+	err := checkUsage(volumes, usage, 95)
+	assert.Equal(t, 2, flyerr.GetErrorExitCode(err))
+	assert.EqualError(t, err, "couldn't determine the usage of volumes: a")
+}
+
+func TestParsePercent(t *testing.T) {
+	v, err := parsePercent("80%")
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, v)
+
+	v, err = parsePercent("75.5")
+	require.NoError(t, err)
+	assert.Equal(t, 75.5, v)
+
+	_, err = parsePercent("120%")
+	assert.Error(t, err)
+}
+
+func TestSuggestSize(t *testing.T) {
+	const gb = 1 << 30
+
+	now := time.Now()
+
+	_, ok := suggestSize([]usageSample{{At: now, UsedBytes: gb}}, 3)
+	assert.False(t, ok)
+
+	// 0.1GB a day for 90 days on top of 2GB, at 80% full
+	size, ok := suggestSize([]usageSample{
+		{At: now.Add(-10 * 24 * time.Hour), UsedBytes: gb},
+		{At: now, UsedBytes: 2 * gb},
+	}, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 14, size)
+
+	// no growth still suggests a larger volume
+	size, ok = suggestSize([]usageSample{
+		{At: now.Add(-time.Hour), UsedBytes: gb},
+		{At: now, UsedBytes: gb},
+	}, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 4, size)
+}
@@ -33,6 +33,7 @@ func New() *cobra.Command {
 		newDestroy(),
 		newExtend(),
 		newShow(),
+		newMove(),
 		snapshots.New(),
 	)
 
@@ -0,0 +1,191 @@
+package dnsforward
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultCacheSize is the default number of responses a Cache holds.
+	DefaultCacheSize = 4096
+
+	// negativeTTL caps how long negative responses are cached for.
+	negativeTTL = 30 * time.Second
+
+	// maxTTL caps how long any response is cached for.
+	maxTTL = time.Hour
+)
+
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+type cacheEntry struct {
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// Cache holds responses for as long as their TTLs allow.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]*cacheEntry
+	now     func() time.Time
+}
+
+// NewCache returns a cache which holds up to size responses.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		entries: make(map[cacheKey]*cacheEntry),
+		now:     time.Now,
+	}
+}
+
+func keyOf(q dns.Question) cacheKey {
+	return cacheKey{
+		name:   dns.CanonicalName(q.Name),
+		qtype:  q.Qtype,
+		qclass: q.Qclass,
+	}
+}
+
+// Get returns the cached response to the request, with its ID and question
+// set to those of the request and its TTLs lowered by the time it's been
+// cached for. It's nil when there's none.
+func (c *Cache) Get(req *dns.Msg) *dns.Msg {
+	if c == nil || len(req.Question) != 1 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := keyOf(req.Question[0])
+
+	e := c.entries[key]
+	if e == nil {
+		return nil
+	}
+
+	now := c.now()
+	if !now.Before(e.expires) {
+		delete(c.entries, key)
+
+		return nil
+	}
+
+	// names are cached case insensitively; echo the question as asked
+	msg := e.msg.Copy()
+	msg.Id = req.Id
+	msg.Question = []dns.Question{req.Question[0]}
+
+	elapsed := uint32(now.Sub(e.stored) / time.Second)
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if hdr := rr.Header(); hdr.Rrtype != dns.TypeOPT {
+				if hdr.Ttl > elapsed {
+					hdr.Ttl -= elapsed
+				} else {
+					hdr.Ttl = 0
+				}
+			}
+		}
+	}
+
+	return msg
+}
+
+// Put caches the response, unless it's neither a success nor a name error or
+// its TTL is zero.
+func (c *Cache) Put(res *dns.Msg) {
+	if c == nil || len(res.Question) != 1 || res.Truncated {
+		return
+	}
+
+	ttl, ok := cacheTTL(res)
+	if !ok || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+
+	now := c.now()
+	c.entries[keyOf(res.Question[0])] = &cacheEntry{
+		msg:     res.Copy(),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
+
+// evict drops the expired entries or, when there are none, the one closest to
+// expiring. The caller must hold c.mu.
+func (c *Cache) evict() {
+	var (
+		now     = c.now()
+		nearest cacheKey
+		found   bool
+	)
+
+	for key, e := range c.entries {
+		switch {
+		case !now.Before(e.expires):
+			delete(c.entries, key)
+		case !found || e.expires.Before(c.entries[nearest].expires):
+			nearest, found = key, true
+		}
+	}
+
+	if len(c.entries) >= c.size && found {
+		delete(c.entries, nearest)
+	}
+}
+
+// cacheTTL returns how long the response may be cached for: the lowest TTL of
+// its answers or, for negative responses, that of the SOA record, capped.
+func cacheTTL(res *dns.Msg) (ttl time.Duration, ok bool) {
+	switch {
+	case res.Rcode == dns.RcodeNameError || (res.Rcode == dns.RcodeSuccess && len(res.Answer) == 0):
+		ttl = negativeTTL
+
+		for _, rr := range res.Ns {
+			if soa, isSOA := rr.(*dns.SOA); isSOA {
+				if soaTTL := time.Duration(lowerTTL(soa.Hdr.Ttl, soa.Minttl)) * time.Second; soaTTL < ttl {
+					ttl = soaTTL
+				}
+			}
+		}
+
+		return ttl, true
+	case res.Rcode == dns.RcodeSuccess:
+		ttl = maxTTL
+
+		for _, rr := range res.Answer {
+			if rrTTL := time.Duration(rr.Header().Ttl) * time.Second; rrTTL < ttl {
+				ttl = rrTTL
+			}
+		}
+
+		return ttl, true
+	default:
+		return 0, false
+	}
+}
+
+func lowerTTL(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
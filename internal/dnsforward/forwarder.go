@@ -0,0 +1,230 @@
+// Package dnsforward implements a DNS server which resolves the private names
+// of an organization through its WireGuard tunnel and other names upstream.
+package dnsforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/terminal"
+)
+
+// PrivateZones are the zones resolved through the tunnel.
+var PrivateZones = []string{"internal.", "flycast."}
+
+// DefaultUpstream is the server other names are resolved with when the system
+// configures none.
+const DefaultUpstream = "1.1.1.1:53"
+
+// queryTimeout bounds the time a query may take.
+const queryTimeout = 5 * time.Second
+
+// Forwarder answers queries for names under the private zones through the
+// organization's nameserver, reached over its tunnel, and others through the
+// upstream server.
+type Forwarder struct {
+	// Dialer dials through the tunnel of the organization.
+	Dialer agent.Dialer
+
+	// Nameserver is the address of the organization's nameserver.
+	Nameserver string
+
+	// Upstream is the address of the server other names are resolved with.
+	Upstream string
+
+	// Cache, when set, caches responses.
+	Cache *Cache
+}
+
+// ServeDNS implements dns.Handler.
+func (f *Forwarder) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	res, err := f.resolve(req)
+	if err != nil {
+		terminal.Debugf("failed resolving %v: %v\n", req.Question, err)
+
+		res = new(dns.Msg)
+		res.SetRcode(req, dns.RcodeServerFailure)
+	}
+
+	// answers fetched over TCP may not fit the datagrams of the client, which
+	// retries over TCP when told they were truncated
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		res.Truncate(udpSize(req))
+	}
+
+	if err := w.WriteMsg(res); err != nil {
+		terminal.Debugf("failed writing response: %v\n", err)
+	}
+}
+
+// udpSize returns the size of the largest datagram the client of the request
+// accepts.
+func udpSize(req *dns.Msg) int {
+	if opt := req.IsEdns0(); opt != nil && int(opt.UDPSize()) > dns.MinMsgSize {
+		return int(opt.UDPSize())
+	}
+
+	return dns.MinMsgSize
+}
+
+var errMalformedQuery = errors.New("queries must carry a single question")
+
+func (f *Forwarder) resolve(req *dns.Msg) (*dns.Msg, error) {
+	if len(req.Question) != 1 {
+		return nil, errMalformedQuery
+	}
+
+	if res := f.Cache.Get(req); res != nil {
+		return res, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var (
+		res *dns.Msg
+		err error
+	)
+
+	if IsPrivate(req.Question[0].Name) {
+		res, err = f.exchangePrivate(ctx, req)
+	} else {
+		res, err = f.exchangeUpstream(ctx, req)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.Cache.Put(res)
+	res.Id = req.Id
+
+	return res, nil
+}
+
+// IsPrivate returns whether the name belongs to one of the private zones.
+func IsPrivate(name string) bool {
+	name = dns.Fqdn(name)
+
+	for _, zone := range PrivateZones {
+		if dns.IsSubDomain(zone, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// streamConn hides the net.PacketConn methods the connections of the agent
+// may have, which would make dns.Conn frame messages as datagrams.
+type streamConn struct {
+	net.Conn
+}
+
+func (f *Forwarder) exchangePrivate(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	c, err := f.Dialer.DialContext(ctx, "tcp", f.Nameserver)
+	if err != nil {
+		return nil, fmt.Errorf("failed dialing nameserver: %w", err)
+	}
+	defer c.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+
+	conn := &dns.Conn{Conn: streamConn{c}}
+
+	// the nameserver is authoritative for the private zones
+	q := req.Copy()
+	q.RecursionDesired = false
+
+	if err = conn.WriteMsg(q); err != nil {
+		return nil, err
+	}
+
+	res, err := conn.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	res.RecursionAvailable = true
+
+	return res, nil
+}
+
+func (f *Forwarder) exchangeUpstream(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	client := &dns.Client{Net: "udp"}
+
+	res, _, err := client.ExchangeContext(ctx, req, f.Upstream)
+	if err == nil && res.Truncated {
+		client.Net = "tcp"
+		res, _, err = client.ExchangeContext(ctx, req, f.Upstream)
+	}
+
+	return res, err
+}
+
+// SystemUpstream returns the first nameserver the system is configured with,
+// other than the one listening on addr, or DefaultUpstream.
+func SystemUpstream(addr string) string {
+	cfg, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return DefaultUpstream
+	}
+
+	for _, server := range cfg.Servers {
+		if upstream := net.JoinHostPort(server, cfg.Port); upstream != addr {
+			return upstream
+		}
+	}
+
+	return DefaultUpstream
+}
+
+// ListenAndServe serves the handler over both UDP and TCP on addr until ctx
+// is done.
+func ListenAndServe(ctx context.Context, addr string, handler dns.Handler) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = pc.Close()
+
+		return err
+	}
+
+	servers := []*dns.Server{
+		{PacketConn: pc, Handler: handler},
+		{Listener: l, Handler: handler},
+	}
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+
+		go func() {
+			errs <- srv.ActivateAndServe()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+		err = fmt.Errorf("failed serving DNS on %s: %w", addr, err)
+	}
+
+	// closing the sockets stops the servers, started or not
+	_ = pc.Close()
+	_ = l.Close()
+
+	return err
+}
@@ -0,0 +1,220 @@
+package dnsforward
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/wg"
+)
+
+// directDialer dials without a tunnel.
+type directDialer struct{}
+
+func (directDialer) State() *wg.WireGuardState { return nil }
+func (directDialer) Config() *wg.Config        { return nil }
+
+func (directDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+
+	return d.DialContext(ctx, network, addr)
+}
+
+// startServer serves a DNS server answering AAAA queries with ip and returns
+// its address along with a count of the queries it answered.
+func startServer(t *testing.T, network string, ip net.IP) (string, *atomic.Int64) {
+	t.Helper()
+
+	var queries atomic.Int64
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		queries.Add(1)
+
+		res := new(dns.Msg)
+		res.SetReply(req)
+		res.Answer = append(res.Answer, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60},
+			AAAA: ip,
+		})
+
+		_ = w.WriteMsg(res)
+	})
+
+	srv := &dns.Server{Handler: handler}
+	if network == "tcp" {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv.Listener = l
+	} else {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv.PacketConn = pc
+	}
+
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	<-started
+
+	if srv.Listener != nil {
+		return srv.Listener.Addr().String(), &queries
+	}
+
+	return srv.PacketConn.LocalAddr().String(), &queries
+}
+
+type recorder struct {
+	dns.ResponseWriter
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (r *recorder) RemoteAddr() net.Addr {
+	return r.remote
+}
+
+func (r *recorder) WriteMsg(m *dns.Msg) error {
+	r.msg = m
+
+	return nil
+}
+
+func query(f *Forwarder, name string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeAAAA)
+
+	rec := recorder{remote: &net.UDPAddr{}}
+	f.ServeDNS(&rec, req)
+
+	return rec.msg
+}
+
+func TestForwarder(t *testing.T) {
+	private := net.ParseIP("fdaa::3")
+	public := net.ParseIP("2606:4700::1111")
+
+	nameserver, privateQueries := startServer(t, "tcp", private)
+	upstream, upstreamQueries := startServer(t, "udp", public)
+
+	f := &Forwarder{
+		Dialer:     directDialer{},
+		Nameserver: nameserver,
+		Upstream:   upstream,
+		Cache:      NewCache(DefaultCacheSize),
+	}
+
+	for _, name := range []string{"app.internal.", "app.flycast.", "top1.nearest.of.app.internal."} {
+		res := query(f, name)
+		require.Len(t, res.Answer, 1, name)
+		assert.Equal(t, private.String(), res.Answer[0].(*dns.AAAA).AAAA.String(), name)
+	}
+
+	res := query(f, "fly.io.")
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, public.String(), res.Answer[0].(*dns.AAAA).AAAA.String())
+
+	// answered from the cache
+	query(f, "app.internal.")
+	query(f, "FLY.io.")
+	assert.Equal(t, int64(3), privateQueries.Load())
+	assert.Equal(t, int64(1), upstreamQueries.Load())
+}
+
+func TestForwarderTruncates(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("app.internal.", dns.TypeAAAA)
+
+	// as many answers as a nameserver answers over TCP, but too many for UDP
+	res := new(dns.Msg)
+	res.SetReply(req)
+	for i := 0; i < 40; i++ {
+		ip := net.ParseIP("fdaa::")
+		ip[15] = byte(i)
+
+		res.Answer = append(res.Answer, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: "app.internal.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60},
+			AAAA: ip,
+		})
+	}
+
+	f := &Forwarder{Cache: NewCache(DefaultCacheSize)}
+	f.Cache.Put(res)
+
+	serve := func(remote net.Addr, req *dns.Msg) *dns.Msg {
+		rec := recorder{remote: remote}
+		f.ServeDNS(&rec, req)
+
+		return rec.msg
+	}
+
+	udp := serve(&net.UDPAddr{}, req)
+	assert.True(t, udp.Truncated)
+	assert.LessOrEqual(t, udp.Len(), dns.MinMsgSize)
+
+	tcp := serve(&net.TCPAddr{}, req)
+	assert.False(t, tcp.Truncated)
+	assert.Len(t, tcp.Answer, 40)
+
+	edns := req.Copy()
+	edns.SetEdns0(4096, false)
+
+	large := serve(&net.UDPAddr{}, edns)
+	assert.False(t, large.Truncated)
+	assert.Len(t, large.Answer, 40)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+
+	c := NewCache(1)
+	c.now = func() time.Time { return now }
+
+	req := new(dns.Msg)
+	req.SetQuestion("app.internal.", dns.TypeAAAA)
+
+	res := new(dns.Msg)
+	res.SetReply(req)
+	res.Answer = append(res.Answer, &dns.AAAA{
+		Hdr:  dns.RR_Header{Name: "app.internal.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 10},
+		AAAA: net.ParseIP("fdaa::3"),
+	})
+	c.Put(res)
+
+	now = now.Add(4 * time.Second)
+	req.Id++
+
+	cached := c.Get(req)
+	require.NotNil(t, cached)
+	assert.Equal(t, req.Id, cached.Id)
+	assert.Equal(t, uint32(6), cached.Answer[0].Header().Ttl)
+
+	now = now.Add(6 * time.Second)
+	assert.Nil(t, c.Get(req))
+
+	// negative responses are cached for no longer than their SOA allows
+	nx := new(dns.Msg)
+	nx.SetRcode(req, dns.RcodeNameError)
+	nx.Ns = append(nx.Ns, &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "internal.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Minttl: 5,
+	})
+	c.Put(nx)
+
+	now = now.Add(4 * time.Second)
+	assert.NotNil(t, c.Get(req))
+
+	now = now.Add(time.Second)
+	assert.Nil(t, c.Get(req))
+
+	// failures aren't cached
+	c.Put(new(dns.Msg).SetRcode(req, dns.RcodeServerFailure))
+	assert.Nil(t, c.Get(req))
+}
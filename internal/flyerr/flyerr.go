@@ -39,6 +39,23 @@ func GetErrorSuggestion(err error) string {
 	return ""
 }
 
+// ErrorExitCode is an error the CLI exits with a specific status for, so that
+// scripts may tell it apart from others.
+type ErrorExitCode interface {
+	error
+	ExitCode() int
+}
+
+// GetErrorExitCode returns the status the CLI should exit with for err, or 0
+// when err doesn't call for a specific one.
+func GetErrorExitCode(err error) int {
+	var ferr ErrorExitCode
+	if errors.As(err, &ferr) {
+		return ferr.ExitCode()
+	}
+	return 0
+}
+
 func PrintCLIOutput(err error) {
 	if err == nil {
 		return
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/flaps"
@@ -57,6 +58,12 @@ func AcquireLeases(ctx context.Context, machines []*api.Machine) ([]*api.Machine
 // AcquireLease works to acquire/attach a lease for the specified machine.
 // WARNING: Make sure you defer the lease release process.
 func AcquireLease(ctx context.Context, machine *api.Machine) (*api.Machine, releaseLeaseFunc, error) {
+	return AcquireLeaseWithTTL(ctx, machine, 120*time.Second)
+}
+
+// AcquireLeaseWithTTL is like AcquireLease, for leases which must last longer
+// than the default.
+func AcquireLeaseWithTTL(ctx context.Context, machine *api.Machine, ttl time.Duration) (*api.Machine, releaseLeaseFunc, error) {
 	var (
 		flapsClient = flaps.FromContext(ctx)
 		io          = iostreams.FromContext(ctx)
@@ -70,7 +77,7 @@ func AcquireLease(ctx context.Context, machine *api.Machine) (*api.Machine, rele
 		}
 	}
 
-	lease, err := flapsClient.AcquireLease(ctx, machine.ID, api.IntPointer(120))
+	lease, err := flapsClient.AcquireLease(ctx, machine.ID, api.IntPointer(int(ttl/time.Second)))
 	if err != nil {
 		return nil, releaseFunc, fmt.Errorf("failed to obtain lease: %w", err)
 	}
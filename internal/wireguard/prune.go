@@ -0,0 +1,85 @@
+package wireguard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/superfly/flyctl/api"
+)
+
+// AgentPeerPrefix prefixes the names of the peers agents create.
+const AgentPeerPrefix = "interactive-agent-"
+
+// IsAgentPeer reports whether an agent, on any machine, created the named
+// peer.
+func IsAgentPeer(name string) bool {
+	return strings.HasPrefix(name, AgentPeerPrefix)
+}
+
+// NameCreatedAt returns when the named peer was created, according to the
+// ULID generated peer names end with.
+func NameCreatedAt(name string) (time.Time, bool) {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return time.Time{}, false
+	}
+
+	id, err := ulid.ParseStrict(name[i+1:])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return ulid.Time(id.Time()), true
+}
+
+// LastActive returns when the peer the gateway status describes was last
+// active: the time of its latest handshake or, when it never shook hands,
+// the time it was added to the gateway.
+func LastActive(status *api.WireGuardPeerStatus, now time.Time) (time.Time, bool) {
+	if status == nil {
+		return time.Time{}, false
+	}
+
+	if t, ok := statusTime(status.LastHandshake, status.SinceHandshake, now); ok {
+		return t, true
+	}
+
+	return statusTime(status.Added, status.SinceAdded, now)
+}
+
+// statusTime parses the timestamp or, failing that, the elapsed time of a
+// gateway status field.
+func statusTime(timestamp, since string, now time.Time) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil && !t.IsZero() && t.Unix() > 0 {
+		return t, true
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), true
+	}
+
+	return time.Time{}, false
+}
+
+// ParseAge parses an age such as 30d or 12h. Besides the units of
+// time.ParseDuration, it accepts whole days.
+func ParseAge(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+
+	return d, nil
+}
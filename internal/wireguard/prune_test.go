@@ -0,0 +1,87 @@
+package wireguard
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+)
+
+func TestParseAge(t *testing.T) {
+	d, err := ParseAge("30d")
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, d)
+
+	d, err = ParseAge("12h")
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, d)
+
+	for _, invalid := range []string{"", "d", "0d", "-1h", "thirty"} {
+		_, err = ParseAge(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNameCreatedAt(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	name := AgentPeerPrefix + "host-user-example-com-" + ulid.MustNew(ulid.Timestamp(created), nil).String()
+
+	got, ok := NameCreatedAt(name)
+	require.True(t, ok)
+	assert.True(t, created.Equal(got))
+
+	_, ok = NameCreatedAt("my-laptop")
+	assert.False(t, ok)
+}
+
+func TestLastActive(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	got, ok := LastActive(&api.WireGuardPeerStatus{LastHandshake: "2022-05-01T00:00:00Z"}, now)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), got)
+
+	// peers which never shook hands are judged by when they were added
+	got, ok = LastActive(&api.WireGuardPeerStatus{SinceHandshake: "never", SinceAdded: "2h0m0s"}, now)
+	require.True(t, ok)
+	assert.Equal(t, now.Add(-2*time.Hour), got)
+
+	_, ok = LastActive(&api.WireGuardPeerStatus{}, now)
+	assert.False(t, ok)
+
+	_, ok = LastActive(nil, now)
+	assert.False(t, ok)
+}
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), registryFile)
+
+	peers, err := loadRegistry(path)
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+
+	add := func(peer RegisteredPeer) {
+		require.NoError(t, updateRegistry(path, func(peers []RegisteredPeer) []RegisteredPeer {
+			return append(removePeer(peers, peer.Org, peer.Name), peer)
+		}))
+	}
+
+	add(RegisteredPeer{Org: "personal", Name: "b", CreatedAt: time.Unix(2, 0)})
+	add(RegisteredPeer{Org: "personal", Name: "a", CreatedAt: time.Unix(1, 0)})
+	add(RegisteredPeer{Org: "other", Name: "a", CreatedAt: time.Unix(3, 0)})
+
+	require.NoError(t, updateRegistry(path, func(peers []RegisteredPeer) []RegisteredPeer {
+		return removePeer(peers, "personal", "b")
+	}))
+
+	peers, err = loadRegistry(path)
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+	assert.Equal(t, "personal", peers[0].Org)
+	assert.Equal(t, "other", peers[1].Org)
+}
@@ -0,0 +1,130 @@
+package wireguard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/internal/filemu"
+	"github.com/superfly/flyctl/terminal"
+	"github.com/superfly/flyctl/wg"
+)
+
+// RegisteredPeer is a peer this machine created.
+type RegisteredPeer struct {
+	Org       string    `json:"org"`
+	Name      string    `json:"name"`
+	Region    string    `json:"region"`
+	PeerIP    string    `json:"peer_ip"`
+	Pubkey    string    `json:"pubkey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// The registry lives in a file of its own, rather than in the config, since
+// both the agent and flyctl record peers in it and each would otherwise
+// overwrite the other's config.
+const registryFile = "wireguard-peers.json"
+
+func registryPath() string {
+	return filepath.Join(flyctl.ConfigDir(), registryFile)
+}
+
+// RegisteredPeers returns the peers this machine created, oldest first.
+func RegisteredPeers() ([]RegisteredPeer, error) {
+	return loadRegistry(registryPath())
+}
+
+// recordPeer adds the peer the state describes to the registry. Failing to
+// do so isn't fatal to creating the peer, so it's merely logged.
+func recordPeer(state *wg.WireGuardState) {
+	peer := RegisteredPeer{
+		Org:       state.Org,
+		Name:      state.Name,
+		Region:    state.Region,
+		PeerIP:    state.Peer.Peerip,
+		Pubkey:    state.LocalPublic,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err := updateRegistry(registryPath(), func(peers []RegisteredPeer) []RegisteredPeer {
+		return append(removePeer(peers, peer.Org, peer.Name), peer)
+	})
+	if err != nil {
+		terminal.Debugf("failed recording WireGuard peer %s: %v\n", peer.Name, err)
+	}
+}
+
+// ForgetPeer removes the named peer of the organization from the registry.
+func ForgetPeer(org, name string) error {
+	return updateRegistry(registryPath(), func(peers []RegisteredPeer) []RegisteredPeer {
+		return removePeer(peers, org, name)
+	})
+}
+
+func removePeer(peers []RegisteredPeer, org, name string) []RegisteredPeer {
+	kept := peers[:0]
+	for _, peer := range peers {
+		if peer.Org != org || peer.Name != name {
+			kept = append(kept, peer)
+		}
+	}
+
+	return kept
+}
+
+func loadRegistry(path string) (peers []RegisteredPeer, err error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &peers); err != nil {
+		return nil, fmt.Errorf("invalid WireGuard peer registry %s: %w", path, err)
+	}
+
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peers[i].CreatedAt.Before(peers[j].CreatedAt)
+	})
+
+	return
+}
+
+// updateRegistry replaces the peers of the registry at path with those fn
+// returns, holding a lock on it meanwhile.
+func updateRegistry(path string, fn func([]RegisteredPeer) []RegisteredPeer) (err error) {
+	unlock, err := filemu.Lock(context.Background(), path+".lock")
+	if err != nil {
+		return fmt.Errorf("failed locking WireGuard peer registry: %w", err)
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	peers, err := loadRegistry(path)
+	if err != nil {
+		return
+	}
+
+	data, err := json.MarshalIndent(fn(peers), "", "  ")
+	if err != nil {
+		return
+	}
+
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return
+	}
+
+	return os.Rename(tmp, path)
+}
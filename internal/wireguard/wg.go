@@ -43,8 +43,11 @@ func StateForOrg(apiClient *api.Client, org *api.Organization, regionCode string
 	if err != nil {
 		return nil, err
 	}
-	if state != nil && !recycle {
+	switch {
+	case state != nil && !recycle:
 		return state, nil
+	case state != nil:
+		return Rotate(apiClient, org, state)
 	}
 
 	terminal.Debugf("Can't find matching WireGuard configuration; creating new one\n")
@@ -56,7 +59,7 @@ func StateForOrg(apiClient *api.Client, org *api.Organization, regionCode string
 			return nil, err
 		}
 
-		name = fmt.Sprintf("interactive-agent-%s", n)
+		name = AgentPeerPrefix + n
 	}
 
 	stateb, err := Create(apiClient, org, regionCode, name)
@@ -112,16 +115,99 @@ func Create(apiClient *api.Client, org *api.Organization, regionCode, name strin
 		return nil, err
 	}
 
-	return &wg.WireGuardState{
+	state := &wg.WireGuardState{
 		Name:         name,
 		Region:       regionCode,
 		Org:          org.Slug,
 		LocalPublic:  pubkey,
 		LocalPrivate: privatekey,
 		Peer:         *data,
+	}
+	recordPeer(state)
+
+	return state, nil
+}
+
+// CreateTemporary creates a peer in the closest region for the caller to
+// remove once done with it. Unlike Create, it neither reports nor records the
+// peer.
+func CreateTemporary(ctx context.Context, apiClient *api.Client, org *api.Organization, prefix string) (*wg.WireGuardState, error) {
+	region, err := apiClient.ClosestWireguardGatewayRegion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s", prefix, ulid.Make())
+	pubkey, privatekey := C25519pair()
+
+	data, err := apiClient.CreateWireGuardPeer(ctx, org, region.Code, name, pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wg.WireGuardState{
+		Name:         name,
+		Region:       region.Code,
+		Org:          org.Slug,
+		LocalPublic:  pubkey,
+		LocalPrivate: privatekey,
+		Peer:         *data,
 	}, nil
 }
 
+// Rotate replaces the keys of the peer the state describes, saving the state
+// of the replacement. Since peers can't be updated, the peer is removed and
+// created anew under the same name and in the same region.
+func Rotate(apiClient *api.Client, org *api.Organization, state *wg.WireGuardState) (*wg.WireGuardState, error) {
+	ctx := context.TODO()
+
+	if err := removePeerIfExists(ctx, apiClient, org, state.Name); err != nil {
+		return nil, err
+	}
+
+	if err := ForgetPeer(org.Slug, state.Name); err != nil {
+		terminal.Debugf("failed forgetting WireGuard peer %s: %v\n", state.Name, err)
+	}
+
+	// the removed peer is of no use anymore, whether or not its replacement
+	// gets created
+	if err := setWireGuardStateForOrg(org.Slug, nil); err != nil {
+		return nil, err
+	}
+
+	rotated, err := Create(apiClient, org, state.Region, state.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed recreating peer %s: %w", state.Name, err)
+	}
+
+	if err := setWireGuardStateForOrg(org.Slug, rotated); err != nil {
+		return nil, err
+	}
+
+	return rotated, nil
+}
+
+// removePeerIfExists removes the named peer, unless it's already gone.
+func removePeerIfExists(ctx context.Context, apiClient *api.Client, org *api.Organization, name string) error {
+	err := apiClient.RemoveWireGuardPeer(ctx, org, name)
+	if err == nil {
+		return nil
+	}
+
+	peers, listErr := apiClient.GetWireGuardPeers(ctx, org.Slug)
+	if listErr != nil {
+		return fmt.Errorf("failed removing peer %s: %w", name, err)
+	}
+
+	for _, peer := range peers {
+		if peer.Name == name {
+			return fmt.Errorf("failed removing peer %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
 func C25519pair() (string, string) {
 	var private [32]byte
 	_, err := rand.Read(private[:])
@@ -174,7 +260,11 @@ func setWireGuardStateForOrg(orgSlug string, s *wg.WireGuardState) error {
 		return err
 	}
 
-	states[orgSlug] = s
+	if s == nil {
+		delete(states, orgSlug)
+	} else {
+		states[orgSlug] = s
+	}
 
 	return setWireGuardState(states)
 }
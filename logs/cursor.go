@@ -0,0 +1,177 @@
+package logs
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// cursorWindow is how far behind the latest entry of an instance a Cursor
+// remembers the entries of that instance it has seen. Entries of the polling
+// and NATS sources arrive slightly out of order, so anything within the
+// window is told apart by its key rather than its timestamp. The window is
+// kept per instance so that instances whose logs lag behind others' aren't
+// dropped.
+const cursorWindow = 30 * time.Second
+
+// cursorTokenMaxAge is how long a Cursor relies on the token it recorded.
+// Tokens only advance while polling, so one recorded before a long stretch of
+// streaming from NATS is far behind, if it's still accepted at all. Polling
+// then starts from the latest logs instead, with the timestamps the cursor
+// kept dropping the entries which were already emitted.
+const cursorTokenMaxAge = 5 * time.Minute
+
+// Cursor tracks the position of a log stream so that entries read more than
+// once, either because polling and NATS overlap or because a stream resumed,
+// are only emitted the first time. It also keeps the API's next token so that
+// polling resumes where it stopped, for as long as the token is recent. The
+// zero value is ready to use and a nil Cursor lets every entry through.
+type Cursor struct {
+	mu      sync.Mutex
+	token   string
+	tokenAt time.Time
+	latest  map[string]time.Time
+	seen    map[string]map[string]time.Time
+}
+
+// Advance records the entry and reports whether it hadn't been seen before.
+// Entries older than the window of their instance are taken to have been
+// seen. Entries with unparsable timestamps can't be placed and are let
+// through.
+func (c *Cursor) Advance(entry LogEntry) bool {
+	if c == nil {
+		return true
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if err != nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	latest, ok := c.latest[entry.Instance]
+	if ok && ts.Before(latest.Add(-cursorWindow)) {
+		return false
+	}
+
+	key := entryKey(entry)
+	if _, ok := c.seen[entry.Instance][key]; ok {
+		return false
+	}
+
+	if c.seen == nil {
+		c.seen = make(map[string]map[string]time.Time)
+	}
+	if c.seen[entry.Instance] == nil {
+		c.seen[entry.Instance] = make(map[string]time.Time)
+	}
+	c.seen[entry.Instance][key] = ts
+
+	if ts.After(latest) {
+		if c.latest == nil {
+			c.latest = make(map[string]time.Time)
+		}
+		c.latest[entry.Instance] = ts
+		c.prune(entry.Instance)
+	}
+
+	return true
+}
+
+// Token returns the next token polling should resume from. It's empty, so
+// that polling starts from the latest logs, when no token was recorded or the
+// one recorded is too old to be relied on.
+func (c *Cursor) Token() string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.tokenAt) > cursorTokenMaxAge {
+		return ""
+	}
+
+	return c.token
+}
+
+// SetToken records the next token polling should resume from.
+func (c *Cursor) SetToken(token string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+	c.tokenAt = time.Now()
+}
+
+// prune forgets the entries of the instance which fell out of its window. The
+// caller must hold c.mu.
+func (c *Cursor) prune(instance string) {
+	horizon := c.latest[instance].Add(-cursorWindow)
+
+	seen := c.seen[instance]
+	for key, ts := range seen {
+		if ts.Before(horizon) {
+			delete(seen, key)
+		}
+	}
+}
+
+// entryKey identifies an entry. Log entries carry no IDs of their own.
+func entryKey(entry LogEntry) string {
+	h := fnv.New64a()
+	h.Write([]byte(entry.Instance))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.Timestamp))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.Message))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type cursorState struct {
+	Token   string                          `json:"token,omitempty"`
+	TokenAt time.Time                       `json:"token_at"`
+	Latest  map[string]time.Time            `json:"latest,omitempty"`
+	Seen    map[string]map[string]time.Time `json:"seen,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler so that cursors may be checkpointed.
+func (c *Cursor) MarshalJSON() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return json.Marshal(cursorState{
+		Token:   c.token,
+		TokenAt: c.tokenAt,
+		Latest:  c.latest,
+		Seen:    c.seen,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Cursor) UnmarshalJSON(data []byte) error {
+	var state cursorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = state.Token
+	c.tokenAt = state.TokenAt
+	c.latest = state.Latest
+	c.seen = state.Seen
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package logs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorAdvance(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	at := func(d time.Duration, msg string) LogEntry {
+		return LogEntry{
+			Instance:  "abc123",
+			Message:   msg,
+			Timestamp: now.Add(d).Format(time.RFC3339Nano),
+		}
+	}
+
+	var c Cursor
+
+	assert.True(t, c.Advance(at(0, "first")))
+	assert.False(t, c.Advance(at(0, "first")), "duplicates are dropped")
+	assert.True(t, c.Advance(at(0, "second")), "distinct entries at the same time pass")
+	assert.True(t, c.Advance(at(time.Minute, "third")))
+	assert.True(t, c.Advance(at(time.Minute-time.Second, "late")), "entries within the window pass")
+	assert.False(t, c.Advance(at(0, "stale")), "entries behind the window are dropped")
+	assert.True(t, c.Advance(LogEntry{Message: "no timestamp"}))
+
+	lagging := at(0, "lagging")
+	lagging.Instance = "def456"
+	assert.True(t, c.Advance(lagging), "windows are kept per instance")
+
+	c.SetToken("next")
+
+	data, err := json.Marshal(&c)
+	require.NoError(t, err)
+
+	var resumed Cursor
+	require.NoError(t, json.Unmarshal(data, &resumed))
+
+	assert.Equal(t, "next", resumed.Token())
+	assert.False(t, resumed.Advance(at(time.Minute, "third")))
+	assert.False(t, resumed.Advance(lagging))
+	assert.True(t, resumed.Advance(at(2*time.Minute, "fourth")))
+
+	// tokens left behind while streaming aren't relied on; the timestamps are
+	resumed.tokenAt = time.Now().Add(-cursorTokenMaxAge - time.Minute)
+	assert.Empty(t, resumed.Token())
+	assert.False(t, resumed.Advance(at(time.Minute, "third")))
+
+	var nilCursor *Cursor
+	assert.True(t, nilCursor.Advance(at(0, "first")))
+	assert.Empty(t, nilCursor.Token())
+}
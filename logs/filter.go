@@ -0,0 +1,108 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter selects the log entries a stream emits. The zero value matches every
+// entry.
+type Filter struct {
+	// Since and Until, when non-zero, bound the timestamps of matching
+	// entries. Entries with unparsable timestamps are not bounded.
+	Since time.Time
+	Until time.Time
+
+	// MinLevel, when set, drops entries less severe than it.
+	MinLevel string
+
+	// Pattern, when set, drops entries whose message it doesn't match.
+	Pattern *regexp.Regexp
+
+	// Instances, when non-nil, drops entries of other instances.
+	Instances map[string]bool
+}
+
+// Match reports whether f matches entry.
+func (f *Filter) Match(entry LogEntry) bool {
+	if f == nil {
+		return true
+	}
+
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		if ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+			if !f.Since.IsZero() && ts.Before(f.Since) {
+				return false
+			}
+			if !f.Until.IsZero() && ts.After(f.Until) {
+				return false
+			}
+		}
+	}
+
+	if f.MinLevel != "" && levelRank(entry.Level) < levelRank(f.MinLevel) {
+		return false
+	}
+
+	if f.Pattern != nil && !f.Pattern.MatchString(entry.Message) {
+		return false
+	}
+
+	if f.Instances != nil && !f.Instances[entry.Instance] {
+		return false
+	}
+
+	return true
+}
+
+var levelRanks = map[string]int{
+	"trace":    0,
+	"debug":    1,
+	"info":     2,
+	"notice":   3,
+	"warn":     4,
+	"warning":  4,
+	"error":    5,
+	"err":      5,
+	"crit":     6,
+	"critical": 6,
+	"fatal":    6,
+	"panic":    6,
+}
+
+// levelRank orders levels by severity. Unknown levels rank as info.
+func levelRank(level string) int {
+	if rank, ok := levelRanks[strings.ToLower(level)]; ok {
+		return rank
+	}
+
+	return levelRanks["info"]
+}
+
+// ValidLevel reports whether level is a level Filter knows how to rank.
+func ValidLevel(level string) bool {
+	_, ok := levelRanks[strings.ToLower(level)]
+
+	return ok
+}
+
+// ParseTime parses s as either an RFC 3339 timestamp or a duration relative
+// to now, such as 2h or 30m, which is taken to be in the past.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a timestamp nor a duration", s)
+	}
+
+	if d < 0 {
+		d = -d
+	}
+
+	return now.Add(-d), nil
+}
@@ -0,0 +1,58 @@
+package logs
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	entry := LogEntry{
+		Level:     "warn",
+		Instance:  "abc123",
+		Message:   "request failed: timeout",
+		Timestamp: now.Format(time.RFC3339Nano),
+	}
+
+	cases := map[string]struct {
+		filter *Filter
+		match  bool
+	}{
+		"Nil":          {nil, true},
+		"Zero":         {&Filter{}, true},
+		"SinceBefore":  {&Filter{Since: now.Add(-time.Hour)}, true},
+		"SinceAfter":   {&Filter{Since: now.Add(time.Hour)}, false},
+		"UntilAfter":   {&Filter{Until: now.Add(time.Hour)}, true},
+		"UntilBefore":  {&Filter{Until: now.Add(-time.Hour)}, false},
+		"LevelLower":   {&Filter{MinLevel: "info"}, true},
+		"LevelHigher":  {&Filter{MinLevel: "error"}, false},
+		"PatternMatch": {&Filter{Pattern: regexp.MustCompile("time(out)?")}, true},
+		"PatternMiss":  {&Filter{Pattern: regexp.MustCompile("^ok")}, false},
+		"Instance":     {&Filter{Instances: map[string]bool{"abc123": true}}, true},
+		"OtherInst":    {&Filter{Instances: map[string]bool{"def456": true}}, false},
+	}
+
+	for name, kase := range cases {
+		assert.Equal(t, kase.match, kase.filter.Match(entry), name)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	ts, err := ParseTime("2h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-2*time.Hour), ts)
+
+	ts, err = ParseTime("2022-09-30T08:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 9, 30, 8, 0, 0, 0, time.UTC), ts)
+
+	_, err = ParseTime("yesterday", now)
+	assert.Error(t, err)
+}
@@ -14,6 +14,17 @@ type LogOptions struct {
 	AppName    string
 	VMID       string
 	RegionCode string
+
+	// Filter, when set, selects the entries streams emit.
+	Filter *Filter
+
+	// Cursor, when set, drops entries which were already emitted. Share it
+	// between the streams of an app so that they don't overlap.
+	Cursor *Cursor
+
+	// NoTail makes polling stop once the buffered entries have been read,
+	// instead of waiting for new ones.
+	NoTail bool
 }
 
 func (opts *LogOptions) toNatsSubject() (subject string) {
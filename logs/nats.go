@@ -46,14 +46,27 @@ func NewNatsStream(ctx context.Context, apiClient *api.Client, opts *LogOptions)
 	return &natsLogStream{nc: nc}, nil
 }
 
-// natsLogStream implements LogStream
+// natsLogStream implements LogStream. Its connection is closed once the stream
+// ends, so it may only be streamed once. The subscription is established by
+// the time Stream returns, buffering entries until they're read.
 func (s *natsLogStream) Stream(ctx context.Context, opts *LogOptions) <-chan LogEntry {
 	out := make(chan LogEntry)
 
+	sub, err := subscribe(s.nc, opts)
+	if err != nil {
+		s.err = err
+		s.nc.Close()
+		close(out)
+
+		return out
+	}
+
 	go func() {
 		defer close(out)
+		defer s.nc.Close()
+		defer sub.Unsubscribe()
 
-		s.err = fromNats(ctx, out, s.nc, opts)
+		s.err = fromNats(ctx, out, sub, opts)
 	}()
 
 	return out
@@ -75,7 +88,13 @@ func newNatsClient(ctx context.Context, dialer agent.Dialer, orgSlug string) (*n
 	natsIP := net.IP(natsIPBytes[:])
 
 	url := fmt.Sprintf("nats://[%s]:4223", natsIP.String())
-	conn, err := nats.Connect(url, nats.SetCustomDialer(&natsDialer{dialer, ctx}), nats.UserInfo(orgSlug, flyctl.GetAPIToken()))
+	// Reconnects are left to resumingStream, which catches up on the entries
+	// logged while disconnected; NATS itself would silently drop those.
+	conn, err := nats.Connect(url,
+		nats.SetCustomDialer(&natsDialer{dialer, ctx}),
+		nats.UserInfo(orgSlug, flyctl.GetAPIToken()),
+		nats.NoReconnect(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed connecting to nats: %w", err)
 	}
@@ -92,13 +111,24 @@ func (d *natsDialer) Dial(network, address string) (net.Conn, error) {
 	return d.Dialer.DialContext(d.ctx, network, address)
 }
 
-func fromNats(ctx context.Context, out chan<- LogEntry, nc *nats.Conn, opts *LogOptions) (err error) {
-	var sub *nats.Subscription
-	if sub, err = nc.SubscribeSync(opts.toNatsSubject()); err != nil {
-		return
+// subscribe subscribes to the app's logs and waits for the server to have
+// processed the subscription, so that nothing logged afterwards is missed.
+func subscribe(nc *nats.Conn, opts *LogOptions) (*nats.Subscription, error) {
+	sub, err := nc.SubscribeSync(opts.toNatsSubject())
+	if err != nil {
+		return nil, fmt.Errorf("failed subscribing to logs: %w", err)
+	}
+
+	if err := nc.Flush(); err != nil {
+		sub.Unsubscribe()
+
+		return nil, fmt.Errorf("failed subscribing to logs: %w", err)
 	}
-	defer sub.Unsubscribe()
 
+	return sub, nil
+}
+
+func fromNats(ctx context.Context, out chan<- LogEntry, sub *nats.Subscription, opts *LogOptions) (err error) {
 	var log natsLog
 	for {
 		var msg *nats.Msg
@@ -112,7 +142,8 @@ func fromNats(ctx context.Context, out chan<- LogEntry, nc *nats.Conn, opts *Log
 			break
 		}
 
-		out <- LogEntry{
+		entry := LogEntry{
+			AppName:   log.Fly.App.Name,
 			Instance:  log.Fly.App.Instance,
 			Level:     log.Log.Level,
 			Message:   log.Message,
@@ -124,6 +155,10 @@ func fromNats(ctx context.Context, out chan<- LogEntry, nc *nats.Conn, opts *Log
 				Event:    struct{ Provider string }{log.Event.Provider},
 			},
 		}
+
+		if opts.Filter.Match(entry) {
+			out <- entry
+		}
 	}
 
 	return
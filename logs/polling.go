@@ -35,6 +35,9 @@ func (s *pollingStream) Err() error {
 	return s.err
 }
 
+// Poll emits the entries of the app's logs, starting from the token recorded
+// in opts.Cursor, if any is recent enough, and recording the tokens it's given
+// there as it goes.
 func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *LogOptions) error {
 	const (
 		minWait = time.Millisecond << 6
@@ -43,7 +46,7 @@ func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *Lo
 
 	var (
 		errorCount int
-		nextToken  string
+		nextToken  = opts.Cursor.Token()
 		waitFor    = minWait
 	)
 
@@ -70,6 +73,10 @@ func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *Lo
 
 		errorCount = 0
 		if len(entries) == 0 {
+			if opts.NoTail {
+				return nil
+			}
+
 			waitFor = backoff(minWait, maxWait)
 
 			continue
@@ -77,12 +84,9 @@ func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *Lo
 
 		waitFor = 0
 
-		if token != "" {
-			nextToken = token
-		}
-
 		for _, entry := range entries {
-			out <- LogEntry{
+			entry := LogEntry{
+				AppName:   opts.AppName,
 				Instance:  entry.Instance,
 				Level:     entry.Level,
 				Message:   entry.Message,
@@ -90,6 +94,17 @@ func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *Lo
 				Timestamp: entry.Timestamp,
 				Meta:      entry.Meta,
 			}
+
+			if opts.Filter.Match(entry) && opts.Cursor.Advance(entry) {
+				out <- entry
+			}
+		}
+
+		// The token is only recorded once its page was emitted so that a
+		// checkpoint never skips past entries which weren't.
+		if token != "" {
+			nextToken = token
+			opts.Cursor.SetToken(token)
 		}
 	}
 }
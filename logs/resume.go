@@ -0,0 +1,114 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/azazeal/pause"
+	jpbackoff "github.com/jpillora/backoff"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/logger"
+)
+
+type resumingStream struct {
+	err       error
+	apiClient *api.Client
+	stream    LogStream
+}
+
+// NewResumingStream wraps the NATS stream so that, when its connection drops,
+// a new one is established with backoff. The entries logged while the stream
+// was disconnected are then polled for from the token opts.Cursor recorded,
+// or from the latest logs when that token is too old, with opts.Cursor also
+// dropping those which were already emitted.
+func NewResumingStream(client *api.Client, stream LogStream) LogStream {
+	return &resumingStream{
+		apiClient: client,
+		stream:    stream,
+	}
+}
+
+func (s *resumingStream) Stream(ctx context.Context, opts *LogOptions) <-chan LogEntry {
+	out := make(chan LogEntry)
+
+	go func() {
+		defer close(out)
+
+		s.err = s.follow(ctx, out, opts)
+	}()
+
+	return out
+}
+
+func (s *resumingStream) Err() error {
+	return s.err
+}
+
+func (s *resumingStream) follow(ctx context.Context, out chan<- LogEntry, opts *LogOptions) error {
+	b := &jpbackoff.Backoff{
+		Min:    time.Second,
+		Max:    time.Minute,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	stream := s.stream
+	live := stream.Stream(ctx, opts)
+
+	for {
+		for entry := range live {
+			if !opts.Cursor.Advance(entry) {
+				continue
+			}
+
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if l := logger.MaybeFromContext(ctx); l != nil {
+			l.Warnf("lost connection to the log stream of %s (%v), reconnecting...", opts.AppName, stream.Err())
+		}
+
+		for {
+			pause.For(ctx, b.Duration())
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var err error
+			if stream, err = NewNatsStream(ctx, s.apiClient, opts); err == nil {
+				break
+			}
+
+			if l := logger.MaybeFromContext(ctx); l != nil {
+				l.Debugf("failed reconnecting to the log stream of %s: %v", opts.AppName, err)
+			}
+		}
+
+		b.Reset()
+
+		// Subscribe before catching up so that nothing logged in between is
+		// missed. Stream returns once subscribed and the subscription buffers
+		// entries until they're read, while polling resumes from the token
+		// opts.Cursor recorded or, if that's stale, from the latest logs.
+		live = stream.Stream(ctx, opts)
+
+		backfill := *opts
+		backfill.NoTail = true
+
+		if err := Poll(ctx, out, s.apiClient, &backfill); err != nil && !errors.Is(err, context.Canceled) {
+			if l := logger.MaybeFromContext(ctx); l != nil {
+				l.Debugf("failed polling for missed logs of %s: %v", opts.AppName, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	jpbackoff "github.com/jpillora/backoff"
+
+	"github.com/superfly/flyctl/retry"
+)
+
+// Sink receives batches of log entries shipped off a LogStream.
+type Sink interface {
+	// Write delivers the batch and returns the number of entries, from its
+	// start, which were delivered. Writes which fail are retried with the
+	// entries which weren't, so implementations which can't tell must
+	// deliver all or none of them.
+	Write(ctx context.Context, entries []LogEntry) (int, error)
+
+	Close() error
+}
+
+// NewSink returns the sink the URL describes. Supported schemes are:
+//
+//	file:///var/log/app.log?max_size=10485760&max_files=5
+//	syslog+tcp://host:514 and syslog+udp://host:514 (or syslog://)
+//	http://host/path and https://host/path, receiving NDJSON batches
+//	loki+http://host:3100 and loki+https://host:3100
+//
+// A URL without a scheme is taken to be the path of a file. appName labels
+// entries which don't carry the name of their app.
+func NewSink(rawURL, appName string) (Sink, error) {
+	if !strings.Contains(rawURL, "://") {
+		return newFileSink(rawURL, defaultMaxFileSize, defaultMaxFiles)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return parseFileSink(u)
+	case "syslog", "syslog+udp":
+		return newSyslogSink("udp", u.Host, appName)
+	case "syslog+tcp":
+		return newSyslogSink("tcp", u.Host, appName)
+	case "http", "https":
+		return newHTTPSink(u.String()), nil
+	case "loki+http", "loki+https":
+		u.Scheme = strings.TrimPrefix(u.Scheme, "loki+")
+		if u.Path == "" || u.Path == "/" {
+			u.Path = lokiPushPath
+		}
+
+		return newLokiSink(u.String(), appName), nil
+	default:
+		return nil, fmt.Errorf("unsupported sink scheme %q", u.Scheme)
+	}
+}
+
+// ShipOptions tunes how entries are batched and delivered to a Sink.
+type ShipOptions struct {
+	// BatchSize caps the number of entries written at once.
+	BatchSize int
+
+	// FlushInterval caps how long entries wait for their batch to fill up.
+	FlushInterval time.Duration
+
+	// Attempts caps the number of times a batch is written.
+	Attempts uint
+
+	// Buffer caps the number of entries read off the stream which haven't
+	// been written yet. Once it's full the stream isn't read from, so the
+	// source slows down rather than entries piling up in memory.
+	Buffer int
+}
+
+// DefaultShipOptions are the options Ship uses for unset fields.
+var DefaultShipOptions = ShipOptions{
+	BatchSize:     500,
+	FlushInterval: 2 * time.Second,
+	Attempts:      5,
+	Buffer:        5000,
+}
+
+func (o ShipOptions) withDefaults() ShipOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultShipOptions.BatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = DefaultShipOptions.FlushInterval
+	}
+	if o.Attempts == 0 {
+		o.Attempts = DefaultShipOptions.Attempts
+	}
+	if o.Buffer < o.BatchSize {
+		o.Buffer = o.BatchSize
+	}
+
+	return o
+}
+
+// Ship reads the stream and writes its entries to sink in batches until the
+// stream ends or ctx is done. It returns the first batch which couldn't be
+// written after retrying as an error.
+func Ship(ctx context.Context, stream LogStream, opts *LogOptions, sink Sink, shipOpts ShipOptions) error {
+	shipOpts = shipOpts.withDefaults()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	buffered := make(chan LogEntry, shipOpts.Buffer)
+	go func() {
+		defer close(buffered)
+
+		for entry := range stream.Stream(ctx, opts) {
+			select {
+			case buffered <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(shipOpts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]LogEntry, 0, shipOpts.BatchSize)
+
+	flush := func(ctx context.Context) error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		b := &jpbackoff.Backoff{
+			Min:    500 * time.Millisecond,
+			Max:    10 * time.Second,
+			Factor: 2,
+			Jitter: true,
+		}
+
+		// only the entries the sink didn't write are retried
+		pending := batch
+		err := retry.RetryProgress(ctx, func(ctx context.Context) (bool, error) {
+			n, err := sink.Write(ctx, pending)
+			pending = pending[n:]
+
+			return n > 0, err
+		}, shipOpts.Attempts, b)
+		if err != nil {
+			return fmt.Errorf("failed shipping %d log entries: %w", len(pending), err)
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for {
+		select {
+		case entry, ok := <-buffered:
+			if !ok {
+				// Deliver what's left even though ctx may be done already.
+				flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+
+				if err := flush(flushCtx); err != nil {
+					return err
+				}
+
+				if err := stream.Err(); err != nil && !errors.Is(err, context.Canceled) {
+					return err
+				}
+
+				return ctx.Err()
+			}
+
+			if batch = append(batch, entry); len(batch) >= shipOpts.BatchSize {
+				if err := flush(ctx); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultMaxFileSize = 10 << 20
+	defaultMaxFiles    = 5
+)
+
+// fileSink writes entries as JSON lines to a file, rotating it once it grows
+// past maxSize. Rotated files are suffixed .1 (the newest) through .maxFiles.
+type fileSink struct {
+	mu       sync.Mutex // protects below
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func parseFileSink(u *url.URL) (Sink, error) {
+	maxSize := int64(defaultMaxFileSize)
+	if v := u.Query().Get("max_size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid max_size %q", v)
+		}
+		maxSize = n
+	}
+
+	maxFiles := defaultMaxFiles
+	if v := u.Query().Get("max_files"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid max_files %q", v)
+		}
+		maxFiles = n
+	}
+
+	return newFileSink(u.Path, maxSize, maxFiles)
+}
+
+func newFileSink(path string, maxSize int64, maxFiles int) (*fileSink, error) {
+	s := &fileSink{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileSink) open() (err error) {
+	if s.f, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600); err != nil {
+		return
+	}
+
+	var fi os.FileInfo
+	if fi, err = s.f.Stat(); err != nil {
+		_ = s.f.Close()
+
+		return
+	}
+	s.size = fi.Size()
+
+	return
+}
+
+// Write appends the entries one line at a time and returns the number of
+// them which were written, so that a retry doesn't write them again. A line
+// which was only partly written is truncated away.
+func (s *fileSink) Write(_ context.Context, entries []LogEntry) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return i, err
+		}
+		line = append(line, '\n')
+
+		if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+			if err := s.rotate(); err != nil {
+				return i, fmt.Errorf("failed rotating %s: %w", s.path, err)
+			}
+		}
+
+		if n, err := s.f.Write(line); err != nil {
+			if n > 0 {
+				_ = s.f.Truncate(s.size)
+			}
+
+			return i, err
+		}
+		s.size += int64(len(line))
+	}
+
+	return len(entries), nil
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	if s.maxFiles == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return s.open()
+	}
+
+	for i := s.maxFiles - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", s.path, i)
+		to := fmt.Sprintf("%s.%d", s.path, i+1)
+
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
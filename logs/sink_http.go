@@ -0,0 +1,155 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// httpSink POSTs batches of entries as newline delimited JSON.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSink(url string) *httpSink {
+	return &httpSink{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *httpSink) Write(ctx context.Context, entries []LogEntry) (int, error) {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := post(ctx, s.client, s.url, "application/x-ndjson", &buf); err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// lokiSink pushes entries to a Loki compatible endpoint, labelled by app,
+// region and level.
+type lokiSink struct {
+	url     string
+	appName string
+	client  *http.Client
+}
+
+func newLokiSink(url, appName string) *lokiSink {
+	return &lokiSink{
+		url:     url,
+		appName: appName,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+func (s *lokiSink) Write(ctx context.Context, entries []LogEntry) (int, error) {
+	b, err := json.Marshal(s.push(entries))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := post(ctx, s.client, s.url, "application/json", bytes.NewReader(b)); err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+func (s *lokiSink) push(entries []LogEntry) lokiPush {
+	var (
+		push    lokiPush
+		streams = make(map[string]*lokiStream)
+	)
+
+	for _, entry := range entries {
+		appName := entry.AppName
+		if appName == "" {
+			appName = s.appName
+		}
+
+		labels := map[string]string{
+			"app":    appName,
+			"region": entry.Region,
+			"level":  entry.Level,
+		}
+
+		key := appName + "\x00" + entry.Region + "\x00" + entry.Level
+
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			push.Streams = append(push.Streams, stream)
+		}
+
+		ts := time.Now()
+		if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+			ts = t
+		}
+
+		line := entry.Message
+		if entry.Instance != "" {
+			line = fmt.Sprintf("instance=%s %s", entry.Instance, entry.Message)
+		}
+
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), line})
+	}
+
+	return push
+}
+
+func (s *lokiSink) Close() error {
+	return nil
+}
+
+func post(ctx context.Context, client *http.Client, url, contentType string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return fmt.Errorf("%s responded with %s: %s", url, res.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacility is the facility messages are sent with (user-level).
+const syslogFacility = 1
+
+// syslogSink sends entries as RFC 5424 messages. Messages sent over TCP are
+// framed by octet counting, per RFC 6587.
+type syslogSink struct {
+	mu      sync.Mutex // protects conn
+	network string
+	addr    string
+	appName string
+	conn    net.Conn
+}
+
+func newSyslogSink(network, addr, appName string) (*syslogSink, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("syslog sink requires a host and port")
+	}
+
+	return &syslogSink{
+		network: network,
+		addr:    addr,
+		appName: appName,
+	}, nil
+}
+
+// Write sends the entries one message at a time and returns the number of
+// them which were sent, so that a retry doesn't send them again.
+func (s *syslogSink) Write(ctx context.Context, entries []LogEntry) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		var d net.Dialer
+		if s.conn, err = d.DialContext(ctx, s.network, s.addr); err != nil {
+			return
+		}
+	}
+
+	for _, entry := range entries {
+		msg := formatSyslog(entry, s.appName)
+		if s.network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+
+		if _, err = s.conn.Write([]byte(msg)); err != nil {
+			// reconnect on the next attempt
+			_ = s.conn.Close()
+			s.conn = nil
+
+			return
+		}
+
+		n++
+	}
+
+	return
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+// formatSyslog formats the entry as an RFC 5424 message, with the instance as
+// the hostname and the region as the message ID. The entry's app name takes
+// precedence over the given one.
+func formatSyslog(entry LogEntry, appName string) string {
+	if entry.AppName != "" {
+		appName = entry.AppName
+	}
+
+	ts := entry.Timestamp
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		ts = t.UTC().Format(time.RFC3339Nano)
+	} else {
+		ts = "-"
+	}
+
+	pri := syslogFacility*8 + syslogSeverity(entry.Level)
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s - %s\n",
+		pri,
+		ts,
+		syslogField(entry.Instance),
+		syslogField(appName),
+		syslogField(entry.Region),
+		strings.TrimRight(entry.Message, "\n"),
+	)
+}
+
+func syslogSeverity(level string) int {
+	switch levelRank(level) {
+	case levelRanks["trace"], levelRanks["debug"]:
+		return 7
+	case levelRanks["notice"]:
+		return 5
+	case levelRanks["warn"]:
+		return 4
+	case levelRanks["error"]:
+		return 3
+	case levelRanks["fatal"]:
+		return 2
+	default:
+		return 6
+	}
+}
+
+// syslogField returns s as an RFC 5424 header field, which may not be empty
+// nor contain spaces.
+func syslogField(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return strings.ReplaceAll(s, " ", "_")
+}
@@ -0,0 +1,148 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceStream []LogEntry
+
+func (s sliceStream) Err() error { return nil }
+
+func (s sliceStream) Stream(ctx context.Context, opts *LogOptions) <-chan LogEntry {
+	out := make(chan LogEntry)
+
+	go func() {
+		defer close(out)
+
+		for _, entry := range s {
+			out <- entry
+		}
+	}()
+
+	return out
+}
+
+type recordingSink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]LogEntry
+}
+
+// Write fails while failures are left, after delivering the first entry.
+func (s *recordingSink) Write(_ context.Context, entries []LogEntry) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		s.batches = append(s.batches, append([]LogEntry(nil), entries[:1]...))
+
+		return 1, errors.New("unavailable")
+	}
+
+	s.batches = append(s.batches, append([]LogEntry(nil), entries...))
+
+	return len(entries), nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestShip(t *testing.T) {
+	stream := make(sliceStream, 5)
+	for i := range stream {
+		stream[i] = LogEntry{Message: string(rune('a' + i))}
+	}
+
+	sink := &recordingSink{failures: 1}
+
+	err := Ship(context.Background(), stream, &LogOptions{}, sink, ShipOptions{BatchSize: 2, Attempts: 2})
+	require.NoError(t, err)
+
+	// the entry delivered before the failure isn't shipped again
+	var sizes []int
+	var messages string
+	for _, batch := range sink.batches {
+		sizes = append(sizes, len(batch))
+		for _, entry := range batch {
+			messages += entry.Message
+		}
+	}
+	assert.Equal(t, []int{1, 1, 2, 1}, sizes)
+	assert.Equal(t, "abcde", messages)
+
+	sink = &recordingSink{failures: 5}
+	err = Ship(context.Background(), stream, &LogOptions{}, sink, ShipOptions{BatchSize: 2, Attempts: 1})
+	assert.Error(t, err)
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	sink, err := newFileSink(path, 600, 2)
+	require.NoError(t, err)
+
+	entry := LogEntry{Message: "0123456789"}
+	for i := 0; i < 10; i++ {
+		n, err := sink.Write(context.Background(), []LogEntry{entry})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+	require.NoError(t, sink.Close())
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, fi.Size(), int64(600))
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFormatSyslog(t *testing.T) {
+	entry := LogEntry{
+		Level:     "error",
+		Instance:  "abc123",
+		Region:    "ord",
+		Message:   "boom\n",
+		Timestamp: "2022-10-01T12:00:00.5Z",
+	}
+
+	assert.Equal(t,
+		"<11>1 2022-10-01T12:00:00.5Z abc123 my-app - ord - boom\n",
+		formatSyslog(entry, "my-app"))
+}
+
+func TestLokiPush(t *testing.T) {
+	sink := newLokiSink("http://loki", "my-app")
+
+	push := sink.push([]LogEntry{
+		{Region: "ord", Level: "info", Message: "a", Timestamp: "2022-10-01T12:00:00Z"},
+		{Region: "ord", Level: "info", Message: "b", Timestamp: "2022-10-01T12:00:01Z"},
+		{Region: "ams", Level: "info", Message: "c", Timestamp: "2022-10-01T12:00:02Z"},
+	})
+
+	require.Len(t, push.Streams, 2)
+	assert.Equal(t, map[string]string{"app": "my-app", "region": "ord", "level": "info"}, push.Streams[0].Stream)
+	assert.Len(t, push.Streams[0].Values, 2)
+	assert.Equal(t, "1664625600000000000", push.Streams[0].Values[0][0])
+}
+
+func TestNewSink(t *testing.T) {
+	for _, u := range []string{"syslog+tcp://localhost:514", "https://example.com/logs", "loki+http://localhost:3100"} {
+		sink, err := NewSink(u, "my-app")
+		require.NoError(t, err, u)
+		require.NoError(t, sink.Close())
+	}
+
+	_, err := NewSink("ftp://example.com", "my-app")
+	assert.Error(t, err)
+}
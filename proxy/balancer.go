@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Strategies a Balancer may spread connections with.
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceLeastConn  = "least-conn"
+)
+
+// DefaultCooldown is how long a backend which failed to connect is left out.
+const DefaultCooldown = 30 * time.Second
+
+// maxStickyKeys caps the number of sticky sessions a Balancer remembers.
+const maxStickyKeys = 10000
+
+type backend struct {
+	addr      string
+	active    int
+	downUntil time.Time
+}
+
+// Balancer spreads the connections a Server proxies across backends, leaving
+// those which fail to connect out for a cooldown.
+type Balancer struct {
+	// Cooldown is how long backends marked down are left out.
+	Cooldown time.Duration
+
+	// Sticky makes connections of the same key go to the same backend, for
+	// as long as it's up.
+	Sticky bool
+
+	mu       sync.Mutex
+	strategy string
+	backends []*backend
+	next     int
+	sessions map[string]*backend
+	now      func() time.Time
+}
+
+// NewBalancer returns a balancer which spreads connections across the
+// addresses with the given strategy.
+func NewBalancer(strategy string, addrs []string) (*Balancer, error) {
+	switch strategy {
+	case BalanceRoundRobin, BalanceLeastConn:
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy %q; expected %s or %s", strategy, BalanceRoundRobin, BalanceLeastConn)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no instances to balance across")
+	}
+
+	b := &Balancer{
+		Cooldown: DefaultCooldown,
+		strategy: strategy,
+		sessions: make(map[string]*backend),
+		now:      time.Now,
+	}
+
+	for _, addr := range addrs {
+		b.backends = append(b.backends, &backend{addr: addr})
+	}
+
+	return b, nil
+}
+
+// Len returns the number of backends.
+func (b *Balancer) Len() int {
+	return len(b.backends)
+}
+
+// Pick returns the address the connection of the given key should go to.
+// Backends which are down are skipped, unless all of them are. Call Done
+// with the address once the connection is over.
+func (b *Balancer) Pick(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	if b.Sticky {
+		if be := b.sessions[key]; be != nil && !be.downUntil.After(now) {
+			be.active++
+
+			return be.addr
+		}
+	}
+
+	up := make([]*backend, 0, len(b.backends))
+	for _, be := range b.backends {
+		if !be.downUntil.After(now) {
+			up = append(up, be)
+		}
+	}
+
+	if len(up) == 0 {
+		up = b.backends
+	}
+
+	var picked *backend
+	switch b.strategy {
+	case BalanceLeastConn:
+		for _, be := range up {
+			if picked == nil || be.active < picked.active {
+				picked = be
+			}
+		}
+	default:
+		picked = up[b.next%len(up)]
+		b.next++
+	}
+
+	picked.active++
+
+	if b.Sticky {
+		if len(b.sessions) >= maxStickyKeys {
+			b.sessions = make(map[string]*backend)
+		}
+		b.sessions[key] = picked
+	}
+
+	return picked.addr
+}
+
+// Done records the end of a connection Pick handed out the address for.
+func (b *Balancer) Done(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if be := b.find(addr); be != nil && be.active > 0 {
+		be.active--
+	}
+}
+
+// MarkDown leaves the backend out for the cooldown.
+func (b *Balancer) MarkDown(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if be := b.find(addr); be != nil {
+		be.downUntil = b.now().Add(b.Cooldown)
+	}
+}
+
+// find returns the backend of the address. The caller must hold b.mu.
+func (b *Balancer) find(addr string) *backend {
+	for _, be := range b.backends {
+		if be.addr == addr {
+			return be
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalancer(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	b, err := NewBalancer(BalanceRoundRobin, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	b.now = func() time.Time { return now }
+
+	assert.Equal(t, []string{"a", "b", "c", "a"}, []string{b.Pick(""), b.Pick(""), b.Pick(""), b.Pick("")})
+
+	b.MarkDown("b")
+	for i := 0; i < 4; i++ {
+		assert.NotEqual(t, "b", b.Pick(""))
+	}
+
+	now = now.Add(DefaultCooldown)
+	picked := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		picked[b.Pick("")] = true
+	}
+	assert.True(t, picked["b"], "backends come back after the cooldown")
+
+	_, err = NewBalancer("random", []string{"a"})
+	assert.Error(t, err)
+}
+
+func TestBalancerLeastConn(t *testing.T) {
+	b, err := NewBalancer(BalanceLeastConn, []string{"a", "b"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "a", b.Pick(""))
+	assert.Equal(t, "b", b.Pick(""))
+	assert.Equal(t, "a", b.Pick(""))
+
+	b.Done("b")
+	assert.Equal(t, "b", b.Pick(""))
+
+	b.MarkDown("a")
+	b.MarkDown("b")
+	assert.NotEmpty(t, b.Pick(""), "backends are picked when all of them are down")
+}
+
+func TestBalancerSticky(t *testing.T) {
+	b, err := NewBalancer(BalanceRoundRobin, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	b.Sticky = true
+
+	first := b.Pick("5000")
+	b.Pick("5001")
+
+	assert.Equal(t, first, b.Pick("5000"))
+
+	b.MarkDown(first)
+	assert.NotEqual(t, first, b.Pick("5000"))
+}
@@ -2,11 +2,15 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"golang.org/x/sync/errgroup"
+
 	"github.com/superfly/flyctl/agent"
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/iostreams"
@@ -21,29 +25,112 @@ type ConnectParams struct {
 	RemoteHost       string
 	PromptInstance   bool
 	DisableSpinner   bool
+
+	// Mappings, when set, take precedence over Ports.
+	Mappings []Mapping
+
+	// BindAddr is the local address ports are bound to. It defaults to
+	// 127.0.0.1.
+	BindAddr string
+
+	// SOCKS5Addr, when set, is the local address of a SOCKS5 server through
+	// which any *.internal name or 6PN address of the organization may be
+	// reached. Mappings are optional then.
+	SOCKS5Addr string
+
+	// Balance, when set, spreads connections across every instance of the
+	// app with the named strategy, instead of proxying to RemoteHost.
+	Balance string
+
+	// Sticky makes connections from the same source port go to the same
+	// instance when balancing.
+	Sticky bool
+
+	// IdleTimeout, when positive, closes connections which carried no data
+	// for that long.
+	IdleTimeout time.Duration
+
+	// DrainTimeout caps how long connections in flight are waited for on
+	// shutdown.
+	DrainTimeout time.Duration
+
+	// ShowStatus keeps a status line with the number of connections and the
+	// bytes transferred up to date on stderr.
+	ShowStatus bool
+}
+
+// mappings returns the mappings of the params, derived from Ports unless
+// Mappings is set.
+func (p *ConnectParams) mappings() []Mapping {
+	if len(p.Mappings) > 0 || len(p.Ports) == 0 {
+		return p.Mappings
+	}
+
+	m := Mapping{
+		Local:   p.Ports[0],
+		Remote:  p.Ports[0],
+		Network: "tcp",
+	}
+
+	if len(p.Ports) > 1 {
+		m.Remote = p.Ports[1]
+	}
+
+	return []Mapping{m}
 }
 
 func Connect(ctx context.Context, p *ConnectParams) (err error) {
-	server, err := NewServer(ctx, p)
+	servers, err := NewServers(ctx, p)
 	if err != nil {
 		return err
 	}
 
-	return server.ProxyServer(ctx)
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	for _, server := range servers {
+		server := server
+
+		eg.Go(func() error {
+			return server.ProxyServer(ctx)
+		})
+	}
+
+	if p.ShowStatus {
+		go printStatus(ctx, iostreams.FromContext(ctx).ErrOut, servers)
+	}
+
+	return eg.Wait()
 }
 
+// NewServer returns the server of the first mapping of the params.
 func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
+	servers, err := NewServers(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers[1:] {
+		server.Close()
+	}
+
+	return servers[0], nil
+}
+
+// NewServers returns a server for each of the mappings of the params, all of
+// them proxying to the same remote host, followed by the SOCKS5 server if
+// the params ask for one.
+func NewServers(ctx context.Context, p *ConnectParams) ([]*Server, error) {
 	var (
-		io         = iostreams.FromContext(ctx)
-		client     = client.FromContext(ctx).API()
-		orgSlug    = p.OrganizationSlug
-		localPort  = p.Ports[0]
-		remotePort = localPort
-		remoteAddr string
+		io       = iostreams.FromContext(ctx)
+		client   = client.FromContext(ctx).API()
+		orgSlug  = p.OrganizationSlug
+		bindAddr = p.BindAddr
+		host     string
 	)
 
-	if len(p.Ports) > 1 {
-		remotePort = p.Ports[1]
+	if bindAddr == "" {
+		bindAddr = "127.0.0.1"
 	}
 
 	agentclient, err := agent.Establish(ctx, client)
@@ -58,10 +145,22 @@ func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 			return nil, err
 		}
 
-		remoteAddr = fmt.Sprintf("[%s]:%s", instance, remotePort)
+		host = instance
+	}
+
+	mappings := p.mappings()
+
+	var instances []string
+	if p.Balance != "" && len(mappings) > 0 {
+		found, err := agentclient.Instances(ctx, orgSlug, p.AppName)
+		if err != nil {
+			return nil, fmt.Errorf("look up %s: %w", p.AppName, err)
+		}
+
+		instances = found.Addresses
 	}
 
-	if remoteAddr == "" && p.RemoteHost != "" {
+	if host == "" && p.RemoteHost != "" && len(mappings) > 0 && instances == nil {
 
 		// If a host is specified that isn't an IpV6 address, assume it's a DNS entry and wait for that
 		// entry to resolve
@@ -71,42 +170,151 @@ func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 			}
 		}
 
-		remoteAddr = fmt.Sprintf("[%s]:%s", p.RemoteHost, remotePort)
+		host = p.RemoteHost
+	}
+
+	var servers []*Server
+	closeServers := func() {
+		for _, server := range servers {
+			server.Close()
+		}
 	}
 
-	var listener net.Listener
+	for _, m := range mappings {
+		server, err := listen(bindAddr, m)
+		if err != nil {
+			closeServers()
+
+			return nil, err
+		}
+
+		server.Addr = fmt.Sprintf("[%s]:%s", host, m.Remote)
+		server.Dial = p.Dialer.DialContext
+		server.IdleTimeout = p.IdleTimeout
+		server.DrainTimeout = p.DrainTimeout
 
-	if _, err := strconv.Atoi(localPort); err == nil {
+		local := m.Local
+		if m.Network == "udp" {
+			local += "/udp"
+		}
+
+		if instances != nil {
+			addrs := make([]string, 0, len(instances))
+			for _, instance := range instances {
+				addrs = append(addrs, fmt.Sprintf("[%s]:%s", instance, m.Remote))
+			}
+
+			if server.Balancer, err = NewBalancer(p.Balance, addrs); err != nil {
+				server.Close()
+				closeServers()
+
+				return nil, err
+			}
+			server.Balancer.Sticky = p.Sticky
+
+			fmt.Fprintf(io.Out, "Proxying local port %s to port %s of %d instances (%s)\n", local, m.Remote, len(addrs), p.Balance)
+		} else {
+			fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", local, server.Addr)
+		}
+
+		servers = append(servers, server)
+	}
+
+	if p.SOCKS5Addr != "" {
+		server, err := listenSOCKS5(bindAddr, p.SOCKS5Addr)
+		if err != nil {
+			closeServers()
+
+			return nil, err
+		}
+
+		server.Dial = p.Dialer.DialContext
+		server.IdleTimeout = p.IdleTimeout
+		server.DrainTimeout = p.DrainTimeout
+
+		fmt.Fprintf(io.Out, "Serving SOCKS5 on %s for *.internal and 6PN addresses\n", server.LocalAddr)
+
+		servers = append(servers, server)
+	}
+
+	if len(servers) == 0 {
+		return nil, errors.New("nothing to proxy")
+	}
+
+	return servers, nil
+}
+
+// listenSOCKS5 binds the SOCKS5 server to addr, which defaults to bindAddr
+// when it only names a port, as in :1080.
+func listenSOCKS5(bindAddr, addr string) (*Server, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = "", addr
+	}
+
+	if host == "" {
+		host = bindAddr
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		LocalAddr: listener.Addr().String(),
+		Listener:  listener,
+		SOCKS5:    true,
+		Stats:     new(Stats),
+	}, nil
+}
+
+// listen binds the local end of the mapping.
+func listen(bindAddr string, m Mapping) (*Server, error) {
+	server := &Server{
+		Stats: new(Stats),
+	}
+
+	switch _, err := strconv.Atoi(m.Local); {
+	case m.Network == "udp":
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(bindAddr, m.Local))
+		if err != nil {
+			return nil, err
+		}
+
+		server.PacketConn = conn
+		server.LocalAddr = conn.LocalAddr().String()
+	case err == nil:
 		// just numbers
-		addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("127.0.0.1:%s", localPort))
+		addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(bindAddr, m.Local))
 		if err != nil {
 			return nil, err
 		}
 
-		listener, err = net.ListenTCP("tcp", addr)
+		listener, err := net.ListenTCP("tcp", addr)
 		if err != nil {
 			return nil, err
 		}
-	} else {
+
+		server.Listener = listener
+		server.LocalAddr = listener.Addr().String()
+	default:
 		// probably a unix path
-		addr, err := net.ResolveUnixAddr("unix", localPort)
+		addr, err := net.ResolveUnixAddr("unix", m.Local)
 		if err != nil {
 			return nil, err
 		}
 
-		listener, err = net.ListenUnix("unix", addr)
+		listener, err := net.ListenUnix("unix", addr)
 		if err != nil {
 			return nil, err
 		}
-	}
 
-	fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", localPort, remoteAddr)
+		server.Listener = listener
+		server.LocalAddr = m.Local
+	}
 
-	return &Server{
-		Addr:     remoteAddr,
-		Listener: listener,
-		Dial:     p.Dialer.DialContext,
-	}, nil
+	return server, nil
 }
 
 func selectInstance(ctx context.Context, org, app string, c *agent.Client) (instance string, err error) {
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// trackedConn is a proxied connection: the accepted source and, once it's
+// dialed, its target.
+type trackedConn struct {
+	source net.Conn
+
+	mu     sync.Mutex // protects target
+	target net.Conn
+
+	// lastActive holds the time data was last read off either end, in
+	// nanoseconds since the epoch.
+	lastActive atomic.Int64
+}
+
+func (c *trackedConn) setTarget(target net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.target = target
+}
+
+func (c *trackedConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// close closes both ends of the connection, which unblocks the copies.
+func (c *trackedConn) close() {
+	c.source.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.target != nil {
+		c.target.Close()
+	}
+}
+
+// connSet tracks the connections a Server is proxying so that they may be
+// reaped once idle and drained on shutdown.
+type connSet struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+	wg    sync.WaitGroup
+}
+
+func newConnSet() *connSet {
+	return &connSet{
+		conns: make(map[*trackedConn]struct{}),
+	}
+}
+
+// add tracks the accepted connection. It must be removed once it's over.
+func (s *connSet) add(source net.Conn) *trackedConn {
+	c := &trackedConn{source: source}
+	c.touch()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+
+	return c
+}
+
+// remove closes the connection and stops tracking it.
+func (s *connSet) remove(c *trackedConn) {
+	c.close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conns[c]; ok {
+		delete(s.conns, c)
+		s.wg.Done()
+	}
+}
+
+func (s *connSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// closeAll closes every connection. They're removed by the goroutines
+// proxying them as their copies fail.
+func (s *connSet) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		c.close()
+	}
+}
+
+// closeIdle closes the connections which were last active before the given
+// time and returns their number.
+func (s *connSet) closeIdle(before time.Time) (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		if c.lastActive.Load() < before.UnixNano() {
+			c.close()
+			n++
+		}
+	}
+
+	return
+}
+
+// wait waits for every connection to be removed, for up to timeout. It
+// reports whether they all were.
+func (s *connSet) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		s.wg.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
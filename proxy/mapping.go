@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mapping forwards a local port, or unix socket, to a remote port.
+type Mapping struct {
+	// Local is the local port, or the path of a unix socket.
+	Local string
+
+	// Remote is the remote port.
+	Remote string
+
+	// Network is either tcp or udp.
+	Network string
+}
+
+func (m Mapping) String() string {
+	return fmt.Sprintf("%s:%s/%s", m.Local, m.Remote, m.Network)
+}
+
+// ParseMapping parses mappings of the local[:remote][/tcp|/udp] form, where
+// local is a port or the path of a unix socket. The remote port defaults to
+// the local one and the network to tcp.
+func ParseMapping(s string) (m Mapping, err error) {
+	m.Network = "tcp"
+	for _, network := range []string{"tcp", "udp"} {
+		if spec := strings.TrimSuffix(s, "/"+network); spec != s {
+			s, m.Network = spec, network
+
+			break
+		}
+	}
+
+	m.Local, m.Remote = s, s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		m.Local, m.Remote = s[:i], s[i+1:]
+	}
+
+	if !isPort(m.Remote) {
+		return Mapping{}, fmt.Errorf("invalid port mapping %q: %q is not a port", s, m.Remote)
+	}
+
+	switch {
+	case isPort(m.Local):
+	case !strings.Contains(m.Local, "/"):
+		return Mapping{}, fmt.Errorf("invalid port mapping %q: %q is neither a port nor a path", s, m.Local)
+	case m.Network == "udp":
+		return Mapping{}, fmt.Errorf("invalid port mapping %q: unix sockets can't be used with udp", s)
+	}
+
+	return m, nil
+}
+
+func isPort(s string) bool {
+	port, err := strconv.ParseUint(s, 10, 16)
+
+	return err == nil && port > 0
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMapping(t *testing.T) {
+	cases := map[string]Mapping{
+		"5432":                  {Local: "5432", Remote: "5432", Network: "tcp"},
+		"15432:5432":            {Local: "15432", Remote: "5432", Network: "tcp"},
+		"5353:53/udp":           {Local: "5353", Remote: "53", Network: "udp"},
+		"8080/tcp":              {Local: "8080", Remote: "8080", Network: "tcp"},
+		"/tmp/docker.sock:2375": {Local: "/tmp/docker.sock", Remote: "2375", Network: "tcp"},
+	}
+
+	for spec, expected := range cases {
+		m, err := ParseMapping(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, expected, m, spec)
+	}
+
+	for _, spec := range []string{"myapp.internal", "fdaa::3", "5432:http", "0", "/tmp/dns.sock:53/udp"} {
+		_, err := ParseMapping(spec)
+		assert.Error(t, err, spec)
+	}
+}
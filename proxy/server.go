@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
@@ -16,71 +18,251 @@ type Server struct {
 	Addr      string
 	Listener  net.Listener
 	Dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// PacketConn, when set, makes the server forward UDP datagrams received
+	// on it instead of accepting connections off Listener.
+	PacketConn net.PacketConn
+
+	// SOCKS5, when set, makes the server a SOCKS5 proxy which dials the
+	// addresses clients request rather than Addr.
+	SOCKS5 bool
+
+	// Balancer, when set, picks the address each connection goes to instead
+	// of Addr.
+	Balancer *Balancer
+
+	// IdleTimeout, when positive, closes connections which carried no data
+	// for that long.
+	IdleTimeout time.Duration
+
+	// DrainTimeout caps how long connections in flight are waited for once
+	// the server is shutting down, before they're closed.
+	DrainTimeout time.Duration
+
+	// Stats counts the connections the server proxies.
+	Stats *Stats
 }
 
 func (srv *Server) ProxyServer(ctx context.Context) error {
-	defer srv.Listener.Close()
+	if srv.Stats == nil {
+		srv.Stats = new(Stats)
+	}
+
+	if srv.PacketConn != nil {
+		return srv.proxyPackets(ctx)
+	}
+
+	conns := newConnSet()
 
+	if srv.IdleTimeout > 0 {
+		reapCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go srv.reapIdle(reapCtx, conns)
+	}
+
+	err := srv.accept(ctx, conns)
+
+	srv.Listener.Close()
+	srv.drain(conns)
+
+	return err
+}
+
+// accept accepts connections until ctx is done or the listener fails.
+func (srv *Server) accept(ctx context.Context, conns *connSet) error {
 	for {
-		select {
+		if ctx.Err() != nil {
+			return nil
+		}
 
-		case <-ctx.Done():
+		if ls, ok := srv.Listener.(*net.TCPListener); ok {
+			if err := ls.SetDeadline(time.Now().Add(time.Second)); err != nil {
+				return err
+			}
+		} else if ls, ok := srv.Listener.(*net.UnixListener); ok {
+			if err := ls.SetDeadline(time.Now().Add(time.Second)); err != nil {
+				return err
+			}
+		}
+
+		source, err := srv.Listener.Accept()
+		switch {
+		case err == nil:
+		case os.IsTimeout(err):
+			continue
+		case errors.Is(err, net.ErrClosed):
 			return nil
 		default:
-			if ls, ok := srv.Listener.(*net.TCPListener); ok {
-				if err := ls.SetDeadline(time.Now().Add(time.Second)); err != nil {
-					return err
-				}
-			} else if ls, ok := srv.Listener.(*net.UnixListener); ok {
-				if err := ls.SetDeadline(time.Now().Add(time.Second)); err != nil {
-					return err
-				}
-			}
+			return fmt.Errorf("failed accepting connection: %w", err)
+		}
+
+		terminal.Debug("accepted new connection from: ", source.RemoteAddr())
+
+		c := conns.add(source)
+		go func() {
+			defer conns.remove(c)
+
+			srv.serve(ctx, c)
+		}()
+	}
+}
+
+// serve proxies the connection until either end closes it.
+func (srv *Server) serve(ctx context.Context, c *trackedConn) {
+	source := c.source
+
+	addr := srv.Addr
+	if srv.SOCKS5 {
+		var err error
+		if addr, err = socks5Handshake(source); err != nil {
+			terminal.Debug("socks5 handshake failed: ", err)
+			return
+		}
+	}
+
+	var (
+		target net.Conn
+		err    error
+	)
+	if srv.SOCKS5 {
+		target, err = srv.Dial(ctx, "tcp", addr)
+	} else {
+		var done func()
+		target, done, err = srv.dialTarget(ctx, "tcp", source.RemoteAddr())
+		if err == nil {
+			defer done()
+		}
+	}
+
+	if srv.SOCKS5 {
+		rep := socks5Succeeded
+		if err != nil {
+			rep = socks5HostUnreachable
+		}
+
+		if err := socks5Reply(source, rep); err != nil {
+			terminal.Debug("socks5 reply failed: ", err)
+		}
+	}
+	if err != nil {
+		terminal.Debug("failed to connect to target: ", err)
+		return
+	}
+	c.setTarget(target)
+
+	srv.Stats.Active.Add(1)
+	srv.Stats.Total.Add(1)
+	defer srv.Stats.Active.Add(-1)
+
+	wg := &sync.WaitGroup{}
+
+	wg.Add(2)
+
+	copyFunc := func(dst net.Conn, src io.Reader) {
+		defer wg.Done()
+		io.Copy(dst, src)
+
+		// close the write half if it exports a CloseWrite() method
+		if conn, ok := dst.(ClosableWrite); ok {
+			conn.CloseWrite()
+		}
+	}
+
+	go copyFunc(target, countingReader{source, &srv.Stats.BytesOut, c.touch})
+	go copyFunc(source, countingReader{target, &srv.Stats.BytesIn, c.touch})
+
+	wg.Wait()
+
+	terminal.Debug("connection closed")
+}
+
+// reapIdle closes the connections which have been idle for longer than the
+// idle timeout, until ctx is done.
+func (srv *Server) reapIdle(ctx context.Context, conns *connSet) {
+	interval := srv.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
 
-			source, err := srv.Listener.Accept()
-			if err != nil {
-				if os.IsTimeout(err) {
-					continue
-				}
-				terminal.Debug("Error accepting connection: ", err)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := conns.closeIdle(time.Now().Add(-srv.IdleTimeout)); n > 0 {
+				terminal.Debugf("closed %d idle connections\n", n)
 			}
-			defer source.Close()
+		}
+	}
+}
+
+// drain waits for the connections in flight to finish, for up to the drain
+// timeout, and closes those left afterwards.
+func (srv *Server) drain(conns *connSet) {
+	if n := conns.len(); n > 0 {
+		terminal.Debugf("draining %d connections\n", n)
+	}
+
+	if conns.wait(srv.DrainTimeout) {
+		return
+	}
+
+	conns.closeAll()
+	conns.wait(srv.DrainTimeout + time.Second)
+}
 
-			terminal.Debug("accepted new connection from: ", source.RemoteAddr())
+// dialTarget dials the remote end of a connection from source, trying every
+// backend of the balancer, if any, before giving up. Backends which fail to
+// connect are marked down. done must be called once the connection is over.
+func (srv *Server) dialTarget(ctx context.Context, network string, source net.Addr) (conn net.Conn, done func(), err error) {
+	if srv.Balancer == nil {
+		conn, err = srv.Dial(ctx, network, srv.Addr)
 
-			go func() {
-				target, err := srv.Dial(ctx, "tcp", srv.Addr)
-				if err != nil {
-					terminal.Debug("failed to connect to target: ", err)
-					return
-				}
-				defer target.Close()
+		return conn, func() {}, err
+	}
 
-				wg := &sync.WaitGroup{}
+	var key string
+	if source != nil {
+		if _, port, splitErr := net.SplitHostPort(source.String()); splitErr == nil {
+			key = port
+		}
+	}
 
-				wg.Add(2)
+	for i := 0; i < srv.Balancer.Len(); i++ {
+		addr := srv.Balancer.Pick(key)
 
-				copyFunc := func(dst net.Conn, src net.Conn) {
-					defer wg.Done()
-					io.Copy(dst, src)
+		if conn, err = srv.Dial(ctx, network, addr); err == nil {
+			terminal.Debug("balanced connection to: ", addr)
 
-					// close the write half if it exports a CloseWrite() method
-					if conn, ok := dst.(ClosableWrite); ok {
-						conn.CloseWrite()
-					}
-				}
+			return conn, func() { srv.Balancer.Done(addr) }, nil
+		}
 
-				go copyFunc(target, source)
-				go copyFunc(source, target)
+		srv.Balancer.Done(addr)
+		srv.Balancer.MarkDown(addr)
 
-				wg.Wait()
+		terminal.Debugf("instance %s is down: %v\n", addr, err)
 
-				terminal.Debug("connection closed")
-			}()
+		if ctx.Err() != nil {
+			break
 		}
 	}
+
+	return nil, nil, err
 }
 
 type ClosableWrite interface {
 	CloseWrite() error
 }
+
+// Close closes the server's listener, or packet connection.
+func (srv *Server) Close() error {
+	if srv.PacketConn != nil {
+		return srv.PacketConn.Close()
+	}
+
+	return srv.Listener.Close()
+}
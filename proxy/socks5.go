@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SOCKS5 replies, as defined by RFC 1928.
+const (
+	socks5Succeeded           byte = 0x00
+	socks5GeneralFailure      byte = 0x01
+	socks5NotAllowed          byte = 0x02
+	socks5HostUnreachable     byte = 0x04
+	socks5CommandNotSupported byte = 0x07
+	socks5AddressNotSupported byte = 0x08
+)
+
+const (
+	socks5Version    byte = 0x05
+	socks5NoAuth     byte = 0x00
+	socks5NoMethods  byte = 0xff
+	socks5Connect    byte = 0x01
+	socks5IPv4       byte = 0x01
+	socks5DomainName byte = 0x03
+	socks5IPv6       byte = 0x04
+)
+
+// socks5HandshakeTimeout caps how long clients may take to send their
+// request.
+const socks5HandshakeTimeout = 10 * time.Second
+
+var errSocks5Rejected = errors.New("socks5 request rejected")
+
+// socks5Handshake negotiates a SOCKS5 CONNECT request off conn and returns
+// the address it targets. Only *.internal names and 6PN addresses may be
+// targeted. Requests which can't be served are replied to with the reason.
+func socks5Handshake(conn net.Conn) (string, error) {
+	_ = conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	// greeting: version, number of methods, methods
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported socks version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := socks5NoMethods
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+	if method == socks5NoMethods {
+		return "", errors.New("socks5 client requires authentication")
+	}
+
+	// request: version, command, reserved, address type, address, port
+	var request [4]byte
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return "", err
+	}
+
+	if request[1] != socks5Connect {
+		return "", socks5Reject(conn, socks5CommandNotSupported)
+	}
+
+	var host string
+	switch request[3] {
+	case socks5IPv4:
+		// 6PN is IPv6 only; the address is read for the sake of completeness.
+		var addr [net.IPv4len]byte
+		if _, err := io.ReadFull(conn, addr[:]); err != nil {
+			return "", err
+		}
+		host = net.IP(addr[:]).String()
+	case socks5IPv6:
+		var addr [net.IPv6len]byte
+		if _, err := io.ReadFull(conn, addr[:]); err != nil {
+			return "", err
+		}
+		host = net.IP(addr[:]).String()
+	case socks5DomainName:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return "", err
+		}
+
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", socks5Reject(conn, socks5AddressNotSupported)
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+
+	if !isPrivateHost(host) {
+		return "", socks5Reject(conn, socks5NotAllowed)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// socks5Reply replies to the request with the given code.
+func socks5Reply(conn net.Conn, rep byte) error {
+	// The bound address isn't meaningful through the tunnel, so it's zeroed.
+	_, err := conn.Write([]byte{socks5Version, rep, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0})
+
+	return err
+}
+
+func socks5Reject(conn net.Conn, rep byte) error {
+	if err := socks5Reply(conn, rep); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: reply %d", errSocks5Rejected, rep)
+}
+
+// isPrivateHost reports whether host is a *.internal name or a 6PN address.
+func isPrivateHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4() == nil && ip[0] == 0xfd && ip[1] == 0xaa
+	}
+
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToLower(host), "."), ".internal")
+}
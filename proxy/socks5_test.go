@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func socks5Request(t *testing.T, request []byte) (addr string, reply []byte, err error) {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+
+		addr, err = socks5Handshake(server)
+	}()
+
+	_, werr := client.Write([]byte{socks5Version, 1, socks5NoAuth})
+	require.NoError(t, werr)
+
+	greeting := make([]byte, 2)
+	_, rerr := io.ReadFull(client, greeting)
+	require.NoError(t, rerr)
+	require.Equal(t, []byte{socks5Version, socks5NoAuth}, greeting)
+
+	_, werr = client.Write(request)
+	require.NoError(t, werr)
+
+	reply, _ = io.ReadAll(client)
+	<-done
+
+	return
+}
+
+func TestSocks5Handshake(t *testing.T) {
+	name := "db.internal"
+	request := append([]byte{socks5Version, socks5Connect, 0, socks5DomainName, byte(len(name))}, name...)
+	request = append(request, 0x15, 0x38)
+
+	addr, reply, err := socks5Request(t, request)
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal:5432", addr)
+	assert.Empty(t, reply)
+
+	sixPN := net.ParseIP("fdaa:0:1:a7b::2")
+	request = append([]byte{socks5Version, socks5Connect, 0, socks5IPv6}, sixPN...)
+	request = append(request, 0, 80)
+
+	addr, _, err = socks5Request(t, request)
+	require.NoError(t, err)
+	assert.Equal(t, "[fdaa:0:1:a7b::2]:80", addr)
+
+	request = []byte{socks5Version, socks5Connect, 0, socks5IPv4, 1, 1, 1, 1, 0, 80}
+
+	_, reply, err = socks5Request(t, request)
+	assert.ErrorIs(t, err, errSocks5Rejected)
+	require.Len(t, reply, 10)
+	assert.Equal(t, socks5NotAllowed, reply[1])
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Stats counts the connections a Server proxies and the bytes they carry.
+// UDP flows, keyed by the local peer's address, count as connections.
+type Stats struct {
+	Active atomic.Int64
+	Total  atomic.Int64
+
+	// BytesIn counts the bytes received from the remote and BytesOut those
+	// sent to it.
+	BytesIn  atomic.Uint64
+	BytesOut atomic.Uint64
+}
+
+// countingReader counts the bytes read off r and calls touch, when set,
+// whenever any are.
+type countingReader struct {
+	r     io.Reader
+	n     *atomic.Uint64
+	touch func()
+}
+
+func (cr countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.n.Add(uint64(n))
+
+	if n > 0 && cr.touch != nil {
+		cr.touch()
+	}
+
+	return
+}
+
+// statusLine sums up the stats of the servers.
+func statusLine(servers []*Server) string {
+	var (
+		active, total     int64
+		bytesIn, bytesOut uint64
+	)
+
+	for _, srv := range servers {
+		active += srv.Stats.Active.Load()
+		total += srv.Stats.Total.Load()
+		bytesIn += srv.Stats.BytesIn.Load()
+		bytesOut += srv.Stats.BytesOut.Load()
+	}
+
+	return fmt.Sprintf("%d active, %d total connections | %s in, %s out",
+		active, total, humanize.Bytes(bytesIn), humanize.Bytes(bytesOut))
+}
+
+// printStatus rewrites the status line of the servers on w every second
+// until ctx is done.
+func printStatus(ctx context.Context, w io.Writer, servers []*Server) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(w)
+
+			return
+		case <-ticker.C:
+			if line := statusLine(servers); line != last {
+				fmt.Fprintf(w, "\r\033[K%s", line)
+				last = line
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/superfly/flyctl/terminal"
+)
+
+// udpIdleTimeout is how long a UDP flow lasts without traffic in either
+// direction, unless the server's IdleTimeout is set.
+const udpIdleTimeout = time.Minute
+
+func (srv *Server) flowTimeout() time.Duration {
+	if srv.IdleTimeout > 0 {
+		return srv.IdleTimeout
+	}
+
+	return udpIdleTimeout
+}
+
+// proxyPackets forwards the datagrams received on the server's PacketConn to
+// the remote address. Each local peer gets a flow of its own, through which
+// replies are relayed back to it.
+func (srv *Server) proxyPackets(ctx context.Context) error {
+	defer srv.PacketConn.Close()
+
+	var (
+		mu    sync.Mutex
+		flows = make(map[string]net.Conn)
+	)
+
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, target := range flows {
+			target.Close()
+		}
+	}()
+
+	buf := make([]byte, math.MaxUint16)
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := srv.PacketConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return err
+		}
+
+		n, peer, err := srv.PacketConn.ReadFrom(buf)
+		switch {
+		case os.IsTimeout(err):
+			continue
+		case errors.Is(err, net.ErrClosed):
+			return nil
+		case err != nil:
+			terminal.Debug("Error reading datagram: ", err)
+
+			continue
+		}
+
+		key := peer.String()
+
+		mu.Lock()
+		target := flows[key]
+		mu.Unlock()
+
+		if target == nil {
+			var done func()
+			if target, done, err = srv.dialTarget(ctx, "udp", peer); err != nil {
+				terminal.Debug("failed to connect to target: ", err)
+
+				continue
+			}
+
+			mu.Lock()
+			flows[key] = target
+			mu.Unlock()
+
+			srv.Stats.Active.Add(1)
+			srv.Stats.Total.Add(1)
+
+			go func() {
+				defer func() {
+					mu.Lock()
+					delete(flows, key)
+					mu.Unlock()
+
+					target.Close()
+					done()
+					srv.Stats.Active.Add(-1)
+				}()
+
+				srv.relayReplies(target, peer)
+			}()
+		}
+
+		_ = target.SetReadDeadline(time.Now().Add(srv.flowTimeout()))
+
+		if _, err := target.Write(buf[:n]); err != nil {
+			terminal.Debug("failed forwarding datagram: ", err)
+
+			continue
+		}
+		srv.Stats.BytesOut.Add(uint64(n))
+	}
+}
+
+// relayReplies writes the datagrams received off target back to the peer
+// until the flow goes idle or is closed.
+func (srv *Server) relayReplies(target net.Conn, peer net.Addr) {
+	buf := make([]byte, math.MaxUint16)
+
+	for {
+		n, err := target.Read(buf)
+		if err != nil {
+			terminal.Debug("udp flow closed: ", err)
+
+			return
+		}
+
+		_ = target.SetReadDeadline(time.Now().Add(srv.flowTimeout()))
+
+		if _, err := srv.PacketConn.WriteTo(buf[:n], peer); err != nil {
+			terminal.Debug("failed relaying datagram: ", err)
+
+			return
+		}
+		srv.Stats.BytesIn.Add(uint64(n))
+	}
+}
@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"context"
 	"time"
 
 	"github.com/jpillora/backoff"
@@ -28,3 +29,40 @@ func RetryBackoff(fn func() error, attempts uint, backoff *backoff.Backoff) (err
 
 	return
 }
+
+// RetryBackoffContext calls fn until it succeeds or has been called attempts
+// times, waiting for backoff between calls. It gives up waiting once ctx is
+// done, returning the last error fn returned.
+func RetryBackoffContext(ctx context.Context, fn func(context.Context) error, attempts uint, backoff *backoff.Backoff) error {
+	return RetryProgress(ctx, func(ctx context.Context) (bool, error) {
+		return false, fn(ctx)
+	}, attempts, backoff)
+}
+
+// RetryProgress is RetryBackoffContext for operations which may partly
+// succeed, such as writing a batch one item at a time. fn keeps track of what
+// is left to do and reports whether it made any progress before failing, in
+// which case backoff starts over, since what failed earlier recovered.
+func RetryProgress(ctx context.Context, fn func(context.Context) (bool, error), attempts uint, backoff *backoff.Backoff) (err error) {
+	for i := attempts; i > 0; i-- {
+		var progressed bool
+		if progressed, err = fn(ctx); err == nil || i == 1 {
+			break
+		}
+
+		if progressed {
+			backoff.Reset()
+		}
+
+		t := time.NewTimer(backoff.Duration())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+
+			return
+		case <-t.C:
+		}
+	}
+
+	return
+}
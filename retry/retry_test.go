@@ -1,8 +1,12 @@
 package retry
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
+
+	"github.com/jpillora/backoff"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -74,3 +78,43 @@ func testFailAll(t *testing.T) {
 	assert.ErrorIs(t, err, errFail)
 	assert.Equal(t, 3, count)
 }
+
+func TestRetryProgress(t *testing.T) {
+	b := &backoff.Backoff{Min: time.Millisecond, Max: time.Millisecond}
+
+	// what's left is carried over from one attempt to the next
+	left := 3
+	err := RetryProgress(context.Background(), func(context.Context) (bool, error) {
+		left--
+		if left > 0 {
+			return true, errFail
+		}
+
+		return true, nil
+	}, 3, b)
+	assert.NoError(t, err)
+	assert.Zero(t, left)
+
+	var count int
+	err = RetryBackoffContext(context.Background(), func(context.Context) error {
+		count++
+		return errFail
+	}, 3, b)
+	assert.ErrorIs(t, err, errFail)
+	assert.Equal(t, 3, count)
+}
+
+func TestRetryBackoffContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &backoff.Backoff{Min: time.Hour, Max: time.Hour}
+
+	var count int
+	err := RetryBackoffContext(ctx, func(context.Context) error {
+		count++
+		cancel()
+
+		return errFail
+	}, 3, b)
+	assert.ErrorIs(t, err, errFail)
+	assert.Equal(t, 1, count)
+}
@@ -21,6 +21,16 @@ type Client struct {
 	conn   ssh.Conn
 }
 
+// Attach returns a Client of the already connected client.
+func Attach(addr, user string, client *ssh.Client) *Client {
+	return &Client{
+		Addr:   addr,
+		User:   user,
+		Client: client,
+		conn:   client.Conn,
+	}
+}
+
 func (c *Client) Close() error {
 	if c.conn != nil {
 		if err := c.conn.Close(); err != nil {
@@ -2,8 +2,10 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"io"
 	"runtime"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
@@ -37,6 +39,8 @@ type Terminal struct {
 	Stdout io.WriteCloser
 	Stderr io.WriteCloser
 
+	// Mode is the terminal type of the pty requested for the session. No pty
+	// is requested when it's empty, which keeps stdout and stderr apart.
 	Mode string
 }
 
@@ -72,8 +76,10 @@ func (t *Terminal) attach(ctx context.Context, sess *ssh.Session, cmd string) er
 		}
 	}
 
-	if err := sess.RequestPty(t.Mode, height, width, modes); err != nil {
-		return err
+	if t.Mode != "" {
+		if err := sess.RequestPty(t.Mode, height, width, modes); err != nil {
+			return err
+		}
 	}
 
 	stdin, err := sess.StdinPipe()
@@ -92,18 +98,56 @@ func (t *Terminal) attach(ctx context.Context, sess *ssh.Session, cmd string) er
 		return err
 	}
 
-	go io.Copy(stdin, t.Stdin)
-	go io.Copy(t.Stdout, stdout)
-	go io.Copy(t.Stderr, stderr)
+	go func() {
+		_, _ = io.Copy(stdin, t.Stdin)
+		_ = stdin.Close()
+	}()
+
+	// the output is copied in full before returning
+	var output sync.WaitGroup
+	output.Add(2)
+
+	go func() {
+		defer output.Done()
+
+		_, _ = io.Copy(t.Stdout, stdout)
+	}()
+
+	go func() {
+		defer output.Done()
+
+		_, _ = io.Copy(t.Stderr, stderr)
+	}()
 
 	if cmd == "" {
-		err = sess.Shell()
+		if err = sess.Shell(); err != nil {
+			return err
+		}
+
+		err = sess.Wait()
 	} else {
 		err = sess.Run(cmd)
 	}
-	if err != nil && err != io.EOF {
+
+	switch {
+	case err == io.EOF:
+		err = nil
+	case err != nil && !exited(err):
 		return err
 	}
 
-	return nil
+	output.Wait()
+
+	return err
+}
+
+// exited reports whether err reports on how the command exited, after which
+// its output is complete.
+func exited(err error) bool {
+	var (
+		exitErr    *ssh.ExitError
+		exitMissed *ssh.ExitMissingError
+	)
+
+	return errors.As(err, &exitErr) || errors.As(err, &exitMissed)
 }
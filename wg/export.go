@@ -0,0 +1,211 @@
+package wg
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Formats peer configs may be exported in.
+const (
+	FormatWgQuick        = "wg-quick"
+	FormatNetworkManager = "networkmanager"
+	FormatNetworkd       = "systemd-networkd"
+)
+
+// Resolvers split DNS snippets may be exported for.
+const (
+	DNSResolved = "resolved"
+	DNSDnsmasq  = "dnsmasq"
+)
+
+// exportKeepAlive is the keepalive interval, in seconds, of exported peers.
+const exportKeepAlive = 15
+
+// peerConfig is what the peer config templates render.
+type peerConfig struct {
+	Org        string
+	Name       string
+	Interface  string
+	PrivateKey string
+	PublicKey  string
+	Address    string
+	AllowedIPs string
+	DNS        string
+	Endpoint   string
+	KeepAlive  int
+}
+
+func (s *WireGuardState) peerConfig() *peerConfig {
+	network, dns := OrgNetwork(s.Peer.Peerip)
+
+	return &peerConfig{
+		Org:        s.Org,
+		Name:       s.Name,
+		Interface:  InterfaceName(s.Org),
+		PrivateKey: s.LocalPrivate,
+		PublicKey:  s.Peer.Pubkey,
+		Address:    s.Peer.Peerip,
+		AllowedIPs: network.String(),
+		DNS:        dns.String(),
+		Endpoint:   s.Peer.Endpointip + ":51820",
+		KeepAlive:  exportKeepAlive,
+	}
+}
+
+var nonInterfaceChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// InterfaceName returns the name exported configs give the interface of the
+// organization's peer. Linux caps interface names at 15 characters.
+func InterfaceName(org string) string {
+	name := "fly-" + nonInterfaceChars.ReplaceAllString(org, "-")
+	if len(name) > 15 {
+		name = name[:15]
+	}
+
+	return name
+}
+
+var (
+	wgQuickTemplate = template.Must(template.New("wg-quick").Parse(`
+[Interface]
+PrivateKey = {{.PrivateKey}}
+Address = {{.Address}}/120
+DNS = {{.DNS}}
+
+[Peer]
+PublicKey = {{.PublicKey}}
+AllowedIPs = {{.AllowedIPs}}
+Endpoint = {{.Endpoint}}
+PersistentKeepalive = {{.KeepAlive}}
+
+`))
+
+	networkManagerTemplate = template.Must(template.New("networkmanager").Parse(`# /etc/NetworkManager/system-connections/{{.Interface}}.nmconnection (mode 0600)
+[connection]
+id={{.Interface}}
+type=wireguard
+interface-name={{.Interface}}
+
+[wireguard]
+private-key={{.PrivateKey}}
+
+[wireguard-peer.{{.PublicKey}}]
+endpoint={{.Endpoint}}
+allowed-ips={{.AllowedIPs}};
+persistent-keepalive={{.KeepAlive}}
+
+[ipv4]
+method=disabled
+
+[ipv6]
+method=manual
+address1={{.Address}}/120
+dns={{.DNS}};
+dns-search=~internal;
+`))
+
+	netdevTemplate = template.Must(template.New("netdev").Parse(`# /etc/systemd/network/{{.Interface}}.netdev (owned by root:systemd-network, mode 0640)
+[NetDev]
+Name={{.Interface}}
+Kind=wireguard
+Description=Fly.io organization {{.Org}}{{with .Name}} ({{.}}){{end}}
+
+[WireGuard]
+PrivateKey={{.PrivateKey}}
+
+[WireGuardPeer]
+PublicKey={{.PublicKey}}
+AllowedIPs={{.AllowedIPs}}
+Endpoint={{.Endpoint}}
+PersistentKeepalive={{.KeepAlive}}
+`))
+
+	networkTemplate = template.Must(template.New("network").Parse(`# /etc/systemd/network/{{.Interface}}.network
+[Match]
+Name={{.Interface}}
+
+[Network]
+Address={{.Address}}/120
+DNS={{.DNS}}
+Domains=~internal
+
+[Route]
+Destination={{.AllowedIPs}}
+`))
+
+	resolvedTemplate = template.Must(template.New("resolved").Parse(`# /etc/systemd/resolved.conf.d/{{.Interface}}.conf
+[Resolve]
+DNS={{.DNS}}
+Domains=~internal
+`))
+
+	dnsmasqTemplate = template.Must(template.New("dnsmasq").Parse(`# /etc/dnsmasq.d/{{.Interface}}.conf
+server=/internal/{{.DNS}}
+`))
+)
+
+// Export writes the peer config in the given format to w. Since
+// systemd-networkd configs span two files, the .netdev is followed by the
+// .network; NetworkdConfig returns them apart.
+func (s *WireGuardState) Export(w io.Writer, format string) error {
+	switch format {
+	case FormatWgQuick:
+		return wgQuickTemplate.Execute(w, s.peerConfig())
+	case FormatNetworkManager:
+		return networkManagerTemplate.Execute(w, s.peerConfig())
+	case FormatNetworkd:
+		netdev, network, err := s.NetworkdConfig()
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "%s\n%s", netdev, network)
+
+		return err
+	default:
+		return fmt.Errorf("unsupported config format %q", format)
+	}
+}
+
+// NetworkdConfig returns the .netdev and .network files of the peer's
+// systemd-networkd config.
+func (s *WireGuardState) NetworkdConfig() (netdev, network string, err error) {
+	cfg := s.peerConfig()
+
+	var b strings.Builder
+	if err = netdevTemplate.Execute(&b, cfg); err != nil {
+		return
+	}
+	netdev = b.String()
+
+	b.Reset()
+	if err = networkTemplate.Execute(&b, cfg); err != nil {
+		return
+	}
+	network = b.String()
+
+	return
+}
+
+// ExportSplitDNS writes a snippet which makes the given resolver send queries
+// for .internal names to the organization's DNS server.
+func ExportSplitDNS(w io.Writer, resolver, org string, dns net.IP) error {
+	cfg := &peerConfig{
+		Org:       org,
+		Interface: InterfaceName(org),
+		DNS:       dns.String(),
+	}
+
+	switch resolver {
+	case DNSResolved:
+		return resolvedTemplate.Execute(w, cfg)
+	case DNSDnsmasq:
+		return dnsmasqTemplate.Execute(w, cfg)
+	default:
+		return fmt.Errorf("unsupported resolver %q", resolver)
+	}
+}
@@ -0,0 +1,52 @@
+package wg
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+)
+
+var exportState = &WireGuardState{
+	Org:          "personal",
+	Name:         "laptop",
+	LocalPrivate: "cHJpdmF0ZQ==",
+	Peer: api.CreatedWireGuardPeer{
+		Peerip:     "fdaa:0:1:a7b:1f:0:a:102",
+		Pubkey:     "cHVibGlj",
+		Endpointip: "1.2.3.4",
+	},
+}
+
+func TestExport(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, exportState.Export(&buf, FormatWgQuick))
+	assert.Contains(t, buf.String(), "Address = fdaa:0:1:a7b:1f:0:a:102/120\n")
+	assert.Contains(t, buf.String(), "DNS = fdaa:0:1::3\n")
+	assert.Contains(t, buf.String(), "AllowedIPs = fdaa:0:1::/48\n")
+	assert.Contains(t, buf.String(), "Endpoint = 1.2.3.4:51820\n")
+
+	buf.Reset()
+	require.NoError(t, exportState.Export(&buf, FormatNetworkManager))
+	assert.Contains(t, buf.String(), "[wireguard-peer.cHVibGlj]\n")
+	assert.Contains(t, buf.String(), "interface-name=fly-personal\n")
+
+	netdev, network, err := exportState.NetworkdConfig()
+	require.NoError(t, err)
+	assert.Contains(t, netdev, "PrivateKey=cHJpdmF0ZQ==\n")
+	assert.Contains(t, network, "Domains=~internal\n")
+
+	assert.Error(t, exportState.Export(&buf, "pptp"))
+}
+
+func TestExportSplitDNS(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, ExportSplitDNS(&buf, DNSDnsmasq, "personal", net.ParseIP("fdaa:0:1::3")))
+	assert.Contains(t, buf.String(), "server=/internal/fdaa:0:1::3\n")
+
+	assert.Equal(t, "fly-a-very-long", InterfaceName("a-very-long-org-slug"))
+}
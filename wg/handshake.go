@@ -0,0 +1,67 @@
+package wg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MeasureHandshake connects a tunnel over the transport and returns how long
+// it took to complete the first handshake with the peer, connecting included.
+//
+// The tunnel uses the keys of the state, so the peer roams to it meanwhile.
+// The state should hence be that of a peer no other tunnel uses, such as the
+// agent's ones.
+func MeasureHandshake(ctx context.Context, state *WireGuardState, transport string) (time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+
+	var (
+		t   *Tunnel
+		err error
+	)
+
+	switch transport {
+	case TransportUDP:
+		t, err = Connect(ctx, state)
+	case TransportWebsockets:
+		t, err = ConnectWS(ctx, state)
+	default:
+		return 0, fmt.Errorf("unknown transport %q", transport)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	defer t.Close()
+
+	// traffic is what triggers handshakes
+	tnet, dns := t.net, net.JoinHostPort(t.dnsIP.String(), "53")
+	go func() {
+		if c, err := tnet.DialContext(ctx, "tcp", dns); err == nil {
+			c.Close()
+		}
+	}()
+
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("no handshake over %s: %w", transport, ctx.Err())
+		case <-tick.C:
+			stats, err := t.Stats()
+			if err != nil {
+				return 0, err
+			}
+
+			if !stats.LastHandshake.IsZero() {
+				return time.Since(start), nil
+			}
+		}
+	}
+}
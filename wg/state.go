@@ -37,19 +37,7 @@ func (s *WireGuardState) TunnelConfig() *Config {
 		panic(fmt.Sprintf("martian local public: %s/120: %s", s.Peer.Peerip, err))
 	}
 
-	raddr := net.ParseIP(s.Peer.Peerip).To16()
-	for i := 6; i < 16; i++ {
-		raddr[i] = 0
-	}
-
-	// BUG(tqbf): for now, we never manage tunnels for different
-	// organizations, and while this comment is eating more space
-	// than the code I'd need to do this right, it's more fun to
-	// type, so we just hardcode.
-	_, rnet, _ := net.ParseCIDR(fmt.Sprintf("%s/48", raddr))
-
-	raddr[15] = 3
-	dns := net.ParseIP(raddr.String())
+	rnet, dns := OrgNetwork(s.Peer.Peerip)
 
 	// BUG(tqbf): I think this dance just because these needed to
 	// parse for Ben's TOML code.
@@ -66,3 +54,23 @@ func (s *WireGuardState) TunnelConfig() *Config {
 		// LogLevel:        9999999,
 	}
 }
+
+// OrgNetwork returns the 6PN network of the organization the peer IP belongs
+// to, along with the address of the organization's DNS server.
+func OrgNetwork(peerIP string) (*net.IPNet, net.IP) {
+	raddr := net.ParseIP(peerIP).To16()
+	for i := 6; i < 16; i++ {
+		raddr[i] = 0
+	}
+
+	// BUG(tqbf): for now, we never manage tunnels for different
+	// organizations, and while this comment is eating more space
+	// than the code I'd need to do this right, it's more fun to
+	// type, so we just hardcode.
+	_, rnet, _ := net.ParseCIDR(fmt.Sprintf("%s/48", raddr))
+
+	raddr[15] = 3
+	dns := net.ParseIP(raddr.String())
+
+	return rnet, dns
+}
@@ -0,0 +1,117 @@
+package wg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The transports tunnels carry WireGuard over.
+const (
+	TransportUDP        = "udp"
+	TransportWebsockets = "websockets"
+)
+
+// Transport returns the transport the tunnel carries WireGuard over.
+func (t *Tunnel) Transport() string {
+	if t.ws != nil {
+		return TransportWebsockets
+	}
+
+	return TransportUDP
+}
+
+// TunnelStats are the counters of a tunnel's peer.
+type TunnelStats struct {
+	// Endpoint is the address WireGuard packets are currently sent to.
+	Endpoint string
+
+	// BytesIn counts the bytes received from the peer and BytesOut those
+	// sent to it.
+	BytesIn  uint64
+	BytesOut uint64
+
+	// LastHandshake is the time of the latest handshake with the peer. It's
+	// zero when there hasn't been one yet.
+	LastHandshake time.Time
+
+	// DNSQueries counts the queries sent to the organization's DNS server.
+	DNSQueries uint64
+
+	// WebsocketReconnects counts the times the websocket of tunnels carried
+	// over websockets was replaced.
+	WebsocketReconnects uint64
+}
+
+var errTunnelClosed = errors.New("tunnel closed")
+
+// Stats returns the counters of the tunnel.
+func (t *Tunnel) Stats() (*TunnelStats, error) {
+	if t.dev == nil {
+		return nil, errTunnelClosed
+	}
+
+	uapi, err := t.dev.IpcGet()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading device state: %w", err)
+	}
+
+	stats, err := parseStats(uapi)
+	if err != nil {
+		return nil, err
+	}
+	stats.DNSQueries = t.dnsQueries.Load()
+	if t.ws != nil {
+		stats.WebsocketReconnects = t.ws.reconnects.Load()
+	}
+
+	return stats, nil
+}
+
+// parseStats parses the peer counters off the output of the WireGuard
+// configuration protocol's get operation. Tunnels have a single peer.
+func parseStats(uapi string) (*TunnelStats, error) {
+	var (
+		stats     TunnelStats
+		sec, nsec int64
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(uapi))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "endpoint":
+			stats.Endpoint = value
+		case "rx_bytes":
+			stats.BytesIn, err = strconv.ParseUint(value, 10, 64)
+		case "tx_bytes":
+			stats.BytesOut, err = strconv.ParseUint(value, 10, 64)
+		case "last_handshake_time_sec":
+			sec, err = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			nsec, err = strconv.ParseInt(value, 10, 64)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing %s: %w", key, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if sec != 0 || nsec != 0 {
+		stats.LastHandshake = time.Unix(sec, nsec)
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,39 @@
+package wg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStats(t *testing.T) {
+	const uapi = `private_key=0000000000000000000000000000000000000000000000000000000000000000
+listen_port=51820
+public_key=1111111111111111111111111111111111111111111111111111111111111111
+endpoint=[2604:1380::1]:51820
+last_handshake_time_sec=1690000000
+last_handshake_time_nsec=500
+tx_bytes=1024
+rx_bytes=4096
+persistent_keepalive_interval=15
+allowed_ip=fdaa:0:1::/48
+errno=0
+`
+
+	stats, err := parseStats(uapi)
+	require.NoError(t, err)
+
+	assert.Equal(t, "[2604:1380::1]:51820", stats.Endpoint)
+	assert.Equal(t, uint64(4096), stats.BytesIn)
+	assert.Equal(t, uint64(1024), stats.BytesOut)
+	assert.True(t, stats.LastHandshake.Equal(time.Unix(1690000000, 500)))
+
+	stats, err = parseStats("last_handshake_time_sec=0\nlast_handshake_time_nsec=0\n")
+	require.NoError(t, err)
+	assert.True(t, stats.LastHandshake.IsZero())
+
+	_, err = parseStats("rx_bytes=lots\n")
+	assert.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"net"
 	"net/netip"
+	"sync/atomic"
 
 	"github.com/miekg/dns"
 	"golang.zx2c4.com/wireguard/conn"
@@ -25,7 +26,10 @@ type Tunnel struct {
 	Config *Config
 
 	wscancel func()
+	ws       *WsWgProxy
 	resolv   *net.Resolver
+
+	dnsQueries atomic.Uint64
 }
 
 func Connect(ctx context.Context, state *WireGuardState) (*Tunnel, error) {
@@ -71,9 +75,10 @@ func doConnect(ctx context.Context, state *WireGuardState, wswg bool) (*Tunnel,
 	endpointIP := endpointIPs[rand.Intn(len(endpointIPs))]
 	endpointAddr := net.JoinHostPort(endpointIP.String(), endpointPort)
 
+	var proxy *WsWgProxy
 	if wswg {
-		port, err := websocketConnect(ctx, endpointHost)
-		if err != nil {
+		var port int
+		if proxy, port, err = websocketConnect(ctx, endpointHost); err != nil {
 			return nil, err
 		}
 
@@ -94,22 +99,25 @@ func doConnect(ctx context.Context, state *WireGuardState, wswg bool) (*Tunnel,
 	}
 	wgDev.Up()
 
-	return &Tunnel{
+	t := &Tunnel{
 		dev:    wgDev,
 		tun:    tunDev,
 		net:    gNet,
 		dnsIP:  cfg.DNS,
 		Config: cfg,
 		State:  state,
+		ws:     proxy,
+	}
 
-		resolv: &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				fmt.Println("resolver.Dial", network, address)
-				return gNet.DialContext(ctx, "tcp", net.JoinHostPort(dnsIP.String(), "53"))
-			},
+	t.resolv = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			t.dnsQueries.Add(1)
+			return gNet.DialContext(ctx, "tcp", net.JoinHostPort(dnsIP.String(), "53"))
 		},
-	}, nil
+	}
+
+	return t, nil
 }
 
 func (t *Tunnel) Close() error {
@@ -198,6 +206,8 @@ func (t *Tunnel) queryDNS(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
 		},
 	}
 
+	t.dnsQueries.Add(1)
+
 	c, err := t.DialContext(ctx, "tcp", net.JoinHostPort(t.dnsIP.String(), "53"))
 	if err != nil {
 		return nil, err
@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/websocket"
@@ -71,6 +72,9 @@ type WsWgProxy struct {
 	atime        time.Time
 	reset        chan bool
 	limit        *rate.Limiter
+
+	// reconnects counts the times the websocket was replaced.
+	reconnects atomic.Uint64
 }
 
 // this is gross, but, keep the rest of the WireGuard code in
@@ -120,7 +124,7 @@ func (wswg *WsWgProxy) resetConn(c net.Conn, err error) {
 
 	wswg.limit.Wait(context.Background())
 
-	log.Printf("resetting connection due to error: %s", err)
+	log.Printf("wswg: resetting connection due to error: %s", err)
 	wswg.reset <- true
 }
 
@@ -131,7 +135,7 @@ func (wswg *WsWgProxy) Port() (int, error) {
 		return 0, fmt.Errorf("plugboard: can't recover UDP port")
 	}
 
-	log.Printf("returning port: %d", udpBindAddr.Port)
+	log.Printf("wswg: returning port: %d", udpBindAddr.Port)
 
 	return udpBindAddr.Port, nil
 }
@@ -139,7 +143,7 @@ func (wswg *WsWgProxy) Port() (int, error) {
 func (wswg *WsWgProxy) Connect(endpoint string) error {
 	rurl := fmt.Sprintf("wss://%s:443/", endpoint)
 
-	log.Printf("(re-)connecting to %s", rurl)
+	log.Printf("wswg: connecting to %s", rurl)
 
 	conf, _ := websocket.NewConfig(rurl, rurl)
 	conf.TlsConfig = &tls.Config{
@@ -167,6 +171,27 @@ func (wswg *WsWgProxy) Connect(endpoint string) error {
 	return nil
 }
 
+// reconnect replaces the websocket, logging why and how that went. Failed
+// attempts are retried once the current websocket errors again.
+func (wswg *WsWgProxy) reconnect(endpoint, reason string) {
+	log.Printf("wswg: reconnecting to %s: %s (%d reconnects so far)", endpoint, reason, wswg.reconnects.Load())
+
+	start := time.Now()
+
+	wswg.lock.Lock()
+	err := wswg.Connect(endpoint)
+	wswg.lock.Unlock()
+
+	if err != nil {
+		log.Printf("wswg: failed reconnecting to %s after %s: %s", endpoint, time.Since(start), err)
+
+		return
+	}
+
+	wswg.reconnects.Add(1)
+	log.Printf("wswg: reconnected to %s in %s", endpoint, time.Since(start))
+}
+
 func isTimeout(e error) bool {
 	if err, ok := e.(net.Error); ok && err.Timeout() {
 		return true
@@ -199,6 +224,8 @@ func (wswg *WsWgProxy) ws2wg(ctx context.Context) {
 			}
 
 			wswg.resetConn(c, err)
+
+			continue
 		}
 
 		wswg.touch()
@@ -225,7 +252,9 @@ func (wswg *WsWgProxy) wg2ws(ctx context.Context) {
 			}
 
 			// resetting won't do anything here
-			log.Printf("error reading from udp plugboard: %s", err)
+			log.Printf("wswg: error reading from udp plugboard: %s", err)
+
+			continue
 		}
 
 		wswg.lock.Lock()
@@ -241,19 +270,19 @@ func (wswg *WsWgProxy) wg2ws(ctx context.Context) {
 	}
 }
 
-func websocketConnect(ctx context.Context, endpoint string) (int, error) {
+func websocketConnect(ctx context.Context, endpoint string) (*WsWgProxy, int, error) {
 	wswg, err := NewWsWgProxy()
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
 	port, err := wswg.Port()
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
 	if err = wswg.Connect(endpoint); err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
 	go func() {
@@ -266,31 +295,35 @@ func websocketConnect(ctx context.Context, endpoint string) (int, error) {
 		tick := time.NewTicker(5 * time.Second)
 		defer tick.Stop()
 
-		reconnectAt := time.Time{}
+		var (
+			reconnectAt time.Time
+			reason      string
+		)
+
+		schedule := func(why string) {
+			if reconnectAt.IsZero() {
+				reconnectAt = time.Now().Add(5 * time.Second)
+				reason = why
+			}
+		}
 
 		for {
 			select {
 			case <-tick.C:
 				if !reconnectAt.IsZero() && reconnectAt.Before(time.Now()) {
-					wswg.lock.Lock()
-					wswg.Connect(endpoint)
-					wswg.lock.Unlock()
-
 					reconnectAt = time.Time{}
+
+					wswg.reconnect(endpoint, reason)
 				}
 
 			case <-ctx.Done():
 				return
 
-			case <-c:
-				if reconnectAt.IsZero() {
-					reconnectAt = time.Now().Add(5 * time.Second)
-				}
+			case sig := <-c:
+				schedule(fmt.Sprintf("received %s", sig))
 
 			case <-wswg.reset:
-				if reconnectAt.IsZero() {
-					reconnectAt = time.Now().Add(5 * time.Second)
-				}
+				schedule("connection error")
 			}
 		}
 	}()
@@ -314,5 +347,5 @@ func websocketConnect(ctx context.Context, endpoint string) (int, error) {
 		}
 	}()
 
-	return port, nil
+	return wswg, port, nil
 }